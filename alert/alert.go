@@ -3,23 +3,26 @@ package alert
 import (
 	"context"
 	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
 	"crypto-portfolio-tracker/db"
-	emailpkg "crypto-portfolio-tracker/email"
 	customerrors "crypto-portfolio-tracker/errors"
 	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/notify"
 	"crypto-portfolio-tracker/portfolio"
+	"crypto-portfolio-tracker/watchlist"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func ValidateCoinExists(coinID string, userEmail string, apiClient api.CryptoApi) error {
+func ValidateCoinExists(ctx context.Context, store db.Store, coinID string, userEmail string, apiClient api.CryptoApi) error {
 	coinID = strings.ToLower(strings.TrimSpace(coinID))
 
-	p, err := portfolio.GetPortfolio(userEmail)
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
 	if err != nil {
 		return fmt.Errorf("could not load portfolio: %w", err)
 	}
@@ -30,177 +33,545 @@ func ValidateCoinExists(coinID string, userEmail string, apiClient api.CryptoApi
 		}
 	}
 
+	w, err := watchlist.GetWatchlist(ctx, store, userEmail)
+	if err != nil {
+		return fmt.Errorf("could not load watchlist: %w", err)
+	}
+	if w.Has(coinID) {
+		return nil
+	}
+
 	return customerrors.NewPortfolioError(
 		"validate coin",
 		coinID,
-		fmt.Errorf("coin %q is not in your portfolio — only portfolio coins can have alerts", coinID),
+		fmt.Errorf("coin %q is not in your portfolio or watchlist — add it to your watchlist to set alerts on it", coinID),
 	)
 }
 
-func CreateAlert(userEmail, coinID, coinName string, alertType models.AlertType, threshold float64, apiClient api.CryptoApi) error {
-	coinID = strings.ToLower(strings.TrimSpace(coinID))
+func CreateAlert(ctx context.Context, store db.Store, userEmail, coinID, coinName string, alertType models.AlertType, threshold float64, vsCurrency string, apiClient api.CryptoApi) error {
+	_, err := AddAlert(ctx, store, apiClient, models.Alert{
+		UserEmail:      userEmail,
+		CoinID:         coinID,
+		CoinName:       coinName,
+		AlertType:      alertType,
+		ThresholdPrice: threshold,
+		Currency:       vsCurrency,
+	})
+	return err
+}
 
-	if threshold <= 0 {
-		return customerrors.NewValidationError("threshold_price", threshold, customerrors.ErrInvalidPrice)
-	}
+// AddAlert validates a and stores it as a new untriggered alert. For
+// percent-move alerts the reference price is captured now, either from the
+// live price or from the user's average buy price.
+func AddAlert(ctx context.Context, store db.Store, apiClient api.CryptoApi, a models.Alert) (*models.Alert, error) {
+	a.CoinID = strings.ToLower(strings.TrimSpace(a.CoinID))
 
-	if err := ValidateCoinExists(coinID, userEmail, apiClient); err != nil {
-		return err
+	vsCurrency, err := currency.Normalize(a.Currency)
+	if err != nil {
+		return nil, err
 	}
+	a.Currency = vsCurrency
 
-	database, err := db.ConnectDatabase()
-	if err != nil {
-		return customerrors.NewDatabaseError("connect", "alerts", err)
+	switch a.AlertType {
+	case models.AlertTypeBuy, models.AlertTypeSell:
+		if a.ThresholdPrice <= 0 {
+			return nil, customerrors.NewValidationError("threshold_price", a.ThresholdPrice, customerrors.ErrInvalidPrice)
+		}
+	case models.AlertTypePercentMove:
+		if a.PercentChange <= 0 {
+			return nil, customerrors.NewValidationError("percent_change", a.PercentChange, customerrors.ErrInvalidAlert)
+		}
+		if a.Direction == "" {
+			a.Direction = models.MoveEither
+		}
+		if !a.Direction.Valid() {
+			return nil, customerrors.NewValidationError("direction", a.Direction, customerrors.ErrInvalidAlert)
+		}
+		if a.Direction == models.MoveDown && a.PercentChange >= 100 {
+			return nil, customerrors.NewValidationError("percent_change", a.PercentChange, customerrors.ErrInvalidAlert)
+		}
+		if a.ReferenceSource == "" {
+			a.ReferenceSource = models.ReferenceCreation
+		}
+		if !a.ReferenceSource.Valid() {
+			return nil, customerrors.NewValidationError("reference_source", a.ReferenceSource, customerrors.ErrInvalidAlert)
+		}
+	case models.AlertTypePortfolioValue, models.AlertTypePortfolioPL, models.AlertTypeCoinWeight:
+		if err := validatePortfolioAlert(&a); err != nil {
+			return nil, err
+		}
+		if a.AlertType == models.AlertTypePortfolioPL {
+			if err := checkCostCurrency(ctx, store, a); err != nil {
+				return nil, err
+			}
+		}
+	case models.AlertTypeExpression:
+		if err := validateExpressionAlert(ctx, store, apiClient, &a); err != nil {
+			return nil, err
+		}
+	case models.AlertTypeTrailingStop:
+		if (a.TrailAmount > 0) == (a.TrailPercent > 0) || a.TrailAmount < 0 || a.TrailPercent < 0 {
+			return nil, customerrors.NewValidationError("trail", "set exactly one of amount or percent", customerrors.ErrInvalidAlert)
+		}
+		if a.TrailPercent >= 100 {
+			return nil, customerrors.NewValidationError("trail_percent", a.TrailPercent, customerrors.ErrInvalidAlert)
+		}
+	default:
+		return nil, customerrors.NewValidationError("alert_type", a.AlertType, customerrors.ErrInvalidAlert)
 	}
 
-	alert := models.Alert{
-		ID:             primitive.NewObjectID().Hex(),
-		UserEmail:      userEmail,
-		CoinID:         coinID,
-		CoinName:       coinName,
-		AlertType:      alertType,
-		ThresholdPrice: threshold,
-		Triggered:      false,
-		CreatedAt:      time.Now(),
+	if err := validateSchedule(&a, time.Now()); err != nil {
+		return nil, err
 	}
 
-	_, err = database.Collection("alerts").InsertOne(context.TODO(), alert)
-	if err != nil {
-		return customerrors.NewDatabaseError("insert", "alerts", err)
+	// Portfolio-value, portfolio-P&L and expression alerts are not tied to a
+	// single coin; every other type needs one the user holds or watches.
+	switch a.AlertType {
+	case models.AlertTypePortfolioValue, models.AlertTypePortfolioPL, models.AlertTypeExpression:
+	default:
+		if a.CoinID == "" {
+			return nil, customerrors.NewValidationError("coin_id", a.CoinID, customerrors.ErrInvalidAlert)
+		}
+		if err := ValidateCoinExists(ctx, store, a.CoinID, a.UserEmail, apiClient); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
-}
+	if a.AlertType == models.AlertTypePercentMove {
+		ref, err := referencePrice(ctx, store, apiClient, a)
+		if err != nil {
+			return nil, err
+		}
+		a.ReferencePrice = ref
+		a.ReferenceCurrency = a.Currency
+	}
 
-func GetAlerts(userEmail string) ([]models.Alert, error) {
-	database, err := db.ConnectDatabase()
-	if err != nil {
-		return nil, customerrors.NewDatabaseError("connect", "alerts", err)
+	if a.AlertType == models.AlertTypeTrailingStop {
+		price, err := apiClient.FetchPrice(ctx, a.CoinID, a.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch starting price: %w", err)
+		}
+		a.HighWaterMark = price
 	}
 
-	cursor, err := database.Collection("alerts").Find(
-		context.TODO(),
-		bson.M{"user_email": userEmail, "triggered": false},
-	)
-	if err != nil {
-		return nil, customerrors.NewDatabaseError("find", "alerts", err)
+	a.ID = primitive.NewObjectID().Hex()
+	a.Triggered = false
+	a.TriggeredAt = time.Time{}
+	a.CreatedAt = time.Now()
+	a.FireCount = 0
+	a.LastFiredAt = time.Time{}
+	a.Disarmed = false
+	a.Expired = false
+	a.Version = 0
+
+	if err := store.Alerts().Create(ctx, &a); err != nil {
+		return nil, err
 	}
-	defer cursor.Close(context.TODO())
+	return &a, nil
+}
 
-	var alerts []models.Alert
-	if err := cursor.All(context.TODO(), &alerts); err != nil {
-		return nil, customerrors.NewDatabaseError("decode", "alerts", err)
+func referencePrice(ctx context.Context, store db.Store, apiClient api.CryptoApi, a models.Alert) (float64, error) {
+	switch a.ReferenceSource {
+	case models.ReferenceAvgBuy:
+		p, err := portfolio.GetPortfolio(ctx, store, a.UserEmail)
+		if err != nil {
+			return 0, fmt.Errorf("could not load portfolio: %w", err)
+		}
+		for _, h := range p.Holdings {
+			if h.CoinID == a.CoinID && h.BuyPrice > 0 {
+				if !currency.Equal(h.Currency, a.Currency) {
+					return 0, customerrors.NewPortfolioError("reference price", a.CoinID, fmt.Errorf(
+						"%w: average buy price is in %s, alert is in %s", customerrors.ErrCurrencyMismatch,
+						strings.ToUpper(currency.OrDefault(h.Currency)), strings.ToUpper(a.Currency),
+					))
+				}
+				return h.BuyPrice, nil
+			}
+		}
+		return 0, customerrors.NewPortfolioError("reference price", a.CoinID, customerrors.ErrCoinNotFound)
+	default:
+		price, err := apiClient.FetchPrice(ctx, a.CoinID, a.Currency)
+		if err != nil {
+			return 0, fmt.Errorf("could not fetch reference price: %w", err)
+		}
+		return price, nil
 	}
+}
 
-	return alerts, nil
+func GetAlerts(ctx context.Context, store db.Store, userEmail string) ([]models.Alert, error) {
+	return store.Alerts().ListActive(ctx, userEmail)
 }
 
-func CheckAndTriggerAlerts(userEmail string, apiClient api.CryptoApi) error {
-	alerts, err := GetAlerts(userEmail)
-	if err != nil {
-		return err
+// firedAlert is an alert whose condition was met, with the price (or, for
+// portfolio-level alerts, the metric value) that met it.
+type firedAlert struct {
+	alert   models.Alert
+	price   float64
+	firedAt time.Time
+
+	// mail holds the owner's email notifications, enqueued in the outbox
+	// together with the alert update and their queued history events;
+	// notifiers are the other channels, notified directly once the update
+	// is stored.
+	mail      []models.OutboxMessage
+	events    []models.AlertEvent
+	notifiers []notify.Notifier
+}
+
+func shouldTrigger(a models.Alert, currentPrice float64) bool {
+	switch a.AlertType {
+	case models.AlertTypeBuy:
+		return currentPrice <= a.ThresholdPrice
+	case models.AlertTypeSell:
+		return currentPrice >= a.ThresholdPrice
+	case models.AlertTypePercentMove:
+		if a.ReferencePrice <= 0 {
+			return false
+		}
+		if a.ReferenceCurrency != "" && !currency.Equal(a.ReferenceCurrency, a.Currency) {
+			return false
+		}
+		move := a.MoveFromReference(currentPrice)
+		switch a.Direction {
+		case models.MoveUp:
+			return move >= a.PercentChange
+		case models.MoveDown:
+			return move <= -a.PercentChange
+		default:
+			return math.Abs(move) >= a.PercentChange
+		}
+	case models.AlertTypeTrailingStop:
+		return a.HighWaterMark > 0 && currentPrice <= a.EffectiveStop()
+	case models.AlertTypePortfolioValue, models.AlertTypePortfolioPL, models.AlertTypeCoinWeight:
+		return a.Comparator.Met(currentPrice, a.Threshold)
+	case models.AlertTypeExpression:
+		return currentPrice != 0
 	}
+	return false
+}
 
-	if len(alerts) == 0 {
-		fmt.Println("No active alerts to check.")
-		return nil
+// evaluate applies the current price to a, ratcheting any trailing state, and
+// reports whether the alert fires and whether a changed and must be saved.
+func evaluate(a *models.Alert, currentPrice float64) (fire, dirty bool) {
+	if a.AlertType == models.AlertTypeTrailingStop && currentPrice > a.HighWaterMark {
+		a.HighWaterMark = currentPrice
+		return false, true
 	}
+	return shouldTrigger(*a, currentPrice), false
+}
 
+// fetchAlertPrices looks up the current price of every alerted coin, every
+// coin an expression references, and every holding behind an alert that needs
+// portfolio metrics, batching coin IDs per quote currency so alerts across
+// many users share requests. Currencies whose lookup fails are left out and
+// reported in the error.
+func fetchAlertPrices(ctx context.Context, apiClient api.CryptoApi, alerts []models.Alert, portfolios map[string]*models.Portfolio) (map[string]map[string]float64, error) {
+	coinsByCurrency := make(map[string][]string)
 	seen := make(map[string]bool)
-	var coinIDs []string
+	add := func(quote, coinID string) {
+		if key := quote + "/" + coinID; !seen[key] {
+			coinsByCurrency[quote] = append(coinsByCurrency[quote], coinID)
+			seen[key] = true
+		}
+	}
 	for _, a := range alerts {
-		if !seen[a.CoinID] {
-			coinIDs = append(coinIDs, a.CoinID)
-			seen[a.CoinID] = true
+		quote := currency.OrDefault(a.Currency)
+		if a.CoinID != "" {
+			add(quote, a.CoinID)
+		}
+		if e, err := alertExpression(a); err == nil && e != nil {
+			for _, id := range e.coins {
+				add(quote, id)
+			}
+		}
+		if !needsPortfolio(a) {
+			continue
+		}
+		if p, ok := portfolios[a.UserEmail]; ok {
+			for _, h := range p.Holdings {
+				add(quote, h.CoinID)
+			}
 		}
 	}
 
-	prices, err := apiClient.FetchMultiplePrices(coinIDs...)
-	if err != nil {
-		return fmt.Errorf("could not fetch prices for alert check: %w", err)
+	prices := make(map[string]map[string]float64, len(coinsByCurrency))
+	var errs []error
+	for quote, coinIDs := range coinsByCurrency {
+		prices[quote] = make(map[string]float64, len(coinIDs))
+		for start := 0; start < len(coinIDs); start += maxPriceBatch {
+			end := min(start+maxPriceBatch, len(coinIDs))
+			p, err := apiClient.FetchMultiplePrices(ctx, quote, coinIDs[start:end]...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not fetch %s prices for alert check: %w", quote, err))
+				continue
+			}
+			for id, price := range p {
+				prices[quote][id] = price
+			}
+		}
+	}
+
+	return prices, errors.Join(errs...)
+}
+
+// saveAlertState persists non-firing state changes such as a ratcheted
+// trailing stop, a re-armed recurring alert or an expiry. A conflict means a
+// concurrent checker already moved the alert on, so it is not reported.
+func saveAlertState(ctx context.Context, store db.Store, a *models.Alert) {
+	if err := store.Alerts().Update(ctx, a); err != nil && !errors.Is(err, customerrors.ErrConflict) {
+		fmt.Printf("  Warning: could not save alert state for %s: %v\n", a.CoinID, err)
 	}
+}
 
-	database, err := db.ConnectDatabase()
+// triggerAlerts fires every alert whose condition is met, advancing trailing,
+// recurring and expiry state as it goes. An alert changed by a concurrent
+// checker since it was loaded is skipped, so each firing happens once.
+func triggerAlerts(ctx context.Context, store db.Store, apiClient api.CryptoApi, alerts []models.Alert) ([]firedAlert, error) {
+	portfolios, err := loadAlertPortfolios(ctx, store, alerts)
 	if err != nil {
-		return customerrors.NewDatabaseError("connect", "alerts", err)
+		return nil, err
 	}
 
-	triggeredCount := 0
+	prices, fetchErr := fetchAlertPrices(ctx, apiClient, alerts, portfolios)
+	stats, statsErr := fetchAlertStats(ctx, apiClient, alerts)
+	fetchErr = errors.Join(fetchErr, statsErr)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var fired []firedAlert
 	for _, a := range alerts {
-		currentPrice, ok := prices[a.CoinID]
-		if !ok {
-			fmt.Printf("  Warning: price not available for %s, skipping.\n", a.CoinID)
+		if retireIfExpired(&a, now) {
+			saveAlertState(ctx, store, &a)
 			continue
 		}
 
-		triggered := false
-		switch a.AlertType {
-		case models.AlertTypeBuy:
-			triggered = currentPrice <= a.ThresholdPrice
-		case models.AlertTypeSell:
-			triggered = currentPrice >= a.ThresholdPrice
-		}
-
-		if triggered {
-			now := time.Now()
-			_, err := database.Collection("alerts").UpdateOne(
-				context.TODO(),
-				bson.M{"_id": a.ID},
-				bson.M{"$set": bson.M{
-					"triggered":    true,
-					"triggered_at": now,
-				}},
-			)
+		quote := currency.OrDefault(a.Currency)
+
+		// For portfolio-level alerts the observed value is the metric
+		// rather than a coin price.
+		var currentPrice float64
+		switch {
+		case a.AlertType == models.AlertTypeExpression:
+			a.Currency = quote
+			value, err := expressionValue(ctx, a, portfolios[a.UserEmail], prices[quote], stats[quote])
 			if err != nil {
-				fmt.Printf("  Warning: could not mark alert as triggered for %s: %v\n", a.CoinID, err)
+				fmt.Printf("  Warning: could not evaluate %q for %s, skipping: %v\n", a.Expression, a.UserEmail, err)
+				continue
+			}
+			currentPrice = value
+		case a.AlertType.IsPortfolioLevel():
+			a.Currency = quote
+			value, err := portfolioMetric(ctx, a, portfolios[a.UserEmail], prices[quote])
+			if err != nil {
+				fmt.Printf("  Warning: could not compute %s for %s, skipping: %v\n", a.AlertType, a.UserEmail, err)
 				continue
 			}
+			currentPrice = value
+		default:
+			price, ok := prices[quote][a.CoinID]
+			if !ok {
+				fmt.Printf("  Warning: price not available for %s, skipping.\n", a.CoinID)
+				continue
+			}
+			currentPrice = price
+		}
+
+		fire, dirty := step(&a, currentPrice, now)
+		if !fire {
+			if dirty {
+				saveAlertState(ctx, store, &a)
+			}
+			continue
+		}
 
-			sendAlertEmail(userEmail, a, currentPrice)
-			triggeredCount++
+		f := firedAlert{alert: a, price: currentPrice}
+		prepareNotifications(ctx, store, &f)
+		if err := store.Alerts().UpdateWithOutbox(ctx, &f.alert, f.events, f.mail...); err != nil {
+			if !errors.Is(err, customerrors.ErrConflict) {
+				fmt.Printf("  Warning: could not mark alert as triggered for %s: %v\n", a.CoinID, err)
+			}
+			continue
 		}
+		fired = append(fired, f)
+	}
+
+	return fired, fetchErr
+}
+
+func CheckAndTriggerAlerts(ctx context.Context, store db.Store, userEmail string, apiClient api.CryptoApi) error {
+	alerts, err := GetAlerts(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+
+	if len(alerts) == 0 {
+		fmt.Println("No active alerts to check.")
+		return nil
+	}
+
+	fired, err := triggerAlerts(ctx, store, apiClient, alerts)
+	for _, f := range fired {
+		notifyFired(ctx, store, f)
 	}
 
-	if triggeredCount == 0 {
+	if len(fired) == 0 {
 		fmt.Printf("  Checked %d alert(s) — none triggered yet.\n", len(alerts))
 	} else {
-		fmt.Printf("  %d alert(s) triggered and email(s) sent.\n", triggeredCount)
+		fmt.Printf("  %d alert(s) triggered and notifications sent.\n", len(fired))
 	}
 
-	return nil
+	return err
+}
+
+func alertMessage(a models.Alert, currentPrice float64) (subject, body string) {
+	const signature = "— Crypto Portfolio Tracker"
+
+	switch a.AlertType {
+	case models.AlertTypeExpression:
+		subject = "Crypto Alert: custom condition met"
+		body = fmt.Sprintf(
+			"Hello,\n\n"+
+				"Your custom alert condition has been met.\n\n"+
+				"  Condition       : %s\n"+
+				"  Currency        : %s\n\n"+
+				signature,
+			a.Expression, strings.ToUpper(a.Currency),
+		)
+
+	case models.AlertTypePortfolioValue, models.AlertTypePortfolioPL, models.AlertTypeCoinWeight:
+		label := metricLabel(a)
+		subject = fmt.Sprintf("Crypto Alert: %s %s %s", label, a.Comparator, formatMetric(a, a.Threshold))
+		body = fmt.Sprintf(
+			"Hello,\n\n"+
+				"Your alert on %s has been triggered.\n\n"+
+				"  Threshold       : %s %s\n"+
+				"  Current Value   : %s\n\n"+
+				signature,
+			label,
+			a.Comparator, formatMetric(a, a.Threshold),
+			formatMetric(a, currentPrice),
+		)
+
+	case models.AlertTypePercentMove:
+		move := a.MoveFromReference(currentPrice)
+		subject = fmt.Sprintf("Crypto Alert: %s moved %+.2f%%", a.CoinName, move)
+		body = fmt.Sprintf(
+			"Hello,\n\n"+
+				"Your %.2f%% move alert for %s (%s) has been triggered.\n\n"+
+				"  Reference Price : %s (%s)\n"+
+				"  Current Price   : %s\n"+
+				"  Change          : %+.2f%%\n\n"+
+				signature,
+			a.PercentChange, a.CoinName, a.CoinID,
+			currency.Format(a.ReferencePrice, a.Currency), referenceLabel(a.ReferenceSource),
+			currency.Format(currentPrice, a.Currency),
+			move,
+		)
+
+	case models.AlertTypeTrailingStop:
+		subject = fmt.Sprintf("Crypto Alert: %s trailing stop hit!", a.CoinName)
+		body = fmt.Sprintf(
+			"Hello,\n\n"+
+				"Your trailing stop (%s) for %s (%s) has been triggered.\n\n"+
+				"  Highest Price   : %s\n"+
+				"  Stop Price      : %s\n"+
+				"  Current Price   : %s\n\n"+
+				"Consider this a signal to sell.\n\n"+
+				signature,
+			trailLabel(a), a.CoinName, a.CoinID,
+			currency.Format(a.HighWaterMark, a.Currency),
+			currency.Format(a.EffectiveStop(), a.Currency),
+			currency.Format(currentPrice, a.Currency),
+		)
+
+	default:
+		var action, direction string
+		if a.AlertType == models.AlertTypeBuy {
+			action = "BUY"
+			direction = "dropped to"
+		} else {
+			action = "SELL"
+			direction = "risen to"
+		}
+
+		subject = fmt.Sprintf("Crypto Alert: %s %s threshold reached!", a.CoinName, action)
+		body = fmt.Sprintf(
+			"Hello,\n\n"+
+				"Your %s alert for %s (%s) has been triggered.\n\n"+
+				"  Threshold Price : %s\n"+
+				"  Current Price   : %s\n"+
+				"  Status          : Price has %s your threshold.\n\n"+
+				"Consider this a signal to %s.\n\n"+
+				signature,
+			action, a.CoinName, a.CoinID,
+			currency.Format(a.ThresholdPrice, a.Currency),
+			currency.Format(currentPrice, a.Currency),
+			direction,
+			strings.ToLower(action),
+		)
+	}
+
+	return subject, body
+}
+
+// Describe summarises an alert's condition in one line, e.g. "SELL at $45,000.00".
+func Describe(a models.Alert) string {
+	if a.Recurring {
+		return describeCondition(a) + " (recurring)"
+	}
+	return describeCondition(a)
 }
 
-func sendAlertEmail(userEmail string, a models.Alert, currentPrice float64) {
-	var action, direction string
-	if a.AlertType == models.AlertTypeBuy {
-		action = "BUY"
-		direction = "dropped to"
+func describeCondition(a models.Alert) string {
+	switch a.AlertType {
+	case models.AlertTypeExpression:
+		return "WHEN " + a.Expression
+	case models.AlertTypePercentMove:
+		return fmt.Sprintf("MOVE %s %.2f%% from %s",
+			strings.ToUpper(string(a.Direction)), a.PercentChange, currency.Format(a.ReferencePrice, a.Currency))
+	case models.AlertTypeTrailingStop:
+		return fmt.Sprintf("TRAILING STOP %s, stop at %s", trailLabel(a), currency.Format(a.EffectiveStop(), a.Currency))
+	case models.AlertTypePortfolioValue, models.AlertTypePortfolioPL, models.AlertTypeCoinWeight:
+		return fmt.Sprintf("%s %s %s", strings.ToUpper(metricLabel(a)), strings.ToUpper(string(a.Comparator)), formatMetric(a, a.Threshold))
+	default:
+		return fmt.Sprintf("%s at %s", strings.ToUpper(string(a.AlertType)), currency.Format(a.ThresholdPrice, a.Currency))
+	}
+}
+
+func trailLabel(a models.Alert) string {
+	if a.TrailPercent > 0 {
+		return fmt.Sprintf("%.2f%% below high", a.TrailPercent)
+	}
+	return currency.Format(a.TrailAmount, a.Currency) + " below high"
+}
+
+func scheduleLabel(a models.Alert) string {
+	label := fmt.Sprintf("re-arms %.2f%% past the trigger", a.RearmPercent)
+	if a.AlertType == models.AlertTypeTrailingStop {
+		label = fmt.Sprintf("re-arms %.2f%% of the trail above the stop", a.RearmPercent)
+	}
+	if a.Cooldown > 0 {
+		label += fmt.Sprintf(", cooldown %v", a.Cooldown)
+	}
+	if a.MaxFirings > 0 {
+		label += fmt.Sprintf(", fired %d of %d", a.FireCount, a.MaxFirings)
 	} else {
-		action = "SELL"
-		direction = "risen to"
-	}
-
-	subject := fmt.Sprintf("Crypto Alert: %s %s threshold reached!", a.CoinName, action)
-	body := fmt.Sprintf(
-		"Hello,\n\n"+
-			"Your %s alert for %s (%s) has been triggered.\n\n"+
-			"  Threshold Price : $%.2f\n"+
-			"  Current Price   : $%.2f\n"+
-			"  Status          : Price has %s your threshold.\n\n"+
-			"Consider this a signal to %s.\n\n"+
-			"— Crypto Portfolio Tracker",
-		action, a.CoinName, a.CoinID,
-		a.ThresholdPrice,
-		currentPrice,
-		direction,
-		strings.ToLower(action),
-	)
+		label += fmt.Sprintf(", fired %d time(s)", a.FireCount)
+	}
+	return label
+}
 
-	emailpkg.SendAlert(userEmail, subject, body)
+func referenceLabel(src models.ReferenceSource) string {
+	if src == models.ReferenceAvgBuy {
+		return "average buy price"
+	}
+	return "price at creation"
 }
 
-func DisplayAlerts(userEmail string) error {
-	alerts, err := GetAlerts(userEmail)
+func DisplayAlerts(ctx context.Context, store db.Store, userEmail string) error {
+	alerts, err := GetAlerts(ctx, store, userEmail)
 	if err != nil {
 		return err
 	}
@@ -212,33 +583,53 @@ func DisplayAlerts(userEmail string) error {
 
 	fmt.Println("\n========== YOUR ALERTS ==========")
 	for i, a := range alerts {
-		fmt.Printf("\n[%d] %s (%s)\n", i+1, a.CoinName, a.CoinID)
-		fmt.Printf("    Type      : %s\n", strings.ToUpper(string(a.AlertType)))
-		fmt.Printf("    Threshold : $%.2f\n", a.ThresholdPrice)
+		if a.CoinID == "" {
+			fmt.Printf("\n[%d] %s\n", i+1, a.CoinName)
+		} else {
+			fmt.Printf("\n[%d] %s (%s)\n", i+1, a.CoinName, a.CoinID)
+		}
+		switch a.AlertType {
+		case models.AlertTypeExpression:
+			fmt.Printf("    Type      : CUSTOM CONDITION\n")
+			fmt.Printf("    Condition : %s\n", a.Expression)
+		case models.AlertTypePortfolioValue, models.AlertTypePortfolioPL, models.AlertTypeCoinWeight:
+			fmt.Printf("    Type      : %s\n", strings.ToUpper(metricLabel(a)))
+			fmt.Printf("    Threshold : %s %s\n", a.Comparator, formatMetric(a, a.Threshold))
+		case models.AlertTypePercentMove:
+			fmt.Printf("    Type      : MOVE %s %.2f%%\n", strings.ToUpper(string(a.Direction)), a.PercentChange)
+			fmt.Printf("    Reference : %s (%s)\n", currency.Format(a.ReferencePrice, a.Currency), referenceLabel(a.ReferenceSource))
+		case models.AlertTypeTrailingStop:
+			fmt.Printf("    Type      : TRAILING STOP %s\n", trailLabel(a))
+			fmt.Printf("    High      : %s\n", currency.Format(a.HighWaterMark, a.Currency))
+			fmt.Printf("    Stop      : %s\n", currency.Format(a.EffectiveStop(), a.Currency))
+		default:
+			fmt.Printf("    Type      : %s\n", strings.ToUpper(string(a.AlertType)))
+			fmt.Printf("    Threshold : %s\n", currency.Format(a.ThresholdPrice, a.Currency))
+		}
 		fmt.Printf("    Created   : %s\n", a.CreatedAt.Format("02 Jan 2006, 15:04 UTC"))
+		if a.Recurring {
+			fmt.Printf("    Repeats   : %s\n", scheduleLabel(a))
+			status := "armed"
+			if a.Disarmed {
+				status = "waiting to re-arm"
+			} else if a.InCooldown(time.Now()) {
+				status = "cooling down until " + a.LastFiredAt.Add(a.Cooldown).Format("02 Jan 2006, 15:04 UTC")
+			}
+			fmt.Printf("    Status    : %s\n", status)
+		}
+		if !a.ExpiresAt.IsZero() {
+			fmt.Printf("    Expires   : %s\n", a.ExpiresAt.Format("02 Jan 2006, 15:04 UTC"))
+		}
 	}
 	fmt.Println("\n=================================")
 
 	return nil
 }
 
-func DeleteAlert(userEmail, alertID string) error {
-	database, err := db.ConnectDatabase()
-	if err != nil {
-		return customerrors.NewDatabaseError("connect", "alerts", err)
-	}
-
-	result, err := database.Collection("alerts").DeleteOne(
-		context.TODO(),
-		bson.M{"_id": alertID, "user_email": userEmail},
-	)
-	if err != nil {
-		return customerrors.NewDatabaseError("delete", "alerts", err)
-	}
-
-	if result.DeletedCount == 0 {
+func DeleteAlert(ctx context.Context, store db.Store, userEmail, alertID string) error {
+	err := store.Alerts().Delete(ctx, userEmail, alertID)
+	if errors.Is(err, customerrors.ErrNotFound) {
 		return fmt.Errorf("alert not found or does not belong to your account")
 	}
-
-	return nil
+	return err
 }
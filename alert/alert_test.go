@@ -0,0 +1,381 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/portfolio"
+	"crypto-portfolio-tracker/watchlist"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockAPI struct {
+	prices map[string]float64
+}
+
+func (m *mockAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	p, ok := m.prices[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("simple/price", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return p, nil
+}
+
+func (m *mockAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	result := make(map[string]float64, len(coinIDs))
+	for _, id := range coinIDs {
+		if p, ok := m.prices[id]; ok {
+			result[id] = p
+		}
+	}
+	return result, nil
+}
+
+func (m *mockAPI) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	return map[string]string{"bitcoin": "Bitcoin", "ethereum": "Ethereum"}, nil
+}
+
+const testUser = "test@example.com"
+
+func newTestStore(t *testing.T) db.Store {
+	t.Helper()
+	store := db.NewMemoryStore()
+	err := portfolio.AddMultipleHoldings(context.Background(), store, testUser, models.Holding{
+		CoinID:   "bitcoin",
+		CoinName: "Bitcoin",
+		Quantity: 1,
+		BuyPrice: 30000,
+		AddedAt:  time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	return store
+}
+
+func TestCreateAlert_RequiresPortfolioCoin(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"ethereum": 3000}}
+
+	err := CreateAlert(context.Background(), store, testUser, "ethereum", "Ethereum", models.AlertTypeBuy, 2500, "usd", api)
+	var portfolioErr *customerrors.PortfolioError
+	if !errors.As(err, &portfolioErr) {
+		t.Fatalf("expected PortfolioError, got: %v", err)
+	}
+}
+
+func TestCreateAlert_RequiresCoin(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	for _, coinID := range []string{"", "   "} {
+		err := CreateAlert(ctx, store, testUser, coinID, "", models.AlertTypeBuy, 45000, "usd", api)
+		if !errors.Is(err, customerrors.ErrInvalidAlert) {
+			t.Errorf("coin %q: expected ErrInvalidAlert, got: %v", coinID, err)
+		}
+	}
+	if alerts, _ := store.Alerts().ListActive(ctx, testUser); len(alerts) != 0 {
+		t.Errorf("expected no alert to be stored, got %+v", alerts)
+	}
+}
+
+func TestCreateAlert_AllowsWatchedCoin(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"ethereum": 3000}}
+
+	if _, err := watchlist.AddCoin(ctx, store, api, testUser, "ethereum"); err != nil {
+		t.Fatalf("watching coin: %v", err)
+	}
+	if err := CreateAlert(ctx, store, testUser, "ethereum", "Ethereum", models.AlertTypeBuy, 2500, "usd", api); err != nil {
+		t.Fatalf("expected alert on watched coin, got: %v", err)
+	}
+}
+
+func TestCreateAlert_InvalidThreshold(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	err := CreateAlert(context.Background(), store, testUser, "bitcoin", "Bitcoin", models.AlertTypeBuy, 0, "usd", api)
+	if !errors.Is(err, customerrors.ErrInvalidPrice) {
+		t.Errorf("expected ErrInvalidPrice, got: %v", err)
+	}
+}
+
+func TestCheckAndTriggerAlerts_MarksTriggered(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	if err := CreateAlert(context.Background(), store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CreateAlert(context.Background(), store, testUser, "bitcoin", "Bitcoin", models.AlertTypeBuy, 40000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := CheckAndTriggerAlerts(context.Background(), store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	alerts, err := GetAlerts(context.Background(), store, testUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].AlertType != models.AlertTypeBuy {
+		t.Errorf("expected only the buy alert to remain active, got %+v", alerts)
+	}
+}
+
+func TestDeleteAlert_NotFound(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := DeleteAlert(context.Background(), store, testUser, "missing"); err == nil {
+		t.Error("expected error deleting unknown alert, got nil")
+	}
+}
+
+func TestPercentMoveAlert_FromCreationPrice(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	a, err := AddAlert(ctx, store, api, models.Alert{
+		UserEmail:     testUser,
+		CoinID:        "bitcoin",
+		CoinName:      "Bitcoin",
+		AlertType:     models.AlertTypePercentMove,
+		PercentChange: 8,
+		Currency:      "usd",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.ReferencePrice != 50000 || a.Direction != models.MoveEither || a.ReferenceSource != models.ReferenceCreation {
+		t.Fatalf("unexpected defaults: %+v", a)
+	}
+
+	api.prices["bitcoin"] = 47000 // -6%
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 1 {
+		t.Fatalf("expected alert to stay active at -6%%, got %d active", len(alerts))
+	}
+
+	api.prices["bitcoin"] = 45500 // -9%
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 0 {
+		t.Errorf("expected alert to fire at -9%%, got %d active", len(alerts))
+	}
+}
+
+func TestPercentMoveAlert_FromAverageBuyPrice(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	a, err := AddAlert(ctx, store, api, models.Alert{
+		UserEmail:       testUser,
+		CoinID:          "bitcoin",
+		CoinName:        "Bitcoin",
+		AlertType:       models.AlertTypePercentMove,
+		PercentChange:   50,
+		Direction:       models.MoveUp,
+		ReferenceSource: models.ReferenceAvgBuy,
+		Currency:        "usd",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if a.ReferencePrice != 30000 {
+		t.Fatalf("expected reference of 30000 from average buy price, got %v", a.ReferencePrice)
+	}
+
+	if !shouldTrigger(*a, 45000) || shouldTrigger(*a, 44000) {
+		t.Error("expected up-move alert to fire at +50% only")
+	}
+}
+
+func TestAlerts_RefuseCostInOtherCurrency(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t) // bitcoin bought in USD
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	_, err := AddAlert(ctx, store, api, models.Alert{
+		UserEmail:       testUser,
+		CoinID:          "bitcoin",
+		CoinName:        "Bitcoin",
+		AlertType:       models.AlertTypePercentMove,
+		PercentChange:   10,
+		ReferenceSource: models.ReferenceAvgBuy,
+		Currency:        "eur",
+	})
+	if !errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch for a EUR move from a USD buy price, got: %v", err)
+	}
+
+	_, err = AddAlert(ctx, store, api, models.Alert{
+		UserEmail:  testUser,
+		AlertType:  models.AlertTypePortfolioPL,
+		Comparator: models.ComparatorAbove,
+		Threshold:  1000,
+		Currency:   "eur",
+	})
+	if !errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch for a EUR P/L alert, got: %v", err)
+	}
+
+	a, err := AddAlert(ctx, store, api, models.Alert{
+		UserEmail:       testUser,
+		CoinID:          "bitcoin",
+		CoinName:        "Bitcoin",
+		AlertType:       models.AlertTypePercentMove,
+		PercentChange:   10,
+		ReferenceSource: models.ReferenceAvgBuy,
+		Currency:        "usd",
+	})
+	if err != nil || a.ReferenceCurrency != "usd" {
+		t.Fatalf("expected a USD reference, got %+v (%v)", a, err)
+	}
+	a.Currency = "eur"
+	if shouldTrigger(*a, 50000) {
+		t.Error("expected a reference in another currency never to fire")
+	}
+}
+
+func TestPercentMoveAlert_InvalidDirection(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	_, err := AddAlert(context.Background(), store, api, models.Alert{
+		UserEmail:     testUser,
+		CoinID:        "bitcoin",
+		AlertType:     models.AlertTypePercentMove,
+		PercentChange: 5,
+		Direction:     "sideways",
+		Currency:      "usd",
+	})
+	if !errors.Is(err, customerrors.ErrInvalidAlert) {
+		t.Errorf("expected ErrInvalidAlert, got: %v", err)
+	}
+}
+
+func TestTrailingStopAlert_RatchetsAndFires(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	if _, err := AddAlert(ctx, store, api, models.Alert{
+		UserEmail:    testUser,
+		CoinID:       "bitcoin",
+		CoinName:     "Bitcoin",
+		AlertType:    models.AlertTypeTrailingStop,
+		TrailPercent: 10,
+		Currency:     "usd",
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	api.prices["bitcoin"] = 60000
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	alerts, _ := GetAlerts(ctx, store, testUser)
+	if len(alerts) != 1 || alerts[0].HighWaterMark != 60000 || alerts[0].EffectiveStop() != 54000 {
+		t.Fatalf("expected high of 60000 and stop of 54000, got %+v", alerts)
+	}
+
+	// 55000 is above the ratcheted stop even though it is below the start.
+	api.prices["bitcoin"] = 55000
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 1 {
+		t.Fatalf("expected alert to stay active above the stop, got %d active", len(alerts))
+	}
+
+	api.prices["bitcoin"] = 53000
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 0 {
+		t.Errorf("expected trailing stop to fire below 54000, got %d active", len(alerts))
+	}
+}
+
+func TestTrailingStopAlert_RequiresOneTrail(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	_, err := AddAlert(context.Background(), store, api, models.Alert{
+		UserEmail:    testUser,
+		CoinID:       "bitcoin",
+		AlertType:    models.AlertTypeTrailingStop,
+		TrailPercent: 5,
+		TrailAmount:  1000,
+		Currency:     "usd",
+	})
+	if !errors.Is(err, customerrors.ErrInvalidAlert) {
+		t.Errorf("expected ErrInvalidAlert, got: %v", err)
+	}
+}
+
+func TestPortfolioAlerts_EvaluatedAlongsideCoinAlerts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := portfolio.AddMultipleHoldings(ctx, store, testUser, models.Holding{
+		CoinID: "ethereum", CoinName: "Ethereum", Quantity: 10, BuyPrice: 2000, AddedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	// 1 BTC at 50000 + 10 ETH at 1000 = 60000 total, P/L = 20000 - 10000 = +10000,
+	// bitcoin weight = 83.33%.
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 1000}}
+
+	reqs := []models.Alert{
+		{AlertType: models.AlertTypePortfolioValue, Comparator: models.ComparatorBelow, Threshold: 50000},
+		{AlertType: models.AlertTypePortfolioPL, Comparator: models.ComparatorAbove, Threshold: 5000},
+		{AlertType: models.AlertTypeCoinWeight, Comparator: models.ComparatorAbove, Threshold: 80, CoinID: "bitcoin", CoinName: "Bitcoin"},
+		{AlertType: models.AlertTypeSell, ThresholdPrice: 45000, CoinID: "bitcoin", CoinName: "Bitcoin"},
+	}
+	for _, r := range reqs {
+		r.UserEmail = testUser
+		r.Currency = "usd"
+		if _, err := AddAlert(ctx, store, api, r); err != nil {
+			t.Fatalf("creating %s alert: %v", r.AlertType, err)
+		}
+	}
+
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	alerts, err := GetAlerts(ctx, store, testUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].AlertType != models.AlertTypePortfolioValue {
+		t.Errorf("expected only the portfolio value alert to remain active, got %+v", alerts)
+	}
+}
+
+func TestPortfolioAlert_InvalidComparator(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	_, err := AddAlert(context.Background(), store, api, models.Alert{
+		UserEmail: testUser,
+		AlertType: models.AlertTypePortfolioValue,
+		Threshold: 1000,
+		Currency:  "usd",
+	})
+	if !errors.Is(err, customerrors.ErrInvalidAlert) {
+		t.Errorf("expected ErrInvalidAlert, got: %v", err)
+	}
+}
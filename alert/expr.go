@@ -0,0 +1,571 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression alerts fire when a small boolean expression over market data
+// and portfolio metrics holds, for example
+//
+//	price("ethereum") / price("bitcoin") < 0.05 && change24h("ethereum") < -5
+//
+// Numbers support + - * / and unary minus; comparisons (< <= > >= == !=)
+// produce booleans, which combine with && || and !. Parentheses group.
+
+// exprFunc describes a function callable from an expression.
+type exprFunc struct {
+	coinArg   bool // takes a single coin ID string argument
+	stat      bool // needs 24h market data, not just a price
+	portfolio bool // needs the user's portfolio
+}
+
+var exprFuncs = map[string]exprFunc{
+	"price":           {coinArg: true},
+	"change24h":       {coinArg: true, stat: true},
+	"volume24h":       {coinArg: true, stat: true},
+	"marketcap":       {coinArg: true, stat: true},
+	"portfolio_value": {portfolio: true},
+	"portfolio_pl":    {portfolio: true},
+	"weight":          {coinArg: true, portfolio: true},
+}
+
+// exprSyntaxError reports a parse failure at a 1-based column.
+type exprSyntaxError struct {
+	Col int
+	Msg string
+}
+
+func (e *exprSyntaxError) Error() string {
+	return fmt.Sprintf("%s: column %d: %s", customerrors.ErrInvalidAlert, e.Col, e.Msg)
+}
+
+func (e *exprSyntaxError) Unwrap() error {
+	return customerrors.ErrInvalidAlert
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	col  int
+}
+
+func lexExpression(src string) ([]token, error) {
+	var toks []token
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(string(runes[i:j]), 64)
+			if err != nil {
+				return nil, &exprSyntaxError{col, fmt.Sprintf("bad number %q", string(runes[i:j]))}
+			}
+			toks = append(toks, token{kind: tokNumber, text: string(runes[i:j]), num: n, col: col})
+			i = j
+
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if j == len(runes) {
+				return nil, &exprSyntaxError{col, "unterminated string"}
+			}
+			toks = append(toks, token{kind: tokString, text: string(runes[i+1 : j]), col: col})
+			i = j + 1
+
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: string(runes[i:j]), col: col})
+			i = j
+
+		default:
+			op := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "&&", "||", "<=", ">=", "==", "!=":
+					op = two
+				}
+			}
+			if len(op) == 1 && !strings.ContainsRune("+-*/()<>!,", r) {
+				return nil, &exprSyntaxError{col, fmt.Sprintf("unexpected character %q", r)}
+			}
+			toks = append(toks, token{kind: tokOp, text: op, col: col})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, col: len(runes) + 1}), nil
+}
+
+type exprType int
+
+const (
+	typeNumber exprType = iota
+	typeBool
+)
+
+func (t exprType) String() string {
+	if t == typeBool {
+		return "true/false"
+	}
+	return "number"
+}
+
+// exprEnv is the data an expression is evaluated against. Prices and stats
+// are quoted in the alert currency; stats is nil when the price provider
+// cannot report 24h market data.
+type exprEnv struct {
+	ctx       context.Context
+	currency  string
+	prices    map[string]float64
+	stats     map[string]api.MarketData
+	portfolio *models.Portfolio
+}
+
+// exprNode is a typed expression tree node. Booleans evaluate to 1 or 0.
+type exprNode interface {
+	typ() exprType
+	eval(env *exprEnv) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) typ() exprType                  { return typeNumber }
+func (n numberNode) eval(*exprEnv) (float64, error) { return float64(n), nil }
+
+type callNode struct {
+	fn   string
+	coin string
+}
+
+func (c callNode) typ() exprType { return typeNumber }
+
+func (c callNode) eval(env *exprEnv) (float64, error) {
+	switch c.fn {
+	case "price":
+		p, ok := env.prices[c.coin]
+		if !ok {
+			return 0, fmt.Errorf("no price available for coin %q", c.coin)
+		}
+		return p, nil
+
+	case "change24h", "volume24h", "marketcap":
+		if env.stats == nil {
+			return 0, fmt.Errorf("%s: the price provider does not report 24h market data", c.fn)
+		}
+		d, ok := env.stats[c.coin]
+		if !ok {
+			return 0, fmt.Errorf("no market data available for coin %q", c.coin)
+		}
+		switch c.fn {
+		case "change24h":
+			return d.Change24h, nil
+		case "volume24h":
+			return d.Volume24h, nil
+		default:
+			return d.MarketCap, nil
+		}
+	}
+
+	if env.portfolio == nil {
+		return 0, fmt.Errorf("%s: portfolio not available", c.fn)
+	}
+	metric := models.Alert{CoinID: c.coin, Currency: env.currency}
+	switch c.fn {
+	case "portfolio_value":
+		metric.AlertType = models.AlertTypePortfolioValue
+	case "portfolio_pl":
+		metric.AlertType = models.AlertTypePortfolioPL
+	default:
+		metric.AlertType = models.AlertTypeCoinWeight
+	}
+	return portfolioMetric(env.ctx, metric, env.portfolio, env.prices)
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (u unaryNode) typ() exprType {
+	if u.op == "!" {
+		return typeBool
+	}
+	return typeNumber
+}
+
+func (u unaryNode) eval(env *exprEnv) (float64, error) {
+	v, err := u.x.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if u.op == "!" {
+		return boolValue(v == 0), nil
+	}
+	return -v, nil
+}
+
+type binaryNode struct {
+	op   string
+	col  int
+	l, r exprNode
+}
+
+func (b binaryNode) typ() exprType {
+	switch b.op {
+	case "+", "-", "*", "/":
+		return typeNumber
+	}
+	return typeBool
+}
+
+func (b binaryNode) eval(env *exprEnv) (float64, error) {
+	l, err := b.l.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	// && and || short-circuit so a guard can protect the other side.
+	if (b.op == "&&" && l == 0) || (b.op == "||" && l != 0) {
+		return l, nil
+	}
+	r, err := b.r.eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero at column %d", b.col)
+		}
+		return l / r, nil
+	case "<":
+		return boolValue(l < r), nil
+	case "<=":
+		return boolValue(l <= r), nil
+	case ">":
+		return boolValue(l > r), nil
+	case ">=":
+		return boolValue(l >= r), nil
+	case "==":
+		return boolValue(l == r), nil
+	case "!=":
+		return boolValue(l != r), nil
+	default: // && and ||, the left side did not decide
+		return boolValue(r != 0), nil
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// expression is a parsed, type-checked alert condition along with what it
+// needs fetched to be evaluated.
+type expression struct {
+	root      exprNode
+	coins     []string // coins whose price is referenced
+	statCoins []string // coins whose 24h market data is referenced
+	portfolio bool
+}
+
+func (e *expression) eval(env *exprEnv) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+type exprParser struct {
+	toks      []token
+	pos       int
+	expr      *expression
+	seenCoins map[string]bool
+	seenStats map[string]bool
+}
+
+// parseExpression parses src into a condition that must evaluate to true or
+// false. Syntax and type errors are reported with their column.
+func parseExpression(src string) (*expression, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, &exprSyntaxError{1, "expression is empty"}
+	}
+	toks, err := lexExpression(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{
+		toks:      toks,
+		expr:      &expression{},
+		seenCoins: make(map[string]bool),
+		seenStats: make(map[string]bool),
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &exprSyntaxError{t.col, fmt.Sprintf("unexpected %q", t.text)}
+	}
+	if root.typ() != typeBool {
+		return nil, &exprSyntaxError{1, "expression must be a comparison, e.g. price(\"bitcoin\") > 50000"}
+	}
+
+	p.expr.root = root
+	sort.Strings(p.expr.coins)
+	sort.Strings(p.expr.statCoins)
+	return p.expr, nil
+}
+
+func (p *exprParser) peek() token { return p.toks[p.pos] }
+
+func (p *exprParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) acceptOp(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.next(), true
+		}
+	}
+	return t, false
+}
+
+func (p *exprParser) expectOp(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return &exprSyntaxError{t.col, fmt.Sprintf("expected %q at end of expression", op)}
+		}
+		return &exprSyntaxError{t.col, fmt.Sprintf("expected %q, found %q", op, t.text)}
+	}
+	return nil
+}
+
+func requireType(t token, n exprNode, want exprType) error {
+	if n.typ() != want {
+		return &exprSyntaxError{t.col, fmt.Sprintf("%q needs %s operands, got %s", t.text, want, n.typ())}
+	}
+	return nil
+}
+
+func (p *exprParser) parseBinary(sub func() (exprNode, error), operand exprType, ops ...string) (exprNode, error) {
+	left, err := sub()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.acceptOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := sub()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireType(t, left, operand); err != nil {
+			return nil, err
+		}
+		if err := requireType(t, right, operand); err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: t.text, col: t.col, l: left, r: right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, typeBool, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseNot, typeBool, "&&")
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if t, ok := p.acceptOp("!"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireType(t, x, typeBool); err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "!", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.acceptOp("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if err := requireType(t, left, typeNumber); err != nil {
+		return nil, err
+	}
+	if err := requireType(t, right, typeNumber); err != nil {
+		return nil, err
+	}
+	if next, chained := p.acceptOp("<", "<=", ">", ">=", "==", "!="); chained {
+		return nil, &exprSyntaxError{next.col, "comparisons cannot be chained, combine them with &&"}
+	}
+	return binaryNode{op: t.text, col: t.col, l: left, r: right}, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	return p.parseBinary(p.parseProduct, typeNumber, "+", "-")
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, typeNumber, "*", "/")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if t, ok := p.acceptOp("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := requireType(t, x, typeNumber); err != nil {
+			return nil, err
+		}
+		return unaryNode{op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return numberNode(t.num), nil
+
+	case tokIdent:
+		return p.parseCall(t)
+
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+
+	case tokString:
+		return nil, &exprSyntaxError{t.col, fmt.Sprintf("unexpected string %q, coin IDs go inside a function such as price(%q)", t.text, t.text)}
+
+	case tokEOF:
+		return nil, &exprSyntaxError{t.col, "unexpected end of expression"}
+	}
+	return nil, &exprSyntaxError{t.col, fmt.Sprintf("unexpected %q", t.text)}
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, &exprSyntaxError{name.col, fmt.Sprintf("unknown function %q (available: %s)", name.text, exprFuncNames())}
+	}
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+
+	call := callNode{fn: name.text}
+	if fn.coinArg {
+		arg := p.next()
+		if arg.kind != tokString {
+			return nil, &exprSyntaxError{arg.col, fmt.Sprintf("%s expects a coin ID in quotes, e.g. %s(\"bitcoin\")", name.text, name.text)}
+		}
+		call.coin = strings.ToLower(strings.TrimSpace(arg.text))
+		if call.coin == "" {
+			return nil, &exprSyntaxError{arg.col, "coin ID is empty"}
+		}
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+
+	e := p.expr
+	if fn.portfolio {
+		e.portfolio = true
+	}
+	if fn.coinArg && !fn.portfolio && !p.seenCoins[call.coin] {
+		p.seenCoins[call.coin] = true
+		e.coins = append(e.coins, call.coin)
+	}
+	if fn.stat && !p.seenStats[call.coin] {
+		p.seenStats[call.coin] = true
+		e.statCoins = append(e.statCoins, call.coin)
+	}
+	return call, nil
+}
+
+func exprFuncNames() string {
+	names := make([]string, 0, len(exprFuncs))
+	for name := range exprFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,151 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type marketMockAPI struct {
+	mockAPI
+	stats map[string]api.MarketData
+}
+
+func (m *marketMockAPI) FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]api.MarketData, error) {
+	result := make(map[string]api.MarketData, len(coinIDs))
+	for _, id := range coinIDs {
+		if d, ok := m.stats[id]; ok {
+			result[id] = d
+		}
+	}
+	return result, nil
+}
+
+func TestParseExpression_Errors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{``, "empty"},
+		{`price("bitcoin") >`, "unexpected end"},
+		{`price("bitcoin") > 5 &&`, "unexpected end"},
+		{`price("bitcoin")`, "must be a comparison"},
+		{`price(bitcoin) > 1`, "coin ID in quotes"},
+		{`cost("bitcoin") > 1`, `unknown function "cost"`},
+		{`price("bitcoin") > 1 && 5`, `"&&" needs true/false operands`},
+		{`(price("bitcoin") > 1) + 2 > 0`, `"+" needs number operands`},
+		{`1 < price("bitcoin") < 5`, "cannot be chained"},
+		{`price("bitcoin") > 1 # 2`, "column 22"},
+		{`price("bitcoin" > 1`, `expected ")"`},
+	}
+	for _, tt := range tests {
+		_, err := parseExpression(tt.src)
+		if !errors.Is(err, customerrors.ErrInvalidAlert) {
+			t.Errorf("parseExpression(%q): expected ErrInvalidAlert, got %v", tt.src, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseExpression(%q) = %q, want it to mention %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestExpressionEval(t *testing.T) {
+	env := &exprEnv{
+		ctx:      context.Background(),
+		currency: "usd",
+		prices:   map[string]float64{"bitcoin": 50000, "ethereum": 2000},
+		stats:    map[string]api.MarketData{"ethereum": {Change24h: -7}},
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`price("ethereum") / price("bitcoin") < 0.05 && change24h("ethereum") < -5`, true},
+		{`price("ethereum") / price("bitcoin") < 0.03 || change24h("ethereum") > 0`, false},
+		{`!(price("bitcoin") >= 50000)`, false},
+		{`-price("ethereum") * 2 + 1 == -3999`, true},
+		{`price("Bitcoin") - 2 * (price("ethereum") + 1000) > 43000`, true},
+	}
+	for _, tt := range tests {
+		e, err := parseExpression(tt.src)
+		if err != nil {
+			t.Fatalf("parseExpression(%q): %v", tt.src, err)
+		}
+		got, err := e.eval(env)
+		if err != nil {
+			t.Fatalf("eval(%q): %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestAddAlert_ExpressionValidation(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	prices := mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000}}
+	market := &marketMockAPI{mockAPI: prices, stats: map[string]api.MarketData{"ethereum": {Price: 2000, Change24h: -2}}}
+
+	tests := []struct {
+		name string
+		api  api.CryptoApi
+		expr string
+		want string
+	}{
+		{"unknown coin", market, `price("notacoin") > 1`, `unknown coin "notacoin"`},
+		{"unknown coin stats", market, `change24h("bitcoin") < -5`, `unknown coin "bitcoin"`},
+		{"no market data", &prices, `change24h("ethereum") < -5`, "does not report 24h"},
+		{"syntax", market, `price("bitcoin") >> 1`, "column 19"},
+	}
+	for _, tt := range tests {
+		_, err := AddAlert(ctx, store, tt.api, models.Alert{
+			UserEmail:  testUser,
+			AlertType:  models.AlertTypeExpression,
+			Expression: tt.expr,
+			Currency:   "usd",
+		})
+		if !errors.Is(err, customerrors.ErrInvalidAlert) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected ErrInvalidAlert mentioning %q, got: %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestCheckAndTriggerAlerts_Expression(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	market := &marketMockAPI{
+		mockAPI: mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000}},
+		stats:   map[string]api.MarketData{"ethereum": {Price: 2000, Change24h: -2}},
+	}
+
+	_, err := AddAlert(ctx, store, market, models.Alert{
+		UserEmail:  testUser,
+		AlertType:  models.AlertTypeExpression,
+		Expression: `price("ethereum") / price("bitcoin") < 0.05 && change24h("ethereum") < -5 && weight("bitcoin") > 99`,
+		Currency:   "usd",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, market); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 1 {
+		t.Fatalf("expected alert to stay active while ETH is only down 2%%, got %d", len(alerts))
+	}
+
+	market.stats["ethereum"] = api.MarketData{Price: 2000, Change24h: -6}
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, market); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 0 {
+		t.Errorf("expected expression alert to trigger, got %+v", alerts)
+	}
+}
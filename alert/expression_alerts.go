@@ -0,0 +1,161 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/portfolio"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// validateExpressionAlert parses a's expression and evaluates it once against
+// live data, so syntax errors, unknown coins and missing market data are
+// reported at creation rather than on every check.
+func validateExpressionAlert(ctx context.Context, store db.Store, apiClient api.CryptoApi, a *models.Alert) error {
+	a.Expression = strings.TrimSpace(a.Expression)
+	e, err := parseExpression(a.Expression)
+	if err != nil {
+		return customerrors.NewValidationError("expression", a.Expression, err)
+	}
+	a.CoinID = ""
+	a.CoinName = "Custom condition"
+
+	env := &exprEnv{ctx: ctx, currency: a.Currency, prices: map[string]float64{}}
+	coins := e.coins
+	if e.portfolio {
+		p, err := portfolio.GetPortfolio(ctx, store, a.UserEmail)
+		if err != nil {
+			return fmt.Errorf("could not load portfolio: %w", err)
+		}
+		env.portfolio = p
+		for _, h := range p.Holdings {
+			coins = append(coins, h.CoinID)
+		}
+	}
+
+	if len(coins) > 0 {
+		prices, err := apiClient.FetchMultiplePrices(ctx, a.Currency, coins...)
+		if err != nil {
+			return fmt.Errorf("could not fetch prices for expression: %w", err)
+		}
+		env.prices = prices
+	}
+	for _, id := range e.coins {
+		if _, ok := env.prices[id]; !ok {
+			return customerrors.NewValidationError("expression", a.Expression,
+				fmt.Errorf("%w: unknown coin %q", customerrors.ErrInvalidAlert, id))
+		}
+	}
+
+	if len(e.statCoins) > 0 {
+		md, ok := apiClient.(api.MarketDataApi)
+		if !ok {
+			return customerrors.NewValidationError("expression", a.Expression,
+				fmt.Errorf("%w: the price provider does not report 24h change, volume or market cap", customerrors.ErrInvalidAlert))
+		}
+		stats, err := md.FetchMarketData(ctx, a.Currency, e.statCoins...)
+		if err != nil {
+			return fmt.Errorf("could not fetch market data for expression: %w", err)
+		}
+		for _, id := range e.statCoins {
+			if _, ok := stats[id]; !ok {
+				return customerrors.NewValidationError("expression", a.Expression,
+					fmt.Errorf("%w: unknown coin %q", customerrors.ErrInvalidAlert, id))
+			}
+		}
+		env.stats = stats
+	}
+
+	if _, err := e.eval(env); err != nil {
+		return customerrors.NewValidationError("expression", a.Expression, fmt.Errorf("%w: %v", customerrors.ErrInvalidAlert, err))
+	}
+	return nil
+}
+
+// alertExpression returns the parsed condition of an expression alert, or
+// nil for any other alert.
+func alertExpression(a models.Alert) (*expression, error) {
+	if a.AlertType != models.AlertTypeExpression {
+		return nil, nil
+	}
+	return parseExpression(a.Expression)
+}
+
+// needsPortfolio reports whether evaluating a requires its owner's portfolio.
+func needsPortfolio(a models.Alert) bool {
+	if a.AlertType.IsPortfolioLevel() {
+		return true
+	}
+	e, err := alertExpression(a)
+	return err == nil && e != nil && e.portfolio
+}
+
+// fetchAlertStats looks up 24h market data for every coin whose statistics an
+// expression alert references, batched per quote currency like prices. It
+// returns nil when the provider cannot report market data.
+func fetchAlertStats(ctx context.Context, apiClient api.CryptoApi, alerts []models.Alert) (map[string]map[string]api.MarketData, error) {
+	md, ok := apiClient.(api.MarketDataApi)
+	if !ok {
+		return nil, nil
+	}
+
+	coinsByCurrency := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, a := range alerts {
+		e, err := alertExpression(a)
+		if err != nil || e == nil {
+			continue
+		}
+		quote := currency.OrDefault(a.Currency)
+		for _, id := range e.statCoins {
+			if key := quote + "/" + id; !seen[key] {
+				coinsByCurrency[quote] = append(coinsByCurrency[quote], id)
+				seen[key] = true
+			}
+		}
+	}
+
+	stats := make(map[string]map[string]api.MarketData, len(coinsByCurrency))
+	var errs []error
+	for quote, coinIDs := range coinsByCurrency {
+		stats[quote] = make(map[string]api.MarketData, len(coinIDs))
+		for start := 0; start < len(coinIDs); start += maxPriceBatch {
+			end := min(start+maxPriceBatch, len(coinIDs))
+			data, err := md.FetchMarketData(ctx, quote, coinIDs[start:end]...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not fetch %s market data for alert check: %w", quote, err))
+				continue
+			}
+			for id, d := range data {
+				stats[quote][id] = d
+			}
+		}
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// expressionValue evaluates an expression alert, returning 1 when its
+// condition holds and 0 otherwise so it can be stepped like a price.
+func expressionValue(ctx context.Context, a models.Alert, p *models.Portfolio, prices map[string]float64, stats map[string]api.MarketData) (float64, error) {
+	e, err := parseExpression(a.Expression)
+	if err != nil {
+		return 0, err
+	}
+	ok, err := e.eval(&exprEnv{
+		ctx:       ctx,
+		currency:  a.Currency,
+		prices:    prices,
+		stats:     stats,
+		portfolio: p,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return boolValue(ok), nil
+}
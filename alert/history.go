@@ -0,0 +1,194 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/email"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/notify"
+	"crypto-portfolio-tracker/outbox"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// prepareNotifications splits the owner's notification channels for a firing
+// alert. Email is rendered into outbox messages, to be stored atomically with
+// the alert update so a transient SMTP failure cannot lose it.
+func prepareNotifications(ctx context.Context, store db.Store, f *firedAlert) {
+	a := f.alert
+	f.firedAt = firedTime(a)
+	u, err := store.Users().FindByEmail(ctx, a.UserEmail)
+	if err != nil && !errors.Is(err, customerrors.ErrNotFound) {
+		fmt.Printf("  Warning: could not load preferences for %s, using defaults: %v\n", a.UserEmail, err)
+		u = nil
+	}
+	notifiers, err := userNotifiers(store, u)
+	if err != nil {
+		fmt.Printf("  Warning: %v; falling back to email for %s\n", err, a.UserEmail)
+	}
+
+	// Alert email is stored with the alert update rather than queued by the
+	// notifier, so whatever notifier stands for the email channel is only
+	// used to select it.
+	subject, body := alertMessage(a, f.price)
+	for _, n := range notifiers {
+		if n.Name() != string(models.ChannelEmail) {
+			f.notifiers = append(f.notifiers, n)
+			continue
+		}
+
+		content, err := email.RenderAlert(u.EmailTemplate(models.TemplateAlert), email.AlertData{
+			CoinID:    a.CoinID,
+			CoinName:  a.CoinName,
+			AlertType: a.AlertType,
+			Condition: Describe(a),
+			Observed:  observedValue(a, f.price),
+			Currency:  currency.OrDefault(a.Currency),
+			FiredAt:   f.firedAt,
+			Subject:   subject,
+			Message:   body,
+		})
+		if err != nil {
+			fmt.Printf("  Warning: alert email template for %s failed, sending plain text: %v\n", a.UserEmail, err)
+			content = email.Content{Subject: subject, Text: body}
+		}
+		m := outbox.NewMessage(models.OutboxAlert, a.UserEmail, content)
+		m.AlertEventID = primitive.NewObjectID().Hex()
+		f.mail = append(f.mail, m)
+		f.events = append(f.events, newAlertEvent(a, f.price, f.firedAt, m.AlertEventID, n.Name(), models.DeliveryQueued))
+	}
+}
+
+// newAlertEvent records a firing of a at price over channel.
+func newAlertEvent(a models.Alert, price float64, firedAt time.Time, id, channel string, delivery models.DeliveryStatus) models.AlertEvent {
+	return models.AlertEvent{
+		ID:            id,
+		AlertID:       a.ID,
+		UserEmail:     a.UserEmail,
+		CoinID:        a.CoinID,
+		CoinName:      a.CoinName,
+		AlertType:     a.AlertType,
+		Condition:     Describe(a),
+		FiredAt:       firedAt,
+		ObservedValue: price,
+		Currency:      currency.OrDefault(a.Currency),
+		Channel:       channel,
+		Delivery:      delivery,
+	}
+}
+
+func firedTime(a models.Alert) time.Time {
+	if a.TriggeredAt.IsZero() {
+		return time.Now()
+	}
+	return a.TriggeredAt
+}
+
+// notifyFired delivers a fired alert over each of its owner's notification
+// channels and records every attempt in the alert history. Queued email,
+// whose history entry was stored with the alert update, is tried once
+// straight away; the outbox settles that entry.
+func notifyFired(ctx context.Context, store db.Store, f firedAlert) {
+	a := f.alert
+
+	subject, body := alertMessage(a, f.price)
+	msg := notify.Message{
+		AlertID:   a.ID,
+		UserEmail: a.UserEmail,
+		CoinID:    a.CoinID,
+		CoinName:  a.CoinName,
+		AlertType: a.AlertType,
+		Condition: Describe(a),
+		Value:     f.price,
+		Currency:  currency.OrDefault(a.Currency),
+		FiredAt:   f.firedAt,
+		Subject:   subject,
+		Body:      body,
+	}
+	ids := make([]string, 0, len(f.mail))
+	for _, m := range f.mail {
+		ids = append(ids, m.ID)
+	}
+	if err := outbox.Deliver(ctx, store, ids...); err != nil {
+		fmt.Printf("  Warning: alert email to %s failed and will be retried: %v\n", a.UserEmail, err)
+	}
+
+	for _, n := range f.notifiers {
+		event := newAlertEvent(a, f.price, f.firedAt, primitive.NewObjectID().Hex(), n.Name(), models.DeliverySent)
+		if err := n.Notify(ctx, msg); err != nil {
+			fmt.Printf("  Warning: %s notification for %s failed: %v\n", n.Name(), a.UserEmail, err)
+			event.Delivery = models.DeliveryFailed
+			event.DeliveryError = err.Error()
+		}
+		if err := store.AlertEvents().Insert(ctx, &event); err != nil {
+			fmt.Printf("  Warning: could not record alert history for %s: %v\n", a.ID, err)
+		}
+	}
+}
+
+// userNotifiers resolves the user's channel preferences, where u may be nil.
+// It always returns usable notifiers, falling back to the defaults when the
+// preferences are invalid.
+func userNotifiers(store db.Store, u *models.User) ([]notify.Notifier, error) {
+	notifiers, err := notify.ForUser(store, u)
+	if err != nil {
+		fallback, _ := notify.ForUser(store, nil)
+		return fallback, fmt.Errorf("invalid notification channel: %w", err)
+	}
+	return notifiers, nil
+}
+
+func GetAlertHistory(ctx context.Context, store db.Store, userEmail string, f db.AlertEventFilter) ([]models.AlertEvent, error) {
+	return store.AlertEvents().List(ctx, userEmail, f)
+}
+
+func DisplayAlertHistory(ctx context.Context, store db.Store, userEmail string, f db.AlertEventFilter) error {
+	events, err := GetAlertHistory(ctx, store, userEmail, f)
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No alert firings match your filter.")
+		return nil
+	}
+
+	fmt.Println("\n========== ALERT HISTORY ==========")
+	for i, e := range events {
+		if e.CoinID == "" {
+			fmt.Printf("\n[%d] %s\n", i+1, e.CoinName)
+		} else {
+			fmt.Printf("\n[%d] %s (%s)\n", i+1, e.CoinName, e.CoinID)
+		}
+		fmt.Printf("    Fired     : %s\n", e.FiredAt.Format("02 Jan 2006, 15:04 UTC"))
+		fmt.Printf("    Condition : %s\n", e.Condition)
+		fmt.Printf("    Observed  : %s\n", ObservedLabel(e))
+		if e.Delivery == models.DeliveryFailed {
+			fmt.Printf("    Delivery  : %s FAILED (%s)\n", e.Channel, e.DeliveryError)
+		} else {
+			fmt.Printf("    Delivery  : %s %s\n", e.Channel, e.Delivery)
+		}
+		fmt.Printf("    Alert ID  : %s\n", e.AlertID)
+	}
+	fmt.Printf("\n%d firing(s)\n", len(events))
+	fmt.Println("===================================")
+
+	return nil
+}
+
+// ObservedLabel formats the value that fired e, e.g. "$45100.00".
+func ObservedLabel(e models.AlertEvent) string {
+	return observedValue(models.Alert{AlertType: e.AlertType, Currency: e.Currency}, e.ObservedValue)
+}
+
+func observedValue(a models.Alert, v float64) string {
+	if a.AlertType == models.AlertTypeExpression {
+		return "condition met"
+	}
+	return formatMetric(a, v)
+}
@@ -0,0 +1,157 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/email/emailtest"
+	"crypto-portfolio-tracker/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckAndTriggerAlerts_RecordsHistory(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+	srv := emailtest.NewServer(t)
+	srv.Install(t)
+
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 60000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events, err := GetAlertHistory(ctx, store, testUser, db.AlertEventFilter{CoinID: "bitcoin"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one recorded firing, got %+v", events)
+	}
+	e := events[0]
+	if e.AlertID == "" || e.ObservedValue != 50000 || e.Channel != "email" || e.FiredAt.IsZero() {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	if e.Delivery != models.DeliverySent || e.DeliveryError != "" {
+		t.Errorf("expected successful delivery to be recorded, got %+v", e)
+	}
+	if msgs := srv.Messages(); len(msgs) != 1 || msgs[0].To[0] != testUser || !strings.Contains(msgs[0].Subject, "Bitcoin") {
+		t.Errorf("expected one alert email to %s, got %+v", testUser, msgs)
+	}
+
+	srv.Close()
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 46000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, _ = GetAlertHistory(ctx, store, testUser, db.AlertEventFilter{})
+	if len(events) != 2 || events[0].Delivery != models.DeliveryQueued {
+		t.Errorf("expected the undelivered email to stay queued, got %+v", events)
+	}
+	pending, err := store.Outbox().List(ctx, db.OutboxFilter{Statuses: []models.OutboxStatus{models.OutboxPending}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pending) != 1 || pending[0].AlertEventID != events[0].ID || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Errorf("expected the failed email to wait in the outbox for a retry, got %+v", pending)
+	}
+
+	for _, f := range []db.AlertEventFilter{
+		{CoinID: "ethereum"},
+		{From: time.Now().Add(time.Hour)},
+		{To: time.Now().Add(-time.Hour)},
+	} {
+		events, err := GetAlertHistory(ctx, store, testUser, f)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("filter %+v: expected no events, got %d", f, len(events))
+		}
+	}
+}
+
+func TestNotifyFired_UsesUserChannels(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+	logPath := filepath.Join(t.TempDir(), "alerts.log")
+
+	err := store.Users().Create(ctx, &models.User{
+		Email:    testUser,
+		Channels: []models.NotificationChannel{{Kind: models.ChannelFile, Path: logPath}},
+	})
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events, err := GetAlertHistory(ctx, store, testUser, db.AlertEventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 1 || events[0].Channel != "file" || events[0].Delivery != models.DeliverySent {
+		t.Fatalf("expected one delivered file event, got %+v", events)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("reading log: %v", err)
+	}
+	if !strings.Contains(string(data), events[0].AlertID) {
+		t.Errorf("expected log to mention alert %s, got %q", events[0].AlertID, data)
+	}
+}
+
+func TestNotifyFired_UsesUserTemplate(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+	srv := emailtest.NewServer(t)
+	srv.Install(t)
+
+	err := store.Users().Create(ctx, &models.User{
+		Email: testUser,
+		EmailTemplates: []models.EmailTemplate{{
+			Kind:    models.TemplateAlert,
+			Subject: "{{upper .CoinName}} at {{.Observed}}",
+			Text:    "{{.Condition}}",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected one email, got %d", len(msgs))
+	}
+	m := msgs[0]
+	if m.Subject != "BITCOIN at $50000.00" || strings.TrimSpace(m.Text) != "SELL at $45000.00" {
+		t.Errorf("expected the user's template, got %q / %q", m.Subject, m.Text)
+	}
+	if !strings.Contains(m.HTML, "Bitcoin (bitcoin)") {
+		t.Errorf("expected the built-in HTML part, got %q", m.HTML)
+	}
+}
@@ -0,0 +1,145 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/portfolio"
+	"fmt"
+	"strings"
+)
+
+func validatePortfolioAlert(a *models.Alert) error {
+	if !a.Comparator.Valid() {
+		return customerrors.NewValidationError("comparator", a.Comparator, customerrors.ErrInvalidAlert)
+	}
+
+	switch a.AlertType {
+	case models.AlertTypePortfolioValue:
+		if a.Threshold <= 0 {
+			return customerrors.NewValidationError("threshold", a.Threshold, customerrors.ErrInvalidAlert)
+		}
+	case models.AlertTypeCoinWeight:
+		if a.Threshold <= 0 || a.Threshold > 100 {
+			return customerrors.NewValidationError("threshold", a.Threshold, customerrors.ErrInvalidAlert)
+		}
+		if a.CoinID == "" {
+			return customerrors.NewValidationError("coin_id", a.CoinID, customerrors.ErrInvalidAlert)
+		}
+	}
+
+	if a.AlertType != models.AlertTypeCoinWeight {
+		a.CoinID = ""
+		a.CoinName = "Portfolio"
+	}
+	return nil
+}
+
+// checkCostCurrency refuses a P&L alert in another currency than the one
+// the user's holdings were bought in, as their gains could not be compared.
+func checkCostCurrency(ctx context.Context, store db.Store, a models.Alert) error {
+	p, err := portfolio.GetPortfolio(ctx, store, a.UserEmail)
+	if err != nil {
+		return err
+	}
+	for _, h := range p.Holdings {
+		if !currency.Equal(h.Currency, a.Currency) {
+			return customerrors.NewValidationError("currency", a.Currency, fmt.Errorf(
+				"%w: %s was bought in %s", customerrors.ErrCurrencyMismatch, h.CoinID, strings.ToUpper(currency.OrDefault(h.Currency)),
+			))
+		}
+	}
+	return nil
+}
+
+// loadAlertPortfolios fetches the portfolio of every user that owns a
+// portfolio-level alert or an expression using portfolio metrics.
+func loadAlertPortfolios(ctx context.Context, store db.Store, alerts []models.Alert) (map[string]*models.Portfolio, error) {
+	portfolios := make(map[string]*models.Portfolio)
+	for _, a := range alerts {
+		if !needsPortfolio(a) {
+			continue
+		}
+		if _, ok := portfolios[a.UserEmail]; ok {
+			continue
+		}
+		p, err := portfolio.GetPortfolio(ctx, store, a.UserEmail)
+		if err != nil {
+			return nil, err
+		}
+		portfolios[a.UserEmail] = p
+	}
+	return portfolios, nil
+}
+
+// portfolioMetric computes the aggregate an alert watches from prices that
+// were fetched in the alert currency.
+func portfolioMetric(ctx context.Context, a models.Alert, p *models.Portfolio, prices map[string]float64) (float64, error) {
+	if len(p.Holdings) == 0 {
+		return 0, customerrors.ErrEmptyPortfolio
+	}
+	quotes := api.StaticPrices(prices)
+
+	switch a.AlertType {
+	case models.AlertTypePortfolioValue:
+		return portfolio.CalculateTotalValue(ctx, p, quotes, a.Currency)
+
+	case models.AlertTypePortfolioPL:
+		pl, err := portfolio.CalculateProfitLoss(ctx, p, quotes, a.Currency)
+		if err != nil {
+			return 0, err
+		}
+		var total float64
+		for _, v := range pl {
+			total += v
+		}
+		return total, nil
+
+	case models.AlertTypeCoinWeight:
+		total, err := portfolio.CalculateTotalValue(ctx, p, quotes, a.Currency)
+		if err != nil {
+			return 0, err
+		}
+		if total <= 0 {
+			return 0, customerrors.ErrEmptyPortfolio
+		}
+		var coin models.Portfolio
+		for _, h := range p.Holdings {
+			if h.CoinID == a.CoinID {
+				coin.Holdings = append(coin.Holdings, h)
+			}
+		}
+		value, err := portfolio.CalculateTotalValue(ctx, &coin, quotes, a.Currency)
+		if err != nil {
+			return 0, err
+		}
+		return value / total * 100, nil
+	}
+
+	return 0, fmt.Errorf("%w: %s is not a portfolio alert", customerrors.ErrInvalidAlert, a.AlertType)
+}
+
+func metricLabel(a models.Alert) string {
+	switch a.AlertType {
+	case models.AlertTypePortfolioValue:
+		return "portfolio value"
+	case models.AlertTypePortfolioPL:
+		return "portfolio P/L"
+	default:
+		return strings.ToLower(a.CoinName) + " weight"
+	}
+}
+
+func formatMetric(a models.Alert, v float64) string {
+	switch a.AlertType {
+	case models.AlertTypeCoinWeight:
+		return fmt.Sprintf("%.2f%%", v)
+	case models.AlertTypePortfolioPL:
+		return currency.FormatSigned(v, a.Currency)
+	default:
+		return currency.Format(v, a.Currency)
+	}
+}
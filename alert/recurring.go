@@ -0,0 +1,87 @@
+package alert
+
+import (
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"time"
+)
+
+func validateSchedule(a *models.Alert, now time.Time) error {
+	if !a.ExpiresAt.IsZero() && !a.ExpiresAt.After(now) {
+		return customerrors.NewValidationError("expires_at", a.ExpiresAt, customerrors.ErrInvalidAlert)
+	}
+	if !a.Recurring {
+		if a.RearmPercent != 0 || a.Cooldown != 0 || a.MaxFirings != 0 {
+			return customerrors.NewValidationError("recurring", false, customerrors.ErrInvalidAlert)
+		}
+		return nil
+	}
+	if a.RearmPercent < 0 || a.RearmPercent >= 100 {
+		return customerrors.NewValidationError("rearm_percent", a.RearmPercent, customerrors.ErrInvalidAlert)
+	}
+	if a.Cooldown < 0 {
+		return customerrors.NewValidationError("cooldown", a.Cooldown, customerrors.ErrInvalidAlert)
+	}
+	if a.MaxFirings < 0 {
+		return customerrors.NewValidationError("max_firings", a.MaxFirings, customerrors.ErrInvalidAlert)
+	}
+	return nil
+}
+
+// rearmed reports whether a disarmed alert's condition has cleared with the
+// configured hysteresis: the value must be at least RearmPercent away from
+// meeting the condition in either direction. A trailing stop keeps ratcheting
+// while disarmed and the value never exceeds its high, so instead it re-arms
+// once the value is RearmPercent of the trail distance above the current stop.
+func rearmed(a models.Alert, value float64) bool {
+	band := a.RearmPercent / 100
+	if a.AlertType == models.AlertTypeTrailingStop {
+		stop := a.EffectiveStop()
+		return value > stop+(a.HighWaterMark-stop)*band
+	}
+	return !shouldTrigger(a, value) &&
+		!shouldTrigger(a, value*(1+band)) &&
+		!shouldTrigger(a, value*(1-band))
+}
+
+// retireIfExpired retires a once it is past ExpiresAt, reporting whether it
+// did so.
+func retireIfExpired(a *models.Alert, now time.Time) bool {
+	if !a.IsExpired(now) {
+		return false
+	}
+	a.Triggered = true
+	a.Expired = true
+	return true
+}
+
+// step advances a's state for one observed value and reports whether it
+// fires now and whether it changed and must be saved.
+func step(a *models.Alert, value float64, now time.Time) (fire, dirty bool) {
+	fire, dirty = evaluate(a, value)
+
+	if a.Disarmed {
+		if rearmed(*a, value) {
+			a.Disarmed = false
+			dirty = true
+		}
+		return false, dirty
+	}
+	if !fire || a.InCooldown(now) {
+		return false, dirty
+	}
+
+	a.FireCount++
+	a.LastFiredAt = now
+	a.TriggeredAt = now
+	if !a.Recurring || (a.MaxFirings > 0 && a.FireCount >= a.MaxFirings) {
+		a.Triggered = true
+	} else {
+		a.Disarmed = true
+		if a.AlertType == models.AlertTypeTrailingStop {
+			// Trail again from where the stop was hit.
+			a.HighWaterMark = value
+		}
+	}
+	return true, true
+}
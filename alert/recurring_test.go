@@ -0,0 +1,144 @@
+package alert
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStep_RearmsWithHysteresis(t *testing.T) {
+	now := time.Now()
+	a := models.Alert{
+		AlertType:      models.AlertTypeSell,
+		ThresholdPrice: 45000,
+		Recurring:      true,
+		RearmPercent:   2,
+	}
+
+	steps := []struct {
+		price float64
+		fire  bool
+	}{
+		{46000, true},  // fires and disarms
+		{46000, false}, // still above, disarmed
+		{44500, false}, // back below but inside the 2% band, stays disarmed
+		{44000, false}, // clear of the band, re-arms
+		{45500, true},  // fires again
+	}
+	for i, s := range steps {
+		fire, _ := step(&a, s.price, now.Add(time.Duration(i)*time.Minute))
+		if fire != s.fire {
+			t.Fatalf("step %d at %v: fire = %v, want %v (state %+v)", i, s.price, fire, s.fire, a)
+		}
+	}
+	if a.FireCount != 2 || a.Triggered {
+		t.Errorf("expected 2 firings and still active, got %+v", a)
+	}
+}
+
+func TestStep_RearmsTrailingStop(t *testing.T) {
+	now := time.Now()
+	for _, a := range []models.Alert{
+		{AlertType: models.AlertTypeTrailingStop, TrailPercent: 10, HighWaterMark: 100, Recurring: true, RearmPercent: 15},
+		{AlertType: models.AlertTypeTrailingStop, TrailAmount: 10, HighWaterMark: 100, Recurring: true, RearmPercent: 15},
+	} {
+		steps := []struct {
+			price float64
+			fire  bool
+		}{
+			{89, true},   // hits the stop and disarms, trailing from 89
+			{80, false},  // still inside the band above the new stop
+			{120, false}, // rallies clear of the ratcheted stop, re-arms
+			{125, false}, // new high
+			{110, true},  // fires again below the raised stop
+		}
+		for i, s := range steps {
+			fire, _ := step(&a, s.price, now.Add(time.Duration(i)*time.Minute))
+			if fire != s.fire {
+				t.Fatalf("step %d at %v: fire = %v, want %v (state %+v)", i, s.price, fire, s.fire, a)
+			}
+		}
+		if a.FireCount != 2 || !a.Disarmed {
+			t.Errorf("expected 2 firings, got %+v", a)
+		}
+	}
+}
+
+func TestStep_CooldownAndMaxFirings(t *testing.T) {
+	start := time.Now()
+	a := models.Alert{
+		AlertType:      models.AlertTypeBuy,
+		ThresholdPrice: 100,
+		Recurring:      true,
+		Cooldown:       time.Hour,
+		MaxFirings:     2,
+	}
+
+	if fire, _ := step(&a, 90, start); !fire {
+		t.Fatal("expected first firing")
+	}
+	step(&a, 110, start.Add(time.Minute)) // re-arm
+	if fire, _ := step(&a, 90, start.Add(2*time.Minute)); fire {
+		t.Fatal("expected cooldown to suppress second firing")
+	}
+	if a.Disarmed {
+		t.Fatal("alert suppressed by cooldown should stay armed")
+	}
+	if fire, _ := step(&a, 90, start.Add(61*time.Minute)); !fire {
+		t.Fatal("expected firing after cooldown")
+	}
+	if !a.Triggered || a.FireCount != 2 {
+		t.Errorf("expected alert retired after MaxFirings, got %+v", a)
+	}
+}
+
+func TestCheckAndTriggerAlerts_RetiresExpired(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	a, err := AddAlert(ctx, store, api, models.Alert{
+		UserEmail:      testUser,
+		CoinID:         "bitcoin",
+		CoinName:       "Bitcoin",
+		AlertType:      models.AlertTypeSell,
+		ThresholdPrice: 45000,
+		Currency:       "usd",
+		ExpiresAt:      time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := store.Alerts().Update(ctx, a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := CheckAndTriggerAlerts(ctx, store, testUser, api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alerts, _ := GetAlerts(ctx, store, testUser); len(alerts) != 0 {
+		t.Fatalf("expected expired alert to be retired, got %+v", alerts)
+	}
+}
+
+func TestAddAlert_ScheduleRequiresRecurring(t *testing.T) {
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	_, err := AddAlert(context.Background(), store, api, models.Alert{
+		UserEmail:      testUser,
+		CoinID:         "bitcoin",
+		AlertType:      models.AlertTypeSell,
+		ThresholdPrice: 45000,
+		Currency:       "usd",
+		Cooldown:       time.Hour,
+	})
+	if !errors.Is(err, customerrors.ErrInvalidAlert) {
+		t.Errorf("expected ErrInvalidAlert, got: %v", err)
+	}
+}
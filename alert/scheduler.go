@@ -0,0 +1,103 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/db"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCheckInterval = time.Minute
+
+	// maxPriceBatch caps how many coin IDs go into a single price request.
+	maxPriceBatch = 100
+)
+
+// Scheduler periodically evaluates the untriggered alerts of every user. With
+// MongoDB it is safe to run several schedulers, or a scheduler alongside the
+// CLI, against the same database: versioned updates ensure each alert fires
+// only once. A bolt file is locked by the process that opens it, so there the
+// scheduler and the CLI cannot run at the same time.
+type Scheduler struct {
+	Store db.Store
+	API   api.CryptoApi
+	// Interval is the base delay between checks.
+	Interval time.Duration
+	// Jitter adds a random delay in [0, Jitter) to every interval so that
+	// multiple schedulers do not hit the price API in lockstep.
+	Jitter time.Duration
+
+	mu sync.Mutex
+}
+
+func NewScheduler(store db.Store, apiClient api.CryptoApi, interval, jitter time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	return &Scheduler{Store: store, API: apiClient, Interval: interval, Jitter: jitter}
+}
+
+func (s *Scheduler) nextDelay() time.Duration {
+	if s.Jitter <= 0 {
+		return s.Interval
+	}
+	return s.Interval + time.Duration(rand.Int63n(int64(s.Jitter)))
+}
+
+// RunOnce checks every active alert once and emails the owners of those that
+// fired. Overlapping calls on the same Scheduler are serialised. The check is
+// skipped when the store cannot be reached.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.Store.Ping(ctx); err != nil {
+		return 0, err
+	}
+
+	alerts, err := s.Store.Alerts().ListAllActive(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(alerts) == 0 {
+		return 0, nil
+	}
+
+	fired, err := triggerAlerts(ctx, s.Store, s.API, alerts)
+	for _, f := range fired {
+		notifyFired(ctx, s.Store, f)
+	}
+	return len(fired), err
+}
+
+// Run checks alerts immediately and then after every interval until ctx is
+// cancelled, returning ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		started := time.Now()
+		fired, err := s.RunOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Printf("[scheduler] alert check failed: %v\n", err)
+		}
+		fmt.Printf("[scheduler] %s: %d alert(s) triggered in %v\n",
+			started.Format(time.RFC3339), fired, time.Since(started).Round(time.Millisecond))
+
+		timer := time.NewTimer(s.nextDelay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
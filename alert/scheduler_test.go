@@ -0,0 +1,121 @@
+package alert
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/portfolio"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingAPI struct {
+	mockAPI
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+	return c.mockAPI.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
+}
+
+func TestSchedulerRunOnce_BatchesAcrossUsers(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	api := &countingAPI{mockAPI: mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 3000}}}
+
+	for _, user := range []string{"a@example.com", "b@example.com"} {
+		err := portfolio.AddMultipleHoldings(ctx, store, user,
+			models.Holding{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, BuyPrice: 30000, AddedAt: time.Now()},
+			models.Holding{CoinID: "ethereum", CoinName: "Ethereum", Quantity: 1, BuyPrice: 2000, AddedAt: time.Now()},
+		)
+		if err != nil {
+			t.Fatalf("seeding portfolio: %v", err)
+		}
+		if err := CreateAlert(ctx, store, user, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+			t.Fatalf("creating alert: %v", err)
+		}
+		if err := CreateAlert(ctx, store, user, "ethereum", "Ethereum", models.AlertTypeSell, 5000, "usd", api); err != nil {
+			t.Fatalf("creating alert: %v", err)
+		}
+	}
+
+	s := NewScheduler(store, api, time.Minute, 0)
+	fired, err := s.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fired != 2 {
+		t.Errorf("expected 2 bitcoin alerts to fire, got %d", fired)
+	}
+	if api.calls != 1 {
+		t.Errorf("expected a single batched price request, got %d", api.calls)
+	}
+
+	remaining, err := store.Alerts().ListAllActive(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(remaining) != 2 {
+		t.Errorf("expected the 2 ethereum alerts to stay active, got %d", len(remaining))
+	}
+}
+
+type unreachableStore struct {
+	db.Store
+}
+
+func (unreachableStore) Ping(ctx context.Context) error {
+	return customerrors.NewDatabaseError("ping", "test", errors.New("connection refused"))
+}
+
+func TestSchedulerRunOnce_SkipsUnreachableStore(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	api := &countingAPI{mockAPI: mockAPI{prices: map[string]float64{"bitcoin": 50000}}}
+	holding := models.Holding{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, BuyPrice: 30000, AddedAt: time.Now()}
+	if err := portfolio.AddMultipleHoldings(ctx, store, testUser, holding); err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+		t.Fatalf("creating alert: %v", err)
+	}
+
+	s := NewScheduler(unreachableStore{store}, api, time.Minute, 0)
+	if _, err := s.RunOnce(ctx); err == nil {
+		t.Fatal("expected the check to fail while the store is unreachable")
+	}
+	if api.calls != 0 {
+		t.Errorf("expected no price requests, got %d", api.calls)
+	}
+}
+
+func TestAlertUpdate_StaleVersionConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	if err := CreateAlert(ctx, store, testUser, "bitcoin", "Bitcoin", models.AlertTypeSell, 45000, "usd", api); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	alerts, err := GetAlerts(ctx, store, testUser)
+	if err != nil || len(alerts) != 1 {
+		t.Fatalf("expected one alert, got %v (%v)", alerts, err)
+	}
+
+	first, second := alerts[0], alerts[0]
+	first.Triggered = true
+	if err := store.Alerts().Update(ctx, &first); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	second.Triggered = true
+	if err := store.Alerts().Update(ctx, &second); !errors.Is(err, customerrors.ErrConflict) {
+		t.Errorf("expected ErrConflict for stale update, got: %v", err)
+	}
+}
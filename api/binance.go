@@ -0,0 +1,140 @@
+package api
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	customerrors "crypto-portfolio-tracker/errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultBinanceURL = "https://api.binance.com"
+
+// Symbols maps coin IDs to the ticker symbols exchanges list them under.
+var Symbols = map[string]string{
+	"bitcoin":          "BTC",
+	"ethereum":         "ETH",
+	"tether":           "USDT",
+	"binancecoin":      "BNB",
+	"solana":           "SOL",
+	"ripple":           "XRP",
+	"usd-coin":         "USDC",
+	"cardano":          "ADA",
+	"dogecoin":         "DOGE",
+	"tron":             "TRX",
+	"avalanche-2":      "AVAX",
+	"polkadot":         "DOT",
+	"chainlink":        "LINK",
+	"litecoin":         "LTC",
+	"shiba-inu":        "SHIB",
+	"uniswap":          "UNI",
+	"stellar":          "XLM",
+	"cosmos":           "ATOM",
+	"near":             "NEAR",
+	"the-open-network": "TON",
+}
+
+// Binance prices coins from the exchange's public spot tickers. Coins are
+// identified by their base asset symbol, e.g. "BTC", and US dollar prices
+// come from the USDT markets.
+type Binance struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewBinance() *Binance {
+	url := os.Getenv("BINANCE_URL")
+	if url == "" {
+		url = defaultBinanceURL
+	}
+
+	return &Binance{
+		BaseURL: strings.TrimSuffix(url, "/"),
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func binanceQuote(vsCurrency string) string {
+	if vsCurrency == "usd" {
+		return "USDT"
+	}
+	return strings.ToUpper(vsCurrency)
+}
+
+// tickers returns the last price of every market. Asking for all of them
+// costs one request, where asking for a list fails outright if any symbol
+// in it is not listed.
+func (b *Binance) tickers(ctx context.Context) (map[string]float64, error) {
+	var resp []struct {
+		Symbol string      `json:"symbol"`
+		Price  quotedFloat `json:"price"`
+	}
+	if err := getJSON(ctx, b.Client, "ticker/price", b.BaseURL+"/api/v3/ticker/price", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(resp))
+	for _, t := range resp {
+		prices[t.Symbol] = float64(t.Price)
+	}
+	return prices, nil
+}
+
+func (b *Binance) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	tickers, err := b.tickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := binanceQuote(vsCurrency)
+	prices := make(map[string]float64, len(coinIDs))
+	for _, id := range coinIDs {
+		if price, ok := tickers[strings.ToUpper(id)+quote]; ok && price > 0 {
+			prices[id] = price
+		}
+	}
+	return prices, nil
+}
+
+func (b *Binance) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	prices, err := b.FetchMultiplePrices(ctx, vsCurrency, coinID)
+	if err != nil {
+		return 0, err
+	}
+	price, ok := prices[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("ticker/price", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return price, nil
+}
+
+// GetSupportedCoins lists the assets with a USDT market. Binance has no
+// asset names, so each coin is named by its symbol.
+func (b *Binance) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	tickers, err := b.tickers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch supported coins: %w", err)
+	}
+
+	coins := make(map[string]string)
+	for symbol := range tickers {
+		if base, ok := strings.CutSuffix(symbol, "USDT"); ok && base != "" {
+			coins[base] = base
+		}
+	}
+	return coins, nil
+}
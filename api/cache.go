@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	customerrors "crypto-portfolio-tracker/errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultCacheTTL   = 30 * time.Second
+	DefaultCacheStale = 5 * time.Minute
+
+	// supportedCoinsTTL is how long the list of supported coins is kept; it
+	// changes far more slowly than prices.
+	supportedCoinsTTL = time.Hour
+)
+
+// CacheStats counts how price lookups were served. Hits, Stale and Misses
+// count coins; Fetches counts requests to the provider, which is lower than
+// Misses when coins are fetched together or identical lookups coalesce.
+type CacheStats struct {
+	Hits          uint64
+	Stale         uint64
+	Misses        uint64
+	Fetches       uint64
+	RefreshErrors uint64
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("%d hit(s), %d stale, %d miss(es), %d provider request(s), %d failed refresh(es)",
+		s.Hits, s.Stale, s.Misses, s.Fetches, s.RefreshErrors)
+}
+
+type cacheKey struct {
+	coinID     string
+	vsCurrency string
+}
+
+type cacheEntry struct {
+	quote     Quote
+	fetchedAt time.Time
+}
+
+// Cache keeps each coin's price for TTL, or CoinTTLs[coin] where set. For
+// StaleFor after that the old price is still returned while it is refreshed
+// in the background. Concurrent lookups of the same coins share one request
+// to the provider. Market data is passed through uncached.
+type Cache struct {
+	API      CryptoApi
+	TTL      time.Duration
+	StaleFor time.Duration
+	CoinTTLs map[string]time.Duration
+
+	mu         sync.Mutex
+	entries    map[cacheKey]cacheEntry
+	refreshing map[cacheKey]bool
+	coins      map[string]string
+	coinsAt    time.Time
+	stats      CacheStats
+
+	group     singleflight.Group
+	refreshes sync.WaitGroup
+	clock     func() time.Time
+}
+
+func NewCache(apiClient CryptoApi, ttl, staleFor time.Duration) *Cache {
+	return &Cache{
+		API:        apiClient,
+		TTL:        ttl,
+		StaleFor:   staleFor,
+		entries:    make(map[cacheKey]cacheEntry),
+		refreshing: make(map[cacheKey]bool),
+	}
+}
+
+func (c *Cache) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Cache) ttl(coinID string) time.Duration {
+	if d, ok := c.CoinTTLs[coinID]; ok {
+		return d
+	}
+	return c.TTL
+}
+
+// lookup returns the cached quotes for coinIDs, the stale ones among them
+// that nobody is refreshing yet, and the coins that must be fetched.
+func (c *Cache) lookup(vsCurrency string, coinIDs []string) (quotes map[string]Quote, stale, missing []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	quotes = make(map[string]Quote, len(coinIDs))
+	for _, id := range coinIDs {
+		if _, dup := quotes[id]; dup || slices.Contains(missing, id) {
+			continue
+		}
+
+		key := cacheKey{id, vsCurrency}
+		e, ok := c.entries[key]
+		age := now.Sub(e.fetchedAt)
+		switch {
+		case ok && age < c.ttl(id):
+			c.stats.Hits++
+			quotes[id] = e.quote
+		case ok && age < c.ttl(id)+c.StaleFor:
+			c.stats.Stale++
+			quotes[id] = e.quote
+			if !c.refreshing[key] {
+				c.refreshing[key] = true
+				stale = append(stale, id)
+			}
+		default:
+			c.stats.Misses++
+			missing = append(missing, id)
+		}
+	}
+	return quotes, stale, missing
+}
+
+// fetch asks the provider for coinIDs, sharing the request with any
+// identical one in flight. The request is not cancelled with ctx, since
+// other callers may be waiting on it; ctx only stops this caller waiting.
+func (c *Cache) fetch(ctx context.Context, vsCurrency string, coinIDs []string) (map[string]Quote, error) {
+	sorted := slices.Clone(coinIDs)
+	slices.Sort(sorted)
+	key := vsCurrency + "|" + strings.Join(sorted, ",")
+
+	ch := c.group.DoChan(key, func() (any, error) {
+		return c.fetchUncached(context.WithoutCancel(ctx), vsCurrency, coinIDs)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(map[string]Quote), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache) fetchUncached(ctx context.Context, vsCurrency string, coinIDs []string) (map[string]Quote, error) {
+	c.mu.Lock()
+	c.stats.Fetches++
+	c.mu.Unlock()
+
+	var quotes map[string]Quote
+	if qa, ok := c.API.(QuoteApi); ok {
+		var err error
+		if quotes, err = qa.FetchQuotes(ctx, vsCurrency, coinIDs...); err != nil {
+			return nil, err
+		}
+	} else {
+		prices, err := c.API.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
+		if err != nil {
+			return nil, err
+		}
+		quotes = make(map[string]Quote, len(prices))
+		for id, price := range prices {
+			quotes[id] = Quote{Price: price}
+		}
+	}
+
+	c.mu.Lock()
+	now := c.now()
+	for id, q := range quotes {
+		c.entries[cacheKey{id, vsCurrency}] = cacheEntry{quote: q, fetchedAt: now}
+	}
+	c.mu.Unlock()
+	return quotes, nil
+}
+
+// refresh re-fetches stale coins in the background. On failure the stale
+// prices are kept until they expire.
+func (c *Cache) refresh(ctx context.Context, vsCurrency string, coinIDs []string) {
+	ctx = context.WithoutCancel(ctx)
+	c.refreshes.Add(1)
+	go func() {
+		defer c.refreshes.Done()
+		_, err := c.fetch(ctx, vsCurrency, coinIDs)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err != nil {
+			c.stats.RefreshErrors++
+		}
+		for _, id := range coinIDs {
+			delete(c.refreshing, cacheKey{id, vsCurrency})
+		}
+	}()
+}
+
+func (c *Cache) FetchQuotes(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]Quote, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	quotes, stale, missing := c.lookup(vsCurrency, coinIDs)
+	if len(stale) > 0 {
+		c.refresh(ctx, vsCurrency, stale)
+	}
+	if len(missing) > 0 {
+		fetched, err := c.fetch(ctx, vsCurrency, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range missing {
+			if q, ok := fetched[id]; ok {
+				quotes[id] = q
+			}
+		}
+	}
+	return quotes, nil
+}
+
+func (c *Cache) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	quotes, err := c.FetchQuotes(ctx, vsCurrency, coinIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(quotes))
+	for id, q := range quotes {
+		prices[id] = q.Price
+	}
+	return prices, nil
+}
+
+func (c *Cache) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	quotes, err := c.FetchQuotes(ctx, vsCurrency, coinID)
+	if err != nil {
+		return 0, err
+	}
+	q, ok := quotes[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("cache", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return q.Price, nil
+}
+
+func (c *Cache) FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]MarketData, error) {
+	md, ok := c.API.(MarketDataApi)
+	if !ok {
+		return nil, customerrors.NewAPIError("cache", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return md.FetchMarketData(ctx, vsCurrency, coinIDs...)
+}
+
+func (c *Cache) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	c.mu.Lock()
+	if c.coins != nil && c.now().Sub(c.coinsAt) < supportedCoinsTTL {
+		coins := maps.Clone(c.coins)
+		c.mu.Unlock()
+		return coins, nil
+	}
+	c.mu.Unlock()
+
+	v, err, _ := c.group.Do("coins", func() (any, error) {
+		coins, err := c.API.GetSupportedCoins(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.coins, c.coinsAt = coins, c.now()
+		c.mu.Unlock()
+		return coins, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(v.(map[string]string)), nil
+}
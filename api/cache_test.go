@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingAPI records the coins it is asked for and can hold requests until
+// released.
+type countingAPI struct {
+	mu        sync.Mutex
+	prices    map[string]float64
+	err       error
+	requested [][]string
+	release   chan struct{}
+}
+
+func (a *countingAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	prices, err := a.FetchMultiplePrices(ctx, vsCurrency, coinID)
+	return prices[coinID], err
+}
+
+func (a *countingAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	if a.release != nil {
+		<-a.release
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requested = append(a.requested, slices.Clone(coinIDs))
+	if a.err != nil {
+		return nil, a.err
+	}
+	result := make(map[string]float64)
+	for _, id := range coinIDs {
+		if p, ok := a.prices[id]; ok {
+			result[id] = p
+		}
+	}
+	return result, nil
+}
+
+func (a *countingAPI) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requested = append(a.requested, nil)
+	return map[string]string{"bitcoin": "Bitcoin"}, nil
+}
+
+func (a *countingAPI) setPrice(id string, price float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prices[id] = price
+}
+
+func (a *countingAPI) calls() [][]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.requested)
+}
+
+func newTestCache(apiClient CryptoApi, now *time.Time) *Cache {
+	c := NewCache(apiClient, 30*time.Second, 5*time.Minute)
+	c.clock = func() time.Time { return *now }
+	return c
+}
+
+func TestCache_PerCoinTTL(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000, "tether": 1}}
+	now := time.Now()
+	c := newTestCache(inner, &now)
+	c.CoinTTLs = map[string]time.Duration{"tether": time.Hour}
+
+	if _, err := c.FetchMultiplePrices(ctx, "usd", "bitcoin", "tether"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	prices, err := c.FetchMultiplePrices(ctx, "USD", "bitcoin", "ethereum")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if prices["bitcoin"] != 50000 || prices["ethereum"] != 2000 {
+		t.Errorf("unexpected prices: %v", prices)
+	}
+	if calls := inner.calls(); len(calls) != 2 || !slices.Equal(calls[1], []string{"ethereum"}) {
+		t.Errorf("expected only the uncached coin to be fetched, got %v", calls)
+	}
+
+	if _, err := c.FetchPrice(ctx, "bitcoin", "eur"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := inner.calls(); len(calls) != 3 {
+		t.Errorf("expected prices to be cached per currency, got %v", calls)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if p, err := c.FetchPrice(ctx, "tether", "usd"); err != nil || p != 1 {
+		t.Errorf("expected tether's longer TTL to keep it cached, got %v (%v)", p, err)
+	}
+	if calls := inner.calls(); len(calls) != 3 {
+		t.Errorf("expected no request for tether, got %v", calls)
+	}
+
+	want := CacheStats{Hits: 2, Misses: 4, Fetches: 3}
+	if got := c.Stats(); got != want {
+		t.Errorf("expected stats %+v, got %+v", want, got)
+	}
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingAPI{prices: map[string]float64{"bitcoin": 50000}}
+	now := time.Now()
+	c := newTestCache(inner, &now)
+
+	if _, err := c.FetchPrice(ctx, "bitcoin", "usd"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	inner.setPrice("bitcoin", 51000)
+	now = now.Add(time.Minute)
+	if p, err := c.FetchPrice(ctx, "bitcoin", "usd"); err != nil || p != 50000 {
+		t.Errorf("expected the stale price straight away, got %v (%v)", p, err)
+	}
+	c.refreshes.Wait()
+	if p, _ := c.FetchPrice(ctx, "bitcoin", "usd"); p != 51000 {
+		t.Errorf("expected the refreshed price, got %v", p)
+	}
+
+	inner.mu.Lock()
+	inner.err = errors.New("unreachable")
+	inner.mu.Unlock()
+	now = now.Add(time.Minute)
+	if p, _ := c.FetchPrice(ctx, "bitcoin", "usd"); p != 51000 {
+		t.Errorf("expected the stale price while the provider is down, got %v", p)
+	}
+	c.refreshes.Wait()
+
+	now = now.Add(10 * time.Minute)
+	if _, err := c.FetchPrice(ctx, "bitcoin", "usd"); err == nil {
+		t.Error("expected an expired price to be fetched again, and the failure returned")
+	}
+
+	want := CacheStats{Hits: 1, Stale: 2, Misses: 2, Fetches: 4, RefreshErrors: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("expected stats %+v, got %+v", want, got)
+	}
+}
+
+func TestCache_CoalescesIdenticalLookups(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingAPI{prices: map[string]float64{"bitcoin": 50000}, release: make(chan struct{})}
+	now := time.Now()
+	c := newTestCache(inner, &now)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p, err := c.FetchPrice(ctx, "bitcoin", "usd"); err != nil || p != 50000 {
+				errs <- errors.Join(err, errors.New("wrong price"))
+			}
+		}()
+	}
+
+	for c.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if calls := inner.calls(); len(calls) != 1 {
+		t.Errorf("expected one request for all callers, got %d", len(calls))
+	}
+}
+
+func TestCache_KeepsQuoteSources(t *testing.T) {
+	consensus := NewConsensus(2,
+		Provider{Name: "a", API: &stubAPI{prices: map[string]float64{"bitcoin": 50000}}},
+		Provider{Name: "b", API: &stubAPI{prices: map[string]float64{"bitcoin": 50100}}},
+		Provider{Name: "c", API: &stubAPI{prices: map[string]float64{"bitcoin": 60000}}},
+	)
+	now := time.Now()
+	c := newTestCache(consensus, &now)
+
+	for i := 0; i < 2; i++ {
+		quotes, err := c.FetchQuotes(context.Background(), "usd", "bitcoin")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if q := quotes["bitcoin"]; !q.Disagree() || !slices.Equal(q.Rejected, []string{"c"}) {
+			t.Errorf("expected the consensus sources to survive caching, got %+v", q)
+		}
+	}
+}
+
+func TestCache_SupportedCoins(t *testing.T) {
+	inner := &countingAPI{}
+	now := time.Now()
+	c := newTestCache(inner, &now)
+
+	for i := 0; i < 2; i++ {
+		coins, err := c.GetSupportedCoins(context.Background())
+		if err != nil || coins["bitcoin"] != "Bitcoin" {
+			t.Fatalf("unexpected result: %v (%v)", coins, err)
+		}
+		coins["dogecoin"] = "Dogecoin"
+	}
+	if calls := inner.calls(); len(calls) != 1 {
+		t.Errorf("expected the coin list to be cached, got %d requests", len(calls))
+	}
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	customerrors "crypto-portfolio-tracker/errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultCoinCapURL = "https://api.coincap.io/v2"
+
+// CoinCapIDs maps coin IDs whose CoinCap asset ID differs from CoinGecko's.
+// Other coins share the same ID on both.
+var CoinCapIDs = map[string]string{
+	"binancecoin":      "binance-coin",
+	"ripple":           "xrp",
+	"avalanche-2":      "avalanche",
+	"the-open-network": "toncoin",
+}
+
+// CoinCap quotes prices in USD. Other currencies are converted with
+// CoinCap's own exchange rates; the 24h change stays the USD change.
+type CoinCap struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewCoinCap() *CoinCap {
+	url := os.Getenv("COINCAP_URL")
+	if url == "" {
+		url = defaultCoinCapURL
+	}
+
+	return &CoinCap{
+		BaseURL: strings.TrimSuffix(url, "/"),
+		APIKey:  os.Getenv("COINCAP_API_KEY"),
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+type coinCapAsset struct {
+	ID                string      `json:"id"`
+	Name              string      `json:"name"`
+	PriceUsd          quotedFloat `json:"priceUsd"`
+	ChangePercent24Hr quotedFloat `json:"changePercent24Hr"`
+	VolumeUsd24Hr     quotedFloat `json:"volumeUsd24Hr"`
+	MarketCapUsd      quotedFloat `json:"marketCapUsd"`
+}
+
+func (cc *CoinCap) get(ctx context.Context, endpoint, query string, out any) error {
+	header := http.Header{}
+	if cc.APIKey != "" {
+		header.Set("Authorization", "Bearer "+cc.APIKey)
+	}
+	return getJSON(ctx, cc.Client, endpoint, cc.BaseURL+"/"+endpoint+query, header, out)
+}
+
+// usdRate returns the USD value of one unit of vsCurrency.
+func (cc *CoinCap) usdRate(ctx context.Context, vsCurrency string) (float64, error) {
+	if vsCurrency == "usd" {
+		return 1, nil
+	}
+
+	var resp struct {
+		Data []struct {
+			Symbol  string      `json:"symbol"`
+			RateUsd quotedFloat `json:"rateUsd"`
+		} `json:"data"`
+	}
+	if err := cc.get(ctx, "rates", "", &resp); err != nil {
+		return 0, err
+	}
+	for _, r := range resp.Data {
+		if strings.EqualFold(r.Symbol, vsCurrency) && r.RateUsd > 0 {
+			return float64(r.RateUsd), nil
+		}
+	}
+	return 0, customerrors.NewAPIError("rates", 0, customerrors.ErrPriceNotAvailable)
+}
+
+func (cc *CoinCap) FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]MarketData, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := cc.usdRate(ctx, vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []coinCapAsset `json:"data"`
+	}
+	if err := cc.get(ctx, "assets", "?ids="+strings.Join(coinIDs, ","), &resp); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]MarketData, len(resp.Data))
+	for _, a := range resp.Data {
+		if a.PriceUsd <= 0 {
+			continue
+		}
+		data[a.ID] = MarketData{
+			Price:     float64(a.PriceUsd) / rate,
+			Change24h: float64(a.ChangePercent24Hr),
+			Volume24h: float64(a.VolumeUsd24Hr) / rate,
+			MarketCap: float64(a.MarketCapUsd) / rate,
+		}
+	}
+	return data, nil
+}
+
+func (cc *CoinCap) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	data, err := cc.FetchMarketData(ctx, vsCurrency, coinIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(data))
+	for id, d := range data {
+		prices[id] = d.Price
+	}
+	return prices, nil
+}
+
+func (cc *CoinCap) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	prices, err := cc.FetchMultiplePrices(ctx, vsCurrency, coinID)
+	if err != nil {
+		return 0, err
+	}
+	price, ok := prices[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("assets", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return price, nil
+}
+
+func (cc *CoinCap) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	var resp struct {
+		Data []coinCapAsset `json:"data"`
+	}
+	if err := cc.get(ctx, "assets", "?limit=100", &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch supported coins: %w", err)
+	}
+
+	coins := make(map[string]string, len(resp.Data))
+	for _, a := range resp.Data {
+		coins[a.ID] = a.Name
+	}
+	return coins, nil
+}
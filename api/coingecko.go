@@ -1,6 +1,8 @@
 package api
 
 import (
+	"context"
+	"crypto-portfolio-tracker/currency"
 	customerrors "crypto-portfolio-tracker/errors"
 	"encoding/json"
 	"errors"
@@ -11,8 +13,6 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
 type CoinGecko struct {
@@ -24,9 +24,6 @@ type CoinGecko struct {
 }
 
 func NewCoinGecko() (*CoinGecko, error) {
-	if err := godotenv.Load(); err != nil {
-		return nil, fmt.Errorf("error loading .env file: %w", err)
-	}
 	url := os.Getenv("URL")
 	if url == "" {
 		return nil, fmt.Errorf("URL not set in environment")
@@ -40,29 +37,51 @@ func NewCoinGecko() (*CoinGecko, error) {
 	}, nil
 }
 
-func (cg *CoinGecko) waitForRateLimit() {
+func (cg *CoinGecko) waitForRateLimit(ctx context.Context) error {
 	cg.mu.Lock()
 	defer cg.mu.Unlock()
 
 	if !cg.lastRequestTime.IsZero() {
 		if elapsed := time.Since(cg.lastRequestTime); elapsed < cg.minDelay {
-			time.Sleep(cg.minDelay - elapsed)
+			timer := time.NewTimer(cg.minDelay - elapsed)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 	}
 	cg.lastRequestTime = time.Now()
+	return nil
+}
+
+func (cg *CoinGecko) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return cg.Client.Do(req)
 }
 
-func (cg *CoinGecko) FetchMultiplePrices(coinIDs ...string) (map[string]float64, error) {
+func (cg *CoinGecko) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
 	if len(coinIDs) == 0 {
 		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
 	}
 
-	cg.waitForRateLimit()
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cg.waitForRateLimit(ctx); err != nil {
+		return nil, customerrors.NewAPIError("simple/price", 0, err)
+	}
 
 	coinList := strings.Join(coinIDs, ",")
-	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=usd", cg.BaseURL, coinList)
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s", cg.BaseURL, coinList, vsCurrency)
 
-	resp, err := cg.Client.Get(url)
+	resp, err := cg.get(ctx, url)
 	if err != nil {
 		return nil, customerrors.NewAPIError("simple/price", 0, err)
 	}
@@ -88,8 +107,8 @@ func (cg *CoinGecko) FetchMultiplePrices(coinIDs ...string) (map[string]float64,
 	prices := make(map[string]float64, len(coinIDs))
 	var missing []string
 	for _, id := range coinIDs {
-		if data, ok := raw[id]; ok {
-			prices[id] = data["usd"]
+		if price, ok := raw[id][vsCurrency]; ok {
+			prices[id] = price
 		} else {
 			missing = append(missing, id)
 		}
@@ -110,7 +129,7 @@ func (cg *CoinGecko) FetchMultiplePrices(coinIDs ...string) (map[string]float64,
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				p, err := cg.FetchPrice(id)
+				p, err := cg.FetchPrice(ctx, id, vsCurrency)
 				ch <- result{coinID: id, price: p, err: err}
 			}()
 		}
@@ -132,12 +151,19 @@ func (cg *CoinGecko) FetchMultiplePrices(coinIDs ...string) (map[string]float64,
 	return prices, nil
 }
 
-func (cg *CoinGecko) FetchPrice(coinID string) (float64, error) {
-	cg.waitForRateLimit()
+func (cg *CoinGecko) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return 0, err
+	}
 
-	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=usd", cg.BaseURL, coinID)
+	if err := cg.waitForRateLimit(ctx); err != nil {
+		return 0, customerrors.NewAPIError("simple/price", 0, err)
+	}
+
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s", cg.BaseURL, coinID, vsCurrency)
 
-	resp, err := cg.Client.Get(url)
+	resp, err := cg.get(ctx, url)
 	if err != nil {
 		return 0, customerrors.NewAPIError("simple/price", 0, err)
 	}
@@ -160,7 +186,7 @@ func (cg *CoinGecko) FetchPrice(coinID string) (float64, error) {
 		return 0, customerrors.NewAPIError("simple/price", 0, fmt.Errorf("failed to parse JSON: %w", err))
 	}
 
-	price, ok := result[coinID]["usd"]
+	price, ok := result[coinID][vsCurrency]
 	if !ok {
 		return 0, customerrors.NewAPIError("simple/price", 0, customerrors.ErrPriceNotAvailable)
 	}
@@ -168,10 +194,10 @@ func (cg *CoinGecko) FetchPrice(coinID string) (float64, error) {
 	return price, nil
 }
 
-func (cg *CoinGecko) GetSupportedCoins() (map[string]string, error) {
+func (cg *CoinGecko) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
 	url := fmt.Sprintf("%s/coins/markets?vs_currency=usd&order=market_cap_desc&per_page=100&page=1", cg.BaseURL)
 
-	resp, err := cg.Client.Get(url)
+	resp, err := cg.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch supported coins: %w", err)
 	}
@@ -203,3 +229,64 @@ func (cg *CoinGecko) GetSupportedCoins() (map[string]string, error) {
 
 	return coins, nil
 }
+
+func (cg *CoinGecko) FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]MarketData, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cg.waitForRateLimit(ctx); err != nil {
+		return nil, customerrors.NewAPIError("simple/price", 0, err)
+	}
+
+	url := fmt.Sprintf("%s/simple/price?ids=%s&vs_currencies=%s&include_market_cap=true&include_24hr_vol=true&include_24hr_change=true",
+		cg.BaseURL, strings.Join(coinIDs, ","), vsCurrency)
+
+	resp, err := cg.get(ctx, url)
+	if err != nil {
+		return nil, customerrors.NewAPIError("simple/price", 0, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 429 {
+		return nil, customerrors.NewAPIError("simple/price", 429, customerrors.ErrRateLimitExceeded)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, customerrors.NewAPIError("simple/price", resp.StatusCode, errors.New("failed to fetch market data"))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, customerrors.NewAPIError("simple/price", 0, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	var raw map[string]map[string]float64
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, customerrors.NewAPIError("simple/price", 0, fmt.Errorf("failed to parse JSON: %w", err))
+	}
+
+	data := make(map[string]MarketData, len(coinIDs))
+	for _, id := range coinIDs {
+		fields, ok := raw[id]
+		if !ok {
+			continue
+		}
+		price, ok := fields[vsCurrency]
+		if !ok {
+			continue
+		}
+		data[id] = MarketData{
+			Price:     price,
+			Change24h: fields[vsCurrency+"_24h_change"],
+			Volume24h: fields[vsCurrency+"_24h_vol"],
+			MarketCap: fields[vsCurrency+"_market_cap"],
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+const DefaultMaxDeviation = 2.0
+
+// Quote is a consensus price and where it came from.
+type Quote struct {
+	Price float64
+
+	// Sources are the providers whose prices agreed and were used; Rejected
+	// are the outliers. Prices holds every provider's price by name.
+	Sources  []string
+	Rejected []string
+	Prices   map[string]float64
+
+	// Contested is set when no two sources were close enough to agree on,
+	// in which case Price is the median of them all.
+	Contested bool
+}
+
+// Disagree reports whether the sources differed by more than the allowed
+// deviation.
+func (q Quote) Disagree() bool {
+	return q.Contested || len(q.Rejected) > 0
+}
+
+// QuoteApi is implemented by providers that can report the sources behind
+// their prices.
+type QuoteApi interface {
+	FetchQuotes(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]Quote, error)
+}
+
+// Consensus asks all its providers at once and prices each coin at the
+// median of their answers, ignoring those more than MaxDeviation percent
+// away from it. Market statistics are not cross-checked; they come from the
+// first provider able to report them.
+type Consensus struct {
+	Providers    []Provider
+	MaxDeviation float64
+
+	fallback *Failover
+}
+
+func NewConsensus(maxDeviation float64, providers ...Provider) *Consensus {
+	if maxDeviation <= 0 {
+		maxDeviation = DefaultMaxDeviation
+	}
+	return &Consensus{
+		Providers:    providers,
+		MaxDeviation: maxDeviation,
+		fallback:     NewFailover(providers...),
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// quote settles on a price from the sources' prices, given in provider order.
+func (c *Consensus) quote(sources []string, prices []float64) Quote {
+	q := Quote{Prices: make(map[string]float64, len(sources))}
+	for i, name := range sources {
+		q.Prices[name] = prices[i]
+	}
+
+	mid := median(prices)
+	var accepted []float64
+	for i, name := range sources {
+		if math.Abs(prices[i]-mid)/mid*100 <= c.MaxDeviation {
+			q.Sources = append(q.Sources, name)
+			accepted = append(accepted, prices[i])
+		} else {
+			q.Rejected = append(q.Rejected, name)
+		}
+	}
+
+	if len(accepted) == 0 {
+		q.Price = mid
+		q.Sources, q.Rejected = sources, nil
+		q.Contested = true
+		return q
+	}
+	q.Price = median(accepted)
+	return q
+}
+
+// FetchQuotes returns a quote for every coin at least one provider could
+// price. Providers that fail are left out; an error is returned only if
+// they all fail.
+func (c *Consensus) FetchQuotes(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]Quote, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	type result struct {
+		prices map[string]float64
+		err    error
+	}
+	results := make([]result, len(c.Providers))
+	var wg sync.WaitGroup
+
+	for i, p := range c.Providers {
+		var native []string
+		byNative := make(map[string]string, len(coinIDs))
+		for _, id := range coinIDs {
+			if n, ok := p.nativeID(id); ok {
+				native = append(native, n)
+				byNative[n] = id
+			}
+		}
+		if len(native) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := p.API.FetchMultiplePrices(ctx, vsCurrency, native...)
+			if err != nil {
+				results[i] = result{err: err}
+				return
+			}
+			prices := make(map[string]float64, len(got))
+			for n, price := range got {
+				if id, ok := byNative[n]; ok && price > 0 {
+					prices[id] = price
+				}
+			}
+			results[i] = result{prices: prices}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	succeeded := 0
+	for i, r := range results {
+		if r.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Providers[i].Name, r.err))
+		} else if r.prices != nil {
+			succeeded++
+		}
+	}
+	if succeeded == 0 && len(errs) > 0 {
+		return nil, customerrors.NewAPIError("consensus", 0, errors.Join(errs...))
+	}
+
+	quotes := make(map[string]Quote, len(coinIDs))
+	for _, id := range coinIDs {
+		var sources []string
+		var prices []float64
+		for i, r := range results {
+			if price, ok := r.prices[id]; ok {
+				sources = append(sources, c.Providers[i].Name)
+				prices = append(prices, price)
+			}
+		}
+		if len(prices) > 0 {
+			quotes[id] = c.quote(sources, prices)
+		}
+	}
+	return quotes, nil
+}
+
+func (c *Consensus) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	quotes, err := c.FetchQuotes(ctx, vsCurrency, coinIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(quotes))
+	for id, q := range quotes {
+		prices[id] = q.Price
+	}
+	return prices, nil
+}
+
+func (c *Consensus) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	quotes, err := c.FetchQuotes(ctx, vsCurrency, coinID)
+	if err != nil {
+		return 0, err
+	}
+	q, ok := quotes[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("consensus", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return q.Price, nil
+}
+
+func (c *Consensus) FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]MarketData, error) {
+	return c.fallback.FetchMarketData(ctx, vsCurrency, coinIDs...)
+}
+
+func (c *Consensus) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	return supportedCoins(ctx, c.Providers)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestConsensus_RejectsOutliers(t *testing.T) {
+	c := NewConsensus(2,
+		Provider{Name: "a", API: &stubAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000}}},
+		Provider{Name: "b", API: &stubAPI{prices: map[string]float64{"BTC": 50200, "ETH": 2010}}, IDs: Symbols, MappedOnly: true},
+		Provider{Name: "c", API: &stubAPI{prices: map[string]float64{"bitcoin": 58000}}},
+	)
+
+	quotes, err := c.FetchQuotes(context.Background(), "usd", "bitcoin", "ethereum", "dogecoin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(quotes) != 2 {
+		t.Fatalf("expected quotes for the two priced coins, got %+v", quotes)
+	}
+
+	btc := quotes["bitcoin"]
+	if btc.Price != 50100 || !slices.Equal(btc.Sources, []string{"a", "b"}) || !slices.Equal(btc.Rejected, []string{"c"}) {
+		t.Errorf("expected c's outlier to be ignored, got %+v", btc)
+	}
+	if !btc.Disagree() || btc.Prices["c"] != 58000 {
+		t.Errorf("expected the disagreement to be reported, got %+v", btc)
+	}
+
+	eth := quotes["ethereum"]
+	if eth.Price != 2005 || eth.Disagree() || len(eth.Sources) != 2 {
+		t.Errorf("expected agreeing sources, got %+v", eth)
+	}
+}
+
+func TestConsensus_Contested(t *testing.T) {
+	c := NewConsensus(1,
+		Provider{Name: "a", API: &stubAPI{prices: map[string]float64{"bitcoin": 50000}}},
+		Provider{Name: "b", API: &stubAPI{prices: map[string]float64{"bitcoin": 52000}}},
+	)
+
+	price, err := c.FetchPrice(context.Background(), "bitcoin", "usd")
+	if err != nil || price != 51000 {
+		t.Fatalf("expected the median, got %v (%v)", price, err)
+	}
+	quotes, _ := c.FetchQuotes(context.Background(), "usd", "bitcoin")
+	if q := quotes["bitcoin"]; !q.Contested || len(q.Sources) != 2 || len(q.Rejected) != 0 {
+		t.Errorf("expected a contested quote from both sources, got %+v", q)
+	}
+}
+
+func TestConsensus_ProviderFailures(t *testing.T) {
+	ctx := context.Background()
+	c := NewConsensus(2,
+		Provider{Name: "down", API: &stubAPI{err: rateLimited}},
+		Provider{Name: "up", API: &stubAPI{prices: map[string]float64{"bitcoin": 50000}}},
+	)
+	quotes, err := c.FetchQuotes(ctx, "usd", "bitcoin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q := quotes["bitcoin"]; q.Price != 50000 || !slices.Equal(q.Sources, []string{"up"}) {
+		t.Errorf("expected the remaining source alone, got %+v", q)
+	}
+
+	c = NewConsensus(2,
+		Provider{Name: "down", API: &stubAPI{err: rateLimited}},
+		Provider{Name: "also-down", API: &stubAPI{err: errors.New("unreachable")}},
+	)
+	if _, err := c.FetchMultiplePrices(ctx, "usd", "bitcoin"); !errors.Is(err, customerrors.ErrRateLimitExceeded) {
+		t.Errorf("expected the providers' errors when all fail, got %v", err)
+	}
+}
@@ -1,7 +1,54 @@
 package api
 
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+)
+
 type CryptoApi interface {
-	FetchPrice(coinID string) (float64, error)
-	FetchMultiplePrices(coinIDs ...string) (map[string]float64, error)
-	GetSupportedCoins() (map[string]string, error)
+	FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error)
+	FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error)
+	GetSupportedCoins(ctx context.Context) (map[string]string, error)
+}
+
+// MarketData is a coin's price with its 24h statistics, all quoted in the
+// requested currency. Change24h is a percentage.
+type MarketData struct {
+	Price     float64
+	Change24h float64
+	Volume24h float64
+	MarketCap float64
+}
+
+// MarketDataApi is implemented by providers that can report 24h change,
+// volume and market cap alongside the price.
+type MarketDataApi interface {
+	FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]MarketData, error)
+}
+
+// StaticPrices serves already-fetched quotes through the CryptoApi interface,
+// so portfolio metrics can be computed by the portfolio package without a
+// second round of price requests.
+type StaticPrices map[string]float64
+
+func (s StaticPrices) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	p, ok := s[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("simple/price", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return p, nil
+}
+
+func (s StaticPrices) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(coinIDs))
+	for _, id := range coinIDs {
+		if p, ok := s[id]; ok {
+			prices[id] = p
+		}
+	}
+	return prices, nil
+}
+
+func (s StaticPrices) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
 }
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const DefaultCooldown = time.Minute
+
+// Provider is one price source in a Failover chain.
+type Provider struct {
+	Name string
+	API  CryptoApi
+
+	// IDs maps the tracker's coin IDs, which are CoinGecko's, to the
+	// provider's. Unmapped coins are passed through unchanged unless
+	// MappedOnly is set, in which case the provider is not asked for them.
+	IDs        map[string]string
+	MappedOnly bool
+}
+
+func (p Provider) nativeID(coinID string) (string, bool) {
+	if id, ok := p.IDs[coinID]; ok {
+		return id, true
+	}
+	return coinID, !p.MappedOnly
+}
+
+// Failover asks its providers in priority order and moves on to the next
+// when one is rate limited, fails with a 5xx or cannot be reached, or does
+// not have a price. A rate-limited provider is skipped for Cooldown.
+type Failover struct {
+	Providers []Provider
+	Cooldown  time.Duration
+
+	mu    sync.Mutex
+	until map[string]time.Time
+	clock func() time.Time
+}
+
+func NewFailover(providers ...Provider) *Failover {
+	return &Failover{
+		Providers: providers,
+		Cooldown:  DefaultCooldown,
+		until:     make(map[string]time.Time),
+	}
+}
+
+func (f *Failover) now() time.Time {
+	if f.clock != nil {
+		return f.clock()
+	}
+	return time.Now()
+}
+
+// available returns the providers not cooling down, or all of them if every
+// one is, since a provider that may have recovered beats no price at all.
+func (f *Failover) available() []Provider {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	var ready []Provider
+	for _, p := range f.Providers {
+		if now.After(f.until[p.Name]) {
+			ready = append(ready, p)
+		}
+	}
+	if len(ready) == 0 {
+		return f.Providers
+	}
+	return ready
+}
+
+// failover reports whether err from p is worth retrying elsewhere, putting
+// p on cooldown if it was rate limited.
+func (f *Failover) failover(p Provider, err error) bool {
+	if errors.Is(err, customerrors.ErrRateLimitExceeded) {
+		f.mu.Lock()
+		f.until[p.Name] = f.now().Add(f.Cooldown)
+		f.mu.Unlock()
+		return true
+	}
+	if errors.Is(err, customerrors.ErrPriceNotAvailable) {
+		return true
+	}
+	var apiErr *customerrors.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 500 {
+		return true
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+func (f *Failover) exhausted(endpoint string, errs []error) error {
+	if len(errs) == 0 {
+		return customerrors.NewAPIError(endpoint, 0, customerrors.ErrPriceNotAvailable)
+	}
+	return customerrors.NewAPIError(endpoint, 0, errors.Join(errs...))
+}
+
+func (f *Failover) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	var errs []error
+	for _, p := range f.available() {
+		id, ok := p.nativeID(coinID)
+		if !ok {
+			continue
+		}
+		price, err := p.API.FetchPrice(ctx, id, vsCurrency)
+		if err == nil {
+			return price, nil
+		}
+		if ctx.Err() != nil || !f.failover(p, err) {
+			return 0, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+	}
+	return 0, f.exhausted("failover", errs)
+}
+
+// fetchEach asks each provider in turn for the coins still missing, using
+// fetch, until every coin has been found.
+func fetchEach[T any](ctx context.Context, f *Failover, providers []Provider, coinIDs []string, fetch func(Provider, []string) (map[string]T, error)) (map[string]T, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	found := make(map[string]T, len(coinIDs))
+	missing := coinIDs
+	var errs []error
+	for _, p := range providers {
+		if len(missing) == 0 {
+			break
+		}
+
+		var native []string
+		byNative := make(map[string]string, len(missing))
+		for _, id := range missing {
+			if n, ok := p.nativeID(id); ok {
+				native = append(native, n)
+				byNative[n] = id
+			}
+		}
+		if len(native) == 0 {
+			continue
+		}
+
+		got, err := fetch(p, native)
+		if err != nil {
+			if ctx.Err() != nil || !f.failover(p, err) {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		for n, v := range got {
+			if id, ok := byNative[n]; ok {
+				found[id] = v
+			}
+		}
+
+		var still []string
+		for _, id := range missing {
+			if _, ok := found[id]; !ok {
+				still = append(still, id)
+			}
+		}
+		missing = still
+	}
+
+	if len(found) == 0 && len(errs) > 0 {
+		return nil, f.exhausted("failover", errs)
+	}
+	return found, nil
+}
+
+// FetchMultiplePrices fills in each coin from the first provider that has
+// it. Coins no provider has are left out, as with a single provider.
+func (f *Failover) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	return fetchEach(ctx, f, f.available(), coinIDs, func(p Provider, ids []string) (map[string]float64, error) {
+		return p.API.FetchMultiplePrices(ctx, vsCurrency, ids...)
+	})
+}
+
+// FetchMarketData works like FetchMultiplePrices over the providers that
+// report market data.
+func (f *Failover) FetchMarketData(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]MarketData, error) {
+	var providers []Provider
+	for _, p := range f.available() {
+		if _, ok := p.API.(MarketDataApi); ok {
+			providers = append(providers, p)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, customerrors.NewAPIError("failover", 0, customerrors.ErrPriceNotAvailable)
+	}
+
+	return fetchEach(ctx, f, providers, coinIDs, func(p Provider, ids []string) (map[string]MarketData, error) {
+		return p.API.(MarketDataApi).FetchMarketData(ctx, vsCurrency, ids...)
+	})
+}
+
+// GetSupportedCoins returns the first available provider's coins under the
+// tracker's IDs.
+func (f *Failover) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	return supportedCoins(ctx, f.available())
+}
+
+func supportedCoins(ctx context.Context, providers []Provider) (map[string]string, error) {
+	var errs []error
+	for _, p := range providers {
+		native, err := p.API.GetSupportedCoins(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+
+		ids := make(map[string]string, len(p.IDs))
+		for id, n := range p.IDs {
+			ids[n] = id
+		}
+		coins := make(map[string]string, len(native))
+		for n, name := range native {
+			if id, ok := ids[n]; ok {
+				coins[id] = name
+			} else if !p.MappedOnly {
+				coins[n] = name
+			}
+		}
+		return coins, nil
+	}
+	return nil, fmt.Errorf("failed to fetch supported coins: %w", errors.Join(errs...))
+}
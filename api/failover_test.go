@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stubAPI serves fixed prices keyed by its own coin IDs, or fails with err.
+type stubAPI struct {
+	prices map[string]float64
+	coins  map[string]string
+	err    error
+	calls  int
+}
+
+func (s *stubAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	s.calls++
+	if s.err != nil {
+		return 0, s.err
+	}
+	p, ok := s.prices[coinID]
+	if !ok {
+		return 0, customerrors.NewAPIError("stub", 0, customerrors.ErrPriceNotAvailable)
+	}
+	return p, nil
+}
+
+func (s *stubAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	result := make(map[string]float64)
+	for _, id := range coinIDs {
+		if p, ok := s.prices[id]; ok {
+			result[id] = p
+		}
+	}
+	return result, nil
+}
+
+func (s *stubAPI) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.coins, nil
+}
+
+var rateLimited = customerrors.NewAPIError("stub", 429, customerrors.ErrRateLimitExceeded)
+
+func TestFailover_FailsOverAndCoolsDown(t *testing.T) {
+	ctx := context.Background()
+	primary := &stubAPI{err: rateLimited}
+	secondary := &stubAPI{prices: map[string]float64{"XBT": 50000}}
+
+	now := time.Now()
+	f := NewFailover(
+		Provider{Name: "primary", API: primary},
+		Provider{Name: "secondary", API: secondary, IDs: map[string]string{"bitcoin": "XBT"}, MappedOnly: true},
+	)
+	f.clock = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		price, err := f.FetchPrice(ctx, "bitcoin", "usd")
+		if err != nil || price != 50000 {
+			t.Fatalf("expected the secondary's price, got %v (%v)", price, err)
+		}
+	}
+	if primary.calls != 1 {
+		t.Errorf("expected the rate-limited provider to be skipped, got %d calls", primary.calls)
+	}
+
+	now = now.Add(DefaultCooldown + time.Second)
+	primary.err = nil
+	primary.prices = map[string]float64{"bitcoin": 51000}
+	if price, _ := f.FetchPrice(ctx, "bitcoin", "usd"); price != 51000 {
+		t.Errorf("expected the primary to be used again after its cooldown, got %v", price)
+	}
+}
+
+func TestFailover_FillsMissingCoins(t *testing.T) {
+	primary := &stubAPI{prices: map[string]float64{"bitcoin": 50000}}
+	secondary := &stubAPI{prices: map[string]float64{"ETH": 2000, "DOGE": 0.1}}
+	f := NewFailover(
+		Provider{Name: "primary", API: primary},
+		Provider{Name: "secondary", API: secondary, IDs: Symbols, MappedOnly: true},
+	)
+
+	prices, err := f.FetchMultiplePrices(context.Background(), "usd", "bitcoin", "ethereum", "dogecoin", "unknown-coin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prices) != 3 || prices["bitcoin"] != 50000 || prices["ethereum"] != 2000 || prices["dogecoin"] != 0.1 {
+		t.Errorf("unexpected prices: %v", prices)
+	}
+}
+
+func TestFailover_ServerErrors(t *testing.T) {
+	ctx := context.Background()
+	down := &stubAPI{err: customerrors.NewAPIError("stub", 503, errors.New("unavailable"))}
+	up := &stubAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	f := NewFailover(Provider{Name: "down", API: down}, Provider{Name: "up", API: up})
+	if price, err := f.FetchPrice(ctx, "bitcoin", "usd"); err != nil || price != 50000 {
+		t.Errorf("expected failover on a 5xx, got %v (%v)", price, err)
+	}
+
+	f = NewFailover(Provider{Name: "down", API: down}, Provider{Name: "limited", API: &stubAPI{err: rateLimited}})
+	_, err := f.FetchMultiplePrices(ctx, "usd", "bitcoin")
+	if !errors.Is(err, customerrors.ErrRateLimitExceeded) {
+		t.Errorf("expected the providers' errors when all fail, got %v", err)
+	}
+}
+
+func TestFailover_ClientErrorsAreReturned(t *testing.T) {
+	bad := &stubAPI{err: customerrors.NewAPIError("stub", 400, errors.New("bad request"))}
+	backup := &stubAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	f := NewFailover(Provider{Name: "bad", API: bad}, Provider{Name: "backup", API: backup})
+	if _, err := f.FetchPrice(context.Background(), "bitcoin", "usd"); err == nil || backup.calls != 0 {
+		t.Errorf("expected a 4xx to be returned without failover, got %v after %d backup calls", err, backup.calls)
+	}
+}
+
+func TestFailover_GetSupportedCoins(t *testing.T) {
+	f := NewFailover(
+		Provider{Name: "down", API: &stubAPI{err: errors.New("unreachable")}},
+		Provider{Name: "exchange", API: &stubAPI{coins: map[string]string{"XBT": "XBT", "ETH": "ETH", "FOO": "FOO"}}, IDs: KrakenSymbols, MappedOnly: true},
+	)
+
+	coins, err := f.GetSupportedCoins(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(coins) != 2 || coins["bitcoin"] != "XBT" || coins["ethereum"] != "ETH" {
+		t.Errorf("expected coins under the tracker's IDs, got %v", coins)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// getJSON fetches url and decodes the JSON response into out. Rate limiting
+// is reported as ErrRateLimitExceeded, including Binance's 418 for clients
+// that ignored an earlier 429.
+func getJSON(ctx context.Context, client *http.Client, endpoint, url string, header http.Header, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return customerrors.NewAPIError(endpoint, 0, err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return customerrors.NewAPIError(endpoint, 0, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		return customerrors.NewAPIError(endpoint, resp.StatusCode, customerrors.ErrRateLimitExceeded)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return customerrors.NewAPIError(endpoint, resp.StatusCode, errors.New("request failed"))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return customerrors.NewAPIError(endpoint, 0, fmt.Errorf("failed to read response: %w", err))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return customerrors.NewAPIError(endpoint, 0, fmt.Errorf("failed to parse JSON: %w", err))
+	}
+	return nil
+}
+
+// quotedFloat decodes numbers that providers send as JSON strings to keep
+// their precision. Null decodes as zero.
+type quotedFloat float64
+
+func (f *quotedFloat) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*f = 0
+		return nil
+	}
+	if len(data) > 1 && data[0] == '"' {
+		data = data[1 : len(data)-1]
+	}
+	v, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+	*f = quotedFloat(v)
+	return nil
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultKrakenURL = "https://api.kraken.com"
+
+// krakenMaxInFlight caps the per-coin ticker requests FetchMultiplePrices
+// has open at once, keeping a large portfolio under Kraken's rate limit.
+const krakenMaxInFlight = 4
+
+// KrakenSymbols maps coin IDs to Kraken's asset names, which are the usual
+// ticker symbols except for a few legacy ones.
+var KrakenSymbols = func() map[string]string {
+	symbols := maps.Clone(Symbols)
+	symbols["bitcoin"] = "XBT"
+	symbols["dogecoin"] = "XDG"
+	return symbols
+}()
+
+// Kraken prices coins from the exchange's public ticker. Coins are
+// identified by Kraken's asset name, e.g. "XBT".
+type Kraken struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewKraken() *Kraken {
+	url := os.Getenv("KRAKEN_URL")
+	if url == "" {
+		url = defaultKrakenURL
+	}
+
+	return &Kraken{
+		BaseURL: strings.TrimSuffix(url, "/"),
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// krakenError converts the errors Kraken reports in a 200 response body.
+func krakenError(endpoint string, msgs []string) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	msg := strings.Join(msgs, "; ")
+	switch {
+	case strings.Contains(msg, "Rate limit"), strings.Contains(msg, "Too many requests"):
+		return customerrors.NewAPIError(endpoint, http.StatusTooManyRequests, customerrors.ErrRateLimitExceeded)
+	case strings.Contains(msg, "Unknown asset pair"):
+		return customerrors.NewAPIError(endpoint, 0, customerrors.ErrPriceNotAvailable)
+	case strings.HasPrefix(msg, "EService:"):
+		return customerrors.NewAPIError(endpoint, http.StatusServiceUnavailable, errors.New(msg))
+	default:
+		return customerrors.NewAPIError(endpoint, 0, errors.New(msg))
+	}
+}
+
+func (k *Kraken) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	quote := strings.ToUpper(vsCurrency)
+	if quote == "BTC" {
+		quote = "XBT"
+	}
+
+	var resp struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Close []quotedFloat `json:"c"`
+		} `json:"result"`
+	}
+	url := fmt.Sprintf("%s/0/public/Ticker?pair=%s%s", k.BaseURL, strings.ToUpper(coinID), quote)
+	if err := getJSON(ctx, k.Client, "public/Ticker", url, nil, &resp); err != nil {
+		return 0, err
+	}
+	if err := krakenError("public/Ticker", resp.Error); err != nil {
+		return 0, err
+	}
+
+	// The result is keyed by Kraken's canonical pair name, which need not
+	// match the one asked for.
+	for _, t := range resp.Result {
+		if len(t.Close) > 0 && t.Close[0] > 0 {
+			return float64(t.Close[0]), nil
+		}
+	}
+	return 0, customerrors.NewAPIError("public/Ticker", 0, customerrors.ErrPriceNotAvailable)
+}
+
+// FetchMultiplePrices asks for each coin separately, since Kraken rejects a
+// whole request if any pair in it is unknown. Coins Kraken does not list are
+// left out; other failures are returned only when no price was found.
+func (k *Kraken) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	if len(coinIDs) == 0 {
+		return nil, customerrors.NewValidationError("coinIDs", coinIDs, customerrors.ErrEmptyHoldings)
+	}
+
+	vsCurrency, err := currency.Normalize(vsCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		coinID string
+		price  float64
+		err    error
+	}
+
+	ch := make(chan result, len(coinIDs))
+	sem := make(chan struct{}, krakenMaxInFlight)
+	var wg sync.WaitGroup
+
+	for _, id := range coinIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			p, err := k.FetchPrice(ctx, id, vsCurrency)
+			ch <- result{coinID: id, price: p, err: err}
+		}()
+	}
+
+	wg.Wait()
+	close(ch)
+
+	prices := make(map[string]float64, len(coinIDs))
+	var firstErr error
+	for r := range ch {
+		switch {
+		case r.err == nil:
+			prices[r.coinID] = r.price
+		case !errors.Is(r.err, customerrors.ErrPriceNotAvailable) && firstErr == nil:
+			firstErr = r.err
+		}
+	}
+	if len(prices) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return prices, nil
+}
+
+func (k *Kraken) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	var resp struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			Altname string `json:"altname"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, k.Client, "public/Assets", k.BaseURL+"/0/public/Assets", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to fetch supported coins: %w", err)
+	}
+	if err := krakenError("public/Assets", resp.Error); err != nil {
+		return nil, fmt.Errorf("failed to fetch supported coins: %w", err)
+	}
+
+	coins := make(map[string]string, len(resp.Result))
+	for _, a := range resp.Result {
+		coins[a.Altname] = a.Altname
+	}
+	return coins, nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewFromEnv builds the price providers named in PRICE_PROVIDERS, highest
+// priority first, e.g. "coingecko,coincap,kraken". It defaults to CoinGecko
+// alone, which is returned as is. Several providers are combined by failover
+// unless PRICE_MODE is "consensus", in which case PRICE_MAX_DEVIATION sets
+// the percentage beyond which a provider's price is ignored.
+//
+// The result is wrapped in a Cache keeping prices for PRICE_CACHE_TTL and
+// serving them stale for PRICE_CACHE_STALE after that; a TTL of 0 turns the
+// cache off. PRICE_CACHE_COIN_TTLS overrides the TTL for individual coins,
+// e.g. "tether=1h,usd-coin=1h".
+func NewFromEnv() (CryptoApi, error) {
+	apiClient, err := providersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := durationFromEnv("PRICE_CACHE_TTL", DefaultCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	staleFor, err := durationFromEnv("PRICE_CACHE_STALE", DefaultCacheStale)
+	if err != nil {
+		return nil, err
+	}
+	coinTTLs, err := coinTTLsFromEnv("PRICE_CACHE_COIN_TTLS")
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		return apiClient, nil
+	}
+	cache := NewCache(apiClient, ttl, staleFor)
+	cache.CoinTTLs = coinTTLs
+	return cache, nil
+}
+
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback, nil
+	}
+	return parseDuration(key, v)
+}
+
+func parseDuration(key, v string) (time.Duration, error) {
+	if v == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, customerrors.NewValidationError(key, v, errors.New("must be a duration such as 30s"))
+	}
+	return d, nil
+}
+
+// coinTTLsFromEnv parses a list of coin=duration pairs, returning nil when
+// the variable is unset.
+func coinTTLsFromEnv(key string) (map[string]time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return nil, nil
+	}
+
+	ttls := make(map[string]time.Duration)
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		coinID, d, ok := strings.Cut(pair, "=")
+		coinID = strings.ToLower(strings.TrimSpace(coinID))
+		if !ok || coinID == "" {
+			return nil, customerrors.NewValidationError(key, pair, errors.New("must be coin=duration pairs such as tether=1h"))
+		}
+		ttl, err := parseDuration(key, strings.TrimSpace(d))
+		if err != nil {
+			return nil, err
+		}
+		ttls[coinID] = ttl
+	}
+	return ttls, nil
+}
+
+func providersFromEnv() (CryptoApi, error) {
+	names := os.Getenv("PRICE_PROVIDERS")
+	if strings.TrimSpace(names) == "" {
+		names = "coingecko"
+	}
+
+	var providers []Provider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case "coingecko":
+			cg, err := NewCoinGecko()
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, Provider{Name: name, API: cg})
+		case "coincap":
+			providers = append(providers, Provider{Name: name, API: NewCoinCap(), IDs: CoinCapIDs})
+		case "binance":
+			providers = append(providers, Provider{Name: name, API: NewBinance(), IDs: Symbols, MappedOnly: true})
+		case "kraken":
+			providers = append(providers, Provider{Name: name, API: NewKraken(), IDs: KrakenSymbols, MappedOnly: true})
+		default:
+			return nil, customerrors.NewValidationError("PRICE_PROVIDERS", name, errors.New("unknown price provider"))
+		}
+	}
+
+	if len(providers) == 0 {
+		return nil, customerrors.NewValidationError("PRICE_PROVIDERS", names, errors.New("no price provider named"))
+	}
+
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("PRICE_MODE"))); mode {
+	case "", "failover":
+		if len(providers) == 1 && providers[0].IDs == nil {
+			return providers[0].API, nil
+		}
+		return NewFailover(providers...), nil
+	case "consensus":
+		if len(providers) < 2 {
+			return nil, customerrors.NewValidationError("PRICE_PROVIDERS", names, errors.New("consensus needs at least two price providers"))
+		}
+		maxDeviation := DefaultMaxDeviation
+		if v := os.Getenv("PRICE_MAX_DEVIATION"); v != "" {
+			d, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+			if err != nil || d <= 0 {
+				return nil, customerrors.NewValidationError("PRICE_MAX_DEVIATION", v, errors.New("must be a positive percentage"))
+			}
+			maxDeviation = d
+		}
+		return NewConsensus(maxDeviation, providers...), nil
+	default:
+		return nil, customerrors.NewValidationError("PRICE_MODE", mode, errors.New("must be failover or consensus"))
+	}
+}
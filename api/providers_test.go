@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCoinCap_ConvertsFromUSD(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("expected API key to be sent, got %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/assets":
+			if got := r.URL.Query().Get("ids"); got != "bitcoin,xrp" && got != "xrp" {
+				t.Errorf("unexpected ids %q", got)
+			}
+			fmt.Fprint(w, `{"data":[{"id":"bitcoin","name":"Bitcoin","priceUsd":"50000.00","changePercent24Hr":"2.5","volumeUsd24Hr":null,"marketCapUsd":"1000000"}]}`)
+		case "/rates":
+			fmt.Fprint(w, `{"data":[{"symbol":"GBP","rateUsd":"1.25"},{"symbol":"EUR","rateUsd":"1.0869565"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	cc := &CoinCap{BaseURL: srv.URL, APIKey: "key", Client: srv.Client()}
+
+	data, err := cc.FetchMarketData(context.Background(), "gbp", "bitcoin", "xrp")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 1 || data["bitcoin"].Price != 40000 || data["bitcoin"].Change24h != 2.5 || data["bitcoin"].MarketCap != 800000 {
+		t.Errorf("unexpected market data: %+v", data)
+	}
+	if _, err := cc.FetchPrice(context.Background(), "xrp", "usd"); !errors.Is(err, customerrors.ErrPriceNotAvailable) {
+		t.Errorf("expected ErrPriceNotAvailable for an unlisted coin, got %v", err)
+	}
+}
+
+func TestBinance_FetchMultiplePrices(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"symbol":"BTCUSDT","price":"50000.10"},{"symbol":"ETHUSDT","price":"2000"},{"symbol":"BTCEUR","price":"46000"}]`)
+	})
+	b := &Binance{BaseURL: srv.URL, Client: srv.Client()}
+
+	prices, err := b.FetchMultiplePrices(context.Background(), "usd", "BTC", "ETH", "NOPE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prices) != 2 || prices["BTC"] != 50000.10 || prices["ETH"] != 2000 {
+		t.Errorf("unexpected prices: %v", prices)
+	}
+	if p, err := b.FetchPrice(context.Background(), "BTC", "eur"); err != nil || p != 46000 {
+		t.Errorf("expected the EUR market, got %v (%v)", p, err)
+	}
+}
+
+func TestBinance_RateLimited(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	b := &Binance{BaseURL: srv.URL, Client: srv.Client()}
+
+	if _, err := b.FetchPrice(context.Background(), "BTC", "usd"); !errors.Is(err, customerrors.ErrRateLimitExceeded) {
+		t.Errorf("expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestKraken_FetchMultiplePrices(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("pair") {
+		case "XBTUSD":
+			fmt.Fprint(w, `{"error":[],"result":{"XXBTZUSD":{"c":["50000.0","0.01"]}}}`)
+		case "ETHUSD":
+			fmt.Fprint(w, `{"error":[],"result":{"XETHZUSD":{"c":["2000.5","1.2"]}}}`)
+		default:
+			fmt.Fprint(w, `{"error":["EQuery:Unknown asset pair"]}`)
+		}
+	})
+	k := &Kraken{BaseURL: srv.URL, Client: srv.Client()}
+
+	prices, err := k.FetchMultiplePrices(context.Background(), "usd", "XBT", "ETH", "NOPE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prices) != 2 || prices["XBT"] != 50000 || prices["ETH"] != 2000.5 {
+		t.Errorf("unexpected prices: %v", prices)
+	}
+}
+
+func TestKraken_LimitsConcurrentRequests(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `{"error":["EQuery:Unknown asset pair"]}`)
+	})
+	k := &Kraken{BaseURL: srv.URL, Client: srv.Client()}
+
+	coins := make([]string, 20)
+	for i := range coins {
+		coins[i] = fmt.Sprintf("C%d", i)
+	}
+	if _, err := k.FetchMultiplePrices(context.Background(), "usd", coins...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := peak.Load(); got > krakenMaxInFlight {
+		t.Errorf("expected at most %d requests in flight, saw %d", krakenMaxInFlight, got)
+	}
+}
+
+func TestKraken_ErrorsInBody(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"error":["EAPI:Rate limit exceeded"]}`)
+	})
+	k := &Kraken{BaseURL: srv.URL, Client: srv.Client()}
+
+	if _, err := k.FetchMultiplePrices(context.Background(), "usd", "XBT"); !errors.Is(err, customerrors.ErrRateLimitExceeded) {
+		t.Errorf("expected ErrRateLimitExceeded, got %v", err)
+	}
+}
+
+func TestQuotedFloat(t *testing.T) {
+	for in, want := range map[string]float64{`"1.5"`: 1.5, `2`: 2, `null`: 0} {
+		var f quotedFloat
+		if err := f.UnmarshalJSON([]byte(in)); err != nil || math.Abs(float64(f)-want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v (%v)", in, want, f, err)
+		}
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv("PRICE_PROVIDERS", "kraken, binance")
+	t.Setenv("PRICE_CACHE_COIN_TTLS", "Tether=1h, usd-coin=30m")
+	cryptoAPI, err := NewFromEnv()
+	c, ok := cryptoAPI.(*Cache)
+	if err != nil || !ok || c.TTL != DefaultCacheTTL {
+		t.Fatalf("expected the providers behind a cache, got %+v (%v)", cryptoAPI, err)
+	}
+	if len(c.CoinTTLs) != 2 || c.CoinTTLs["tether"] != time.Hour || c.CoinTTLs["usd-coin"] != 30*time.Minute {
+		t.Errorf("unexpected per-coin TTLs: %v", c.CoinTTLs)
+	}
+
+	t.Setenv("PRICE_CACHE_COIN_TTLS", "tether")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("expected a per-coin TTL without a duration to be rejected")
+	}
+	t.Setenv("PRICE_CACHE_COIN_TTLS", "")
+
+	t.Setenv("PRICE_CACHE_TTL", "0")
+	cryptoAPI, err = NewFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, ok := cryptoAPI.(*Failover)
+	if !ok || len(f.Providers) != 2 || f.Providers[0].Name != "kraken" || f.Providers[1].Name != "binance" {
+		t.Errorf("expected kraken then binance, got %+v", cryptoAPI)
+	}
+
+	t.Setenv("PRICE_MODE", "consensus")
+	t.Setenv("PRICE_MAX_DEVIATION", "1.5%")
+	cryptoAPI, err = NewFromEnv()
+	if c, ok := cryptoAPI.(*Consensus); err != nil || !ok || c.MaxDeviation != 1.5 || len(c.Providers) != 2 {
+		t.Errorf("expected a consensus of both providers, got %+v (%v)", cryptoAPI, err)
+	}
+
+	t.Setenv("PRICE_PROVIDERS", "kraken")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("expected consensus of a single provider to be rejected")
+	}
+
+	t.Setenv("PRICE_MODE", "")
+	t.Setenv("PRICE_PROVIDERS", "coinbase")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("expected an unknown provider to be rejected")
+	}
+
+	t.Setenv("PRICE_PROVIDERS", "kraken")
+	t.Setenv("PRICE_CACHE_TTL", "soon")
+	if _, err := NewFromEnv(); err == nil {
+		t.Error("expected an invalid cache TTL to be rejected")
+	}
+}
@@ -3,26 +3,24 @@ package auth
 import (
 	"bufio"
 	"context"
+	"crypto-portfolio-tracker/currency"
 	"crypto-portfolio-tracker/db"
 	"crypto-portfolio-tracker/email"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/notify"
+	"crypto-portfolio-tracker/outbox"
+	"crypto-portfolio-tracker/portfolio"
+	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-
 	"golang.org/x/crypto/bcrypt"
 )
 
-type User struct {
-	Email    string `bson:"email"`
-	Password string `bson:"password"`
-	Verified bool   `bson:"verified"`
-	OTP      string `bson:"otp"`
-}
-
 func generateOTP() string {
 	rand.Seed(time.Now().UnixNano())
 	return fmt.Sprintf("%06d", rand.Intn(1000000))
@@ -41,33 +39,34 @@ func checkPassword(hashedPassword, password string) bool {
 	return err == nil
 }
 
-func Signup(userEmail, password string, reader *bufio.Reader) bool {
-	database, err := db.ConnectDatabase()
-	if err != nil {
-		fmt.Println("Database connection failed:", err)
-		return false
-	}
-
-	collection := database.Collection("users")
-
-	var existingUser User
-	err = collection.FindOne(
-		context.TODO(),
-		bson.M{"email": userEmail},
-	).Decode(&existingUser)
-
+func Signup(ctx context.Context, store db.Store, userEmail, password string, reader *bufio.Reader) bool {
+	_, err := store.Users().FindByEmail(ctx, userEmail)
 	if err == nil {
 		fmt.Println("Account already exists with this email.")
 		return false
 	}
 
-	if err != mongo.ErrNoDocuments {
+	if !errors.Is(err, customerrors.ErrNotFound) {
 		fmt.Println("Database error:", err)
 		return false
 	}
 
 	otp := generateOTP()
-	email.SendOTP(userEmail, otp)
+	content, err := email.RenderOTP(nil, email.OTPData{Email: userEmail, OTP: otp, ValidFor: outbox.OTPValidFor})
+	if err != nil {
+		fmt.Println("Could not render OTP email:", err)
+		return false
+	}
+	msg := outbox.NewMessage(models.OutboxOTP, userEmail, content)
+	if err := outbox.Enqueue(ctx, store, msg); err != nil {
+		fmt.Println("Could not queue OTP email:", err)
+		return false
+	}
+	if err := outbox.Deliver(ctx, store, msg.ID); err != nil {
+		fmt.Println("Error sending OTP email, it will be retried:", err)
+	} else {
+		fmt.Println("OTP sent to", userEmail)
+	}
 
 	fmt.Print("Enter OTP: ")
 	inputOTP, err := reader.ReadString('\n')
@@ -87,15 +86,14 @@ func Signup(userEmail, password string, reader *bufio.Reader) bool {
 		return false
 	}
 
-	user := User{
+	user := models.User{
 		Email:    userEmail,
 		Password: hashedPassword,
 		Verified: true,
 		OTP:      "",
 	}
 
-	_, err = collection.InsertOne(context.TODO(), user)
-	if err != nil {
+	if err := store.Users().Create(ctx, &user); err != nil {
 		fmt.Println("Signup failed:", err)
 		return false
 	}
@@ -104,18 +102,14 @@ func Signup(userEmail, password string, reader *bufio.Reader) bool {
 	return true
 }
 
-func Login(email, password string) bool {
-	database, err := db.ConnectDatabase()
+func Login(ctx context.Context, store db.Store, email, password string) bool {
+	u, err := store.Users().FindByEmail(ctx, email)
 	if err != nil {
-		fmt.Println("Database connection failed:", err)
+		if !errors.Is(err, customerrors.ErrNotFound) {
+			fmt.Println("Database error:", err)
+		}
 		return false
 	}
-	var u User
-
-	database.Collection("users").FindOne(
-		context.TODO(),
-		map[string]string{"email": email},
-	).Decode(&u)
 
 	if !u.Verified {
 		fmt.Println("Email not verified")
@@ -128,3 +122,120 @@ func Login(email, password string) bool {
 	}
 	return false
 }
+
+func GetPreferredCurrency(ctx context.Context, store db.Store, userEmail string) (string, error) {
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return "", err
+	}
+
+	return currency.OrDefault(u.Currency), nil
+}
+
+func SetPreferredCurrency(ctx context.Context, store db.Store, userEmail, code string) error {
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return err
+	}
+
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+	if err := portfolio.CheckCurrency(ctx, store, userEmail, code); err != nil {
+		return err
+	}
+
+	u.Currency = code
+	return store.Users().Update(ctx, u)
+}
+
+// GetNotificationChannels returns where the user's alerts are delivered,
+// defaulting to email.
+func GetNotificationChannels(ctx context.Context, store db.Store, userEmail string) ([]models.NotificationChannel, error) {
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Channels) == 0 {
+		return notify.DefaultChannels, nil
+	}
+	return u.Channels, nil
+}
+
+func SetNotificationChannels(ctx context.Context, store db.Store, userEmail string, channels []models.NotificationChannel) error {
+	if len(channels) == 0 {
+		return customerrors.NewValidationError("channels", channels, errors.New("at least one notification channel is required"))
+	}
+	for _, ch := range channels {
+		if _, err := notify.New(store, ch); err != nil {
+			return err
+		}
+	}
+
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	u.Channels = channels
+	return store.Users().Update(ctx, u)
+}
+
+// GetEmailTemplate returns the user's override for kind, or the built-in
+// template when they have none; custom reports which one it is.
+func GetEmailTemplate(ctx context.Context, store db.Store, userEmail string, kind models.TemplateKind) (t models.EmailTemplate, custom bool, err error) {
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return t, false, err
+	}
+
+	if override := u.EmailTemplate(kind); override != nil {
+		return *override, true, nil
+	}
+	t, err = email.Builtin(kind)
+	return t, false, err
+}
+
+// SetEmailTemplate validates t by rendering it against sample data and then
+// stores it as the user's override for t.Kind.
+func SetEmailTemplate(ctx context.Context, store db.Store, userEmail string, t models.EmailTemplate) error {
+	if !slices.Contains(models.CustomizableTemplates, t.Kind) {
+		return customerrors.NewValidationError("template kind", t.Kind, fmt.Errorf("%w: only alert and report emails can be customized", customerrors.ErrInvalidTemplate))
+	}
+	if err := email.ValidateTemplate(t); err != nil {
+		return err
+	}
+
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	t.UpdatedAt = time.Now()
+	if existing := u.EmailTemplate(t.Kind); existing != nil {
+		*existing = t
+	} else {
+		u.EmailTemplates = append(u.EmailTemplates, t)
+	}
+	return store.Users().Update(ctx, u)
+}
+
+// ResetEmailTemplate removes the user's override for kind, restoring the
+// built-in template.
+func ResetEmailTemplate(ctx context.Context, store db.Store, userEmail string, kind models.TemplateKind) error {
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	templates := u.EmailTemplates[:0]
+	for _, t := range u.EmailTemplates {
+		if t.Kind != kind {
+			templates = append(templates, t)
+		}
+	}
+	u.EmailTemplates = templates
+	return store.Users().Update(ctx, u)
+}
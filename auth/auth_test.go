@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/portfolio"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetPreferredCurrency_RefusedWhileLedgerInOtherCurrency(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	const user = "test@example.com"
+
+	if err := store.Users().Create(ctx, &models.User{Email: user}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := SetPreferredCurrency(ctx, store, user, "EUR"); err != nil {
+		t.Fatalf("expected a user with no transactions to switch, got %v", err)
+	}
+	if err := SetPreferredCurrency(ctx, store, user, "usd"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := portfolio.AddMultipleHoldings(ctx, store, user,
+		models.Holding{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, BuyPrice: 30000, Currency: "usd", AddedAt: time.Now()},
+	)
+	if err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	if err := SetPreferredCurrency(ctx, store, user, "eur"); !errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		t.Fatalf("expected ErrCurrencyMismatch, got %v", err)
+	}
+
+	code, err := GetPreferredCurrency(ctx, store, user)
+	if err != nil || code != "usd" {
+		t.Fatalf("expected the currency to stay usd, got %q (%v)", code, err)
+	}
+	report, err := portfolio.GenerateProfitLossReport(ctx, store, user, api.StaticPrices{"bitcoin": 45000}, code)
+	if err != nil {
+		t.Fatalf("expected the report to keep working, got %v", err)
+	}
+	if report.Currency != "usd" {
+		t.Errorf("expected a usd report, got %+v", report)
+	}
+}
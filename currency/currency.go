@@ -0,0 +1,97 @@
+package currency
+
+import (
+	customerrors "crypto-portfolio-tracker/errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the quote currency used for accounts that never chose one.
+const Default = "usd"
+
+type info struct {
+	symbol   string
+	decimals int
+}
+
+var supported = map[string]info{
+	"usd": {"$", 2},
+	"eur": {"€", 2},
+	"gbp": {"£", 2},
+	"inr": {"₹", 2},
+	"jpy": {"¥", 0},
+	"aud": {"A$", 2},
+	"cad": {"C$", 2},
+	"chf": {"CHF ", 2},
+	"btc": {"₿", 8},
+	"eth": {"Ξ", 6},
+}
+
+func Normalize(code string) (string, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return Default, nil
+	}
+	if _, ok := supported[code]; !ok {
+		return "", customerrors.NewValidationError("currency", code, customerrors.ErrUnsupportedCurrency)
+	}
+	return code, nil
+}
+
+// OrDefault maps an empty code, as stored on records that predate currency
+// support, to Default.
+func OrDefault(code string) string {
+	if code == "" {
+		return Default
+	}
+	return strings.ToLower(code)
+}
+
+// Equal reports whether two stored codes name the same currency, treating an
+// empty code as Default.
+func Equal(a, b string) bool {
+	return OrDefault(a) == OrDefault(b)
+}
+
+func Supported() []string {
+	codes := make([]string, 0, len(supported))
+	for code := range supported {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func Symbol(code string) string {
+	if i, ok := supported[OrDefault(code)]; ok {
+		return i.symbol
+	}
+	return strings.ToUpper(code) + " "
+}
+
+func Decimals(code string) int {
+	if i, ok := supported[OrDefault(code)]; ok {
+		return i.decimals
+	}
+	return 2
+}
+
+// Format renders an amount with the currency's symbol and precision,
+// e.g. "$1234.50", "¥98000", "-€12.00".
+func Format(amount float64, code string) string {
+	s := Symbol(code) + strconv.FormatFloat(math.Abs(amount), 'f', Decimals(code), 64)
+	if amount < 0 {
+		return "-" + s
+	}
+	return s
+}
+
+// FormatSigned is Format with an explicit "+" for non-negative amounts.
+func FormatSigned(amount float64, code string) string {
+	if amount < 0 {
+		return Format(amount, code)
+	}
+	return "+" + Format(amount, code)
+}
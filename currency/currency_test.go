@@ -0,0 +1,53 @@
+package currency
+
+import (
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{"": Default, " EUR ": "eur", "jpy": "jpy", "BTC": "btc"} {
+		got, err := Normalize(in)
+		if err != nil || got != want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := Normalize("xyz"); !errors.Is(err, customerrors.ErrUnsupportedCurrency) {
+		t.Errorf("expected ErrUnsupportedCurrency, got %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, tt := range []struct {
+		amount float64
+		code   string
+		want   string
+	}{
+		{1234.5, "usd", "$1234.50"},
+		{98000.4, "jpy", "¥98000"},
+		{0.123456789, "btc", "₿0.12345679"},
+		{-12, "eur", "-€12.00"},
+		{5, "", "$5.00"},
+	} {
+		if got := Format(tt.amount, tt.code); got != tt.want {
+			t.Errorf("Format(%v, %q) = %q, want %q", tt.amount, tt.code, got, tt.want)
+		}
+	}
+	if got := FormatSigned(3, "gbp"); got != "+£3.00" {
+		t.Errorf("FormatSigned = %q, want +£3.00", got)
+	}
+}
+
+func TestDecimals(t *testing.T) {
+	if Decimals("jpy") != 0 || Decimals("BTC") != 8 || Decimals("usd") != 2 || Decimals("xyz") != 2 {
+		t.Errorf("unexpected decimals: jpy %d, btc %d, usd %d, unknown %d",
+			Decimals("jpy"), Decimals("BTC"), Decimals("usd"), Decimals("xyz"))
+	}
+}
+
+func TestEqual(t *testing.T) {
+	if !Equal("", "usd") || !Equal("EUR", "eur") || Equal("usd", "eur") {
+		t.Error("expected empty codes to mean USD and case to be ignored")
+	}
+}
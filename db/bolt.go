@@ -0,0 +1,549 @@
+package db
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var boltBuckets = []string{"users", "portfolios", "watchlists", "transactions", "alerts", "alert_events", "outbox"}
+
+// BoltStore persists every collection to a single local bbolt file. Records
+// are BSON-encoded so field names match the MongoDB documents exactly.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	bdb, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		// bbolt holds an exclusive lock on the file while it is open.
+		return nil, fmt.Errorf("%s is in use by another process; use MongoDB to run the scheduler alongside the CLI: %w", path, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		bdb.Close()
+		return nil, fmt.Errorf("error creating buckets in %s: %w", path, err)
+	}
+
+	return &BoltStore{db: bdb}, nil
+}
+
+// Ping fails once the file has been closed.
+func (s *BoltStore) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.db.View(func(*bolt.Tx) error { return nil }); err != nil {
+		return customerrors.NewDatabaseError("ping", s.db.Path(), err)
+	}
+	return nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Users() UserRepository               { return boltUsers{s} }
+func (s *BoltStore) Portfolios() PortfolioRepository     { return boltPortfolios{s} }
+func (s *BoltStore) Watchlists() WatchlistRepository     { return boltWatchlists{s} }
+func (s *BoltStore) Transactions() TransactionRepository { return boltTransactions{s} }
+func (s *BoltStore) Alerts() AlertRepository             { return boltAlerts{s} }
+func (s *BoltStore) AlertEvents() AlertEventRepository   { return boltAlertEvents{s} }
+func (s *BoltStore) Outbox() OutboxRepository            { return boltOutbox{s} }
+
+func (s *BoltStore) get(bucket, key string, out interface{}) (bool, error) {
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(bucket)).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return bson.Unmarshal(data, out)
+	})
+	return found, err
+}
+
+func (s *BoltStore) put(tx *bolt.Tx, bucket, key string, v interface{}) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(bucket)).Put([]byte(key), data)
+}
+
+// scan hands every raw record in bucket to fn, in key order.
+func (s *BoltStore) scan(bucket string, fn func(data []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(_, data []byte) error {
+			return fn(data)
+		})
+	})
+}
+
+type boltUsers struct{ s *BoltStore }
+
+func (r boltUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var u models.User
+	found, err := r.s.get("users", email, &u)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("fetch", "users", err)
+	}
+	if !found {
+		return nil, customerrors.NewDatabaseError("fetch", "users", customerrors.ErrNotFound)
+	}
+	return &u, nil
+}
+
+func (r boltUsers) Create(ctx context.Context, user *models.User) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("users")).Get([]byte(user.Email)) != nil {
+			return customerrors.ErrEmailExists
+		}
+		return r.s.put(tx, "users", user.Email, user)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("insert", "users", err)
+	}
+	return nil
+}
+
+func (r boltUsers) Update(ctx context.Context, user *models.User) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("users")).Get([]byte(user.Email)) == nil {
+			return customerrors.ErrNotFound
+		}
+		return r.s.put(tx, "users", user.Email, user)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "users", err)
+	}
+	return nil
+}
+
+// updateUser applies fn to the stored user inside one transaction.
+func (r boltUsers) updateUser(email string, fn func(u *models.User) error) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("users")).Get([]byte(email))
+		if data == nil {
+			return customerrors.ErrNotFound
+		}
+		var u models.User
+		if err := bson.Unmarshal(data, &u); err != nil {
+			return err
+		}
+		if err := fn(&u); err != nil {
+			return err
+		}
+		return r.s.put(tx, "users", email, u)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "users", err)
+	}
+	return nil
+}
+
+func (r boltUsers) UpdateDigest(ctx context.Context, email string, s *models.DigestSettings) error {
+	return r.updateUser(email, func(u *models.User) error {
+		u.Digest = s
+		return nil
+	})
+}
+
+func (r boltUsers) RecordDigest(ctx context.Context, email string, periodEnd time.Time, prices map[string]float64, currency string) error {
+	return r.updateUser(email, func(u *models.User) error {
+		if u.Digest == nil || !periodEnd.After(u.Digest.LastPeriodEnd) {
+			return customerrors.ErrConflict
+		}
+		u.Digest.LastPeriodEnd = periodEnd
+		u.Digest.LastPrices = prices
+		u.Digest.LastCurrency = currency
+		return nil
+	})
+}
+
+func (r boltUsers) ListDigestSubscribers(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := r.s.scan("users", func(data []byte) error {
+		var u models.User
+		if err := bson.Unmarshal(data, &u); err != nil {
+			return err
+		}
+		if u.Digest.Enabled() {
+			users = append(users, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "users", err)
+	}
+	return users, nil
+}
+
+type boltPortfolios struct{ s *BoltStore }
+
+func (r boltPortfolios) Get(ctx context.Context, userEmail string) (*models.Portfolio, error) {
+	var p models.Portfolio
+	found, err := r.s.get("portfolios", userEmail, &p)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("fetch", "portfolios", err)
+	}
+	if !found {
+		return nil, customerrors.NewDatabaseError("fetch", "portfolios", customerrors.ErrNotFound)
+	}
+	return &p, nil
+}
+
+func (r boltPortfolios) Save(ctx context.Context, p *models.Portfolio) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		return r.s.put(tx, "portfolios", p.UserEmail, p)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "portfolios", err)
+	}
+	return nil
+}
+
+type boltWatchlists struct{ s *BoltStore }
+
+func (r boltWatchlists) Get(ctx context.Context, userEmail string) (*models.Watchlist, error) {
+	var w models.Watchlist
+	found, err := r.s.get("watchlists", userEmail, &w)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("fetch", "watchlists", err)
+	}
+	if !found {
+		return nil, customerrors.NewDatabaseError("fetch", "watchlists", customerrors.ErrNotFound)
+	}
+	return &w, nil
+}
+
+func (r boltWatchlists) Save(ctx context.Context, w *models.Watchlist) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		return r.s.put(tx, "watchlists", w.UserEmail, w)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "watchlists", err)
+	}
+	return nil
+}
+
+type boltTransactions struct{ s *BoltStore }
+
+func (r boltTransactions) Insert(ctx context.Context, txs ...models.Transaction) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		for i := range txs {
+			if err := r.s.put(tx, "transactions", txs[i].ID, txs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("insert", "transactions", err)
+	}
+	return nil
+}
+
+func (r boltTransactions) List(ctx context.Context, userEmail string, coinIDs ...string) ([]models.Transaction, error) {
+	wanted := make(map[string]bool, len(coinIDs))
+	for _, id := range coinIDs {
+		wanted[id] = true
+	}
+
+	txs := []models.Transaction{}
+	err := r.s.scan("transactions", func(data []byte) error {
+		var t models.Transaction
+		if err := bson.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		if t.UserEmail == userEmail && (len(wanted) == 0 || wanted[t.CoinID]) {
+			txs = append(txs, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "transactions", err)
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].ExecutedAt.Before(txs[j].ExecutedAt)
+	})
+	return txs, nil
+}
+
+type boltAlerts struct{ s *BoltStore }
+
+func (r boltAlerts) Create(ctx context.Context, a *models.Alert) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		return r.s.put(tx, "alerts", a.ID, a)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("insert", "alerts", err)
+	}
+	return nil
+}
+
+func (r boltAlerts) listActive(match func(a *models.Alert) bool) ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := r.s.scan("alerts", func(data []byte) error {
+		var a models.Alert
+		if err := bson.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		if !a.Triggered && match(&a) {
+			alerts = append(alerts, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "alerts", err)
+	}
+	return alerts, nil
+}
+
+func (r boltAlerts) ListActive(ctx context.Context, userEmail string) ([]models.Alert, error) {
+	return r.listActive(func(a *models.Alert) bool { return a.UserEmail == userEmail })
+}
+
+func (r boltAlerts) ListAllActive(ctx context.Context) ([]models.Alert, error) {
+	return r.listActive(func(*models.Alert) bool { return true })
+}
+
+func (r boltAlerts) Update(ctx context.Context, a *models.Alert) error {
+	return r.UpdateWithOutbox(ctx, a, nil)
+}
+
+func (r boltAlerts) UpdateWithOutbox(ctx context.Context, a *models.Alert, events []models.AlertEvent, msgs ...models.OutboxMessage) error {
+	next := *a
+	next.Version++
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("alerts")).Get([]byte(a.ID))
+		if data == nil {
+			return customerrors.ErrNotFound
+		}
+		var stored models.Alert
+		if err := bson.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		if stored.Version != a.Version {
+			return customerrors.ErrConflict
+		}
+
+		if err := r.s.put(tx, "alerts", a.ID, next); err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := r.s.put(tx, "alert_events", e.ID, e); err != nil {
+				return err
+			}
+		}
+		for _, m := range msgs {
+			if err := r.s.put(tx, "outbox", m.ID, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "alerts", err)
+	}
+	a.Version = next.Version
+	return nil
+}
+
+func (r boltAlerts) Delete(ctx context.Context, userEmail, alertID string) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("alerts"))
+		data := bucket.Get([]byte(alertID))
+		if data == nil {
+			return customerrors.ErrNotFound
+		}
+		var a models.Alert
+		if err := bson.Unmarshal(data, &a); err != nil {
+			return err
+		}
+		if a.UserEmail != userEmail {
+			return customerrors.ErrNotFound
+		}
+		return bucket.Delete([]byte(alertID))
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("delete", "alerts", err)
+	}
+	return nil
+}
+
+type boltAlertEvents struct{ s *BoltStore }
+
+func (r boltAlertEvents) Insert(ctx context.Context, e *models.AlertEvent) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		return r.s.put(tx, "alert_events", e.ID, e)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("insert", "alert_events", err)
+	}
+	return nil
+}
+
+func (r boltAlertEvents) List(ctx context.Context, userEmail string, f AlertEventFilter) ([]models.AlertEvent, error) {
+	events := []models.AlertEvent{}
+	err := r.s.scan("alert_events", func(data []byte) error {
+		var e models.AlertEvent
+		if err := bson.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		if e.UserEmail == userEmail && f.Match(&e) {
+			events = append(events, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "alert_events", err)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].FiredAt.After(events[j].FiredAt)
+	})
+	return events, nil
+}
+
+func (r boltAlertEvents) SetDelivery(ctx context.Context, eventID string, status models.DeliveryStatus, deliveryErr string) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte("alert_events")).Get([]byte(eventID))
+		if data == nil {
+			return customerrors.ErrNotFound
+		}
+		var e models.AlertEvent
+		if err := bson.Unmarshal(data, &e); err != nil {
+			return err
+		}
+		e.Delivery = status
+		e.DeliveryError = deliveryErr
+		return r.s.put(tx, "alert_events", eventID, e)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "alert_events", err)
+	}
+	return nil
+}
+
+type boltOutbox struct{ s *BoltStore }
+
+func (r boltOutbox) Enqueue(ctx context.Context, msgs ...models.OutboxMessage) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		for _, m := range msgs {
+			if err := r.s.put(tx, "outbox", m.ID, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("insert", "outbox", err)
+	}
+	return nil
+}
+
+func (r boltOutbox) Claim(ctx context.Context, now, until time.Time, limit int, ids ...string) ([]models.OutboxMessage, error) {
+	var claimed []models.OutboxMessage
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("outbox"))
+		var due []models.OutboxMessage
+		consider := func(data []byte) error {
+			var m models.OutboxMessage
+			if err := bson.Unmarshal(data, &m); err != nil {
+				return err
+			}
+			if m.Status == models.OutboxPending && !m.NextAttemptAt.After(now) {
+				due = append(due, m)
+			}
+			return nil
+		}
+
+		if len(ids) > 0 {
+			for _, id := range ids {
+				if data := bucket.Get([]byte(id)); data != nil {
+					if err := consider(data); err != nil {
+						return err
+					}
+				}
+			}
+		} else if err := bucket.ForEach(func(_, data []byte) error { return consider(data) }); err != nil {
+			return err
+		}
+
+		sort.SliceStable(due, func(i, j int) bool {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		})
+		if limit > 0 && len(due) > limit {
+			due = due[:limit]
+		}
+		for i := range due {
+			due[i].NextAttemptAt = until
+			if err := r.s.put(tx, "outbox", due[i].ID, due[i]); err != nil {
+				return err
+			}
+		}
+		claimed = due
+		return nil
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("claim", "outbox", err)
+	}
+	return claimed, nil
+}
+
+func (r boltOutbox) Update(ctx context.Context, m *models.OutboxMessage) error {
+	err := r.s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("outbox")).Get([]byte(m.ID)) == nil {
+			return customerrors.ErrNotFound
+		}
+		return r.s.put(tx, "outbox", m.ID, m)
+	})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "outbox", err)
+	}
+	return nil
+}
+
+func (r boltOutbox) List(ctx context.Context, f OutboxFilter) ([]models.OutboxMessage, error) {
+	msgs := []models.OutboxMessage{}
+	err := r.s.scan("outbox", func(data []byte) error {
+		var m models.OutboxMessage
+		if err := bson.Unmarshal(data, &m); err != nil {
+			return err
+		}
+		if f.Match(&m) {
+			msgs = append(msgs, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "outbox", err)
+	}
+
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+	})
+	return msgs, nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltStore_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tracker.db")
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if err := store.Users().Create(ctx, &models.User{Email: "a@example.com", Password: "hash"}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if err := store.Users().Create(ctx, &models.User{Email: "a@example.com"}); !errors.Is(err, customerrors.ErrEmailExists) {
+		t.Errorf("expected ErrEmailExists, got: %v", err)
+	}
+	err = store.Transactions().Insert(ctx,
+		models.Transaction{ID: "2", UserEmail: "a@example.com", CoinID: "bitcoin", ExecutedAt: now},
+		models.Transaction{ID: "1", UserEmail: "a@example.com", CoinID: "bitcoin", ExecutedAt: now.Add(time.Hour)},
+		models.Transaction{ID: "3", UserEmail: "b@example.com", CoinID: "bitcoin", ExecutedAt: now},
+	)
+	if err != nil {
+		t.Fatalf("inserting transactions: %v", err)
+	}
+	if err := store.Alerts().Create(ctx, &models.Alert{ID: "x", UserEmail: "a@example.com", Triggered: true}); err != nil {
+		t.Fatalf("creating alert: %v", err)
+	}
+	for _, e := range []models.AlertEvent{
+		{ID: "e1", UserEmail: "a@example.com", CoinID: "bitcoin", FiredAt: now},
+		{ID: "e2", UserEmail: "a@example.com", CoinID: "bitcoin", FiredAt: now.Add(2 * time.Hour)},
+		{ID: "e3", UserEmail: "a@example.com", CoinID: "ethereum", FiredAt: now.Add(time.Hour)},
+	} {
+		if err := store.AlertEvents().Insert(ctx, &e); err != nil {
+			t.Fatalf("inserting alert event: %v", err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("closing store: %v", err)
+	}
+
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("reopening store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Users().FindByEmail(ctx, "a@example.com"); err != nil {
+		t.Errorf("expected persisted user, got: %v", err)
+	}
+	if _, err := store.Portfolios().Get(ctx, "a@example.com"); !errors.Is(err, customerrors.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got: %v", err)
+	}
+
+	txs, err := store.Transactions().List(ctx, "a@example.com")
+	if err != nil {
+		t.Fatalf("listing transactions: %v", err)
+	}
+	if len(txs) != 2 || txs[0].ID != "2" || !txs[0].ExecutedAt.Equal(now) {
+		t.Errorf("expected user's transactions ordered by executed_at, got %+v", txs)
+	}
+
+	alerts, err := store.Alerts().ListActive(ctx, "a@example.com")
+	if err != nil {
+		t.Fatalf("listing alerts: %v", err)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("expected triggered alert to be excluded, got %+v", alerts)
+	}
+	if err := store.Alerts().Delete(ctx, "b@example.com", "x"); !errors.Is(err, customerrors.ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting another user's alert, got: %v", err)
+	}
+
+	events, err := store.AlertEvents().List(ctx, "a@example.com", AlertEventFilter{CoinID: "bitcoin", To: now.Add(3 * time.Hour)})
+	if err != nil {
+		t.Fatalf("listing alert events: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != "e2" || events[1].ID != "e1" {
+		t.Errorf("expected bitcoin events most recent first, got %+v", events)
+	}
+}
+
+func TestBoltStore_RefusesSecondOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := NewBoltStore(path); err == nil {
+		t.Fatal("expected a second open of a locked file to fail")
+	}
+}
@@ -4,31 +4,147 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func ConnectDatabase() (*mongo.Database, error) {
+// Config controls the single MongoDB client shared by the whole process.
+type Config struct {
+	URI                    string
+	Database               string
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	OperationTimeout       time.Duration
+	// DisconnectTimeout bounds how long Close waits for in-flight
+	// operations before dropping the connections.
+	DisconnectTimeout time.Duration
+}
 
-	if err := godotenv.Load(); err != nil {
-		return nil, fmt.Errorf("error loading .env file: %w", err)
+func DefaultConfig() Config {
+	return Config{
+		Database:               "crypto_tracker",
+		MaxPoolSize:            20,
+		MinPoolSize:            0,
+		MaxConnIdleTime:        5 * time.Minute,
+		ConnectTimeout:         10 * time.Second,
+		ServerSelectionTimeout: 10 * time.Second,
+		OperationTimeout:       5 * time.Second,
+		DisconnectTimeout:      10 * time.Second,
 	}
+}
+
+// ConfigFromEnv reads MONGO_URI plus optional MONGO_DATABASE,
+// MONGO_MAX_POOL_SIZE, MONGO_MIN_POOL_SIZE, MONGO_MAX_CONN_IDLE_TIME,
+// MONGO_CONNECT_TIMEOUT, MONGO_SERVER_SELECTION_TIMEOUT,
+// MONGO_OPERATION_TIMEOUT and MONGO_DISCONNECT_TIMEOUT (durations such as
+// "10s").
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
 
-	uri := os.Getenv("MONGO_URI")
-	if uri == "" {
-		return nil, fmt.Errorf("MONGO_URI not set in environment")
+	cfg.URI = os.Getenv("MONGO_URI")
+	if cfg.URI == "" {
+		return cfg, fmt.Errorf("MONGO_URI not set in environment")
+	}
+	if name := os.Getenv("MONGO_DATABASE"); name != "" {
+		cfg.Database = name
 	}
 
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
+	for key, dst := range map[string]*uint64{
+		"MONGO_MAX_POOL_SIZE": &cfg.MaxPoolSize,
+		"MONGO_MIN_POOL_SIZE": &cfg.MinPoolSize,
+	} {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s %q: %w", key, v, err)
+			}
+			*dst = n
+		}
+	}
+
+	for key, dst := range map[string]*time.Duration{
+		"MONGO_MAX_CONN_IDLE_TIME":       &cfg.MaxConnIdleTime,
+		"MONGO_CONNECT_TIMEOUT":          &cfg.ConnectTimeout,
+		"MONGO_SERVER_SELECTION_TIMEOUT": &cfg.ServerSelectionTimeout,
+		"MONGO_OPERATION_TIMEOUT":        &cfg.OperationTimeout,
+		"MONGO_DISCONNECT_TIMEOUT":       &cfg.DisconnectTimeout,
+	} {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s %q: %w", key, v, err)
+			}
+			*dst = d
+		}
+	}
+
+	if cfg.MinPoolSize > cfg.MaxPoolSize && cfg.MaxPoolSize != 0 {
+		return cfg, fmt.Errorf("MONGO_MIN_POOL_SIZE (%d) exceeds MONGO_MAX_POOL_SIZE (%d)", cfg.MinPoolSize, cfg.MaxPoolSize)
+	}
+
+	return cfg, nil
+}
+
+// Connect opens the pooled client described by cfg and verifies it with a
+// ping. Callers own the client and must Disconnect it on shutdown.
+func Connect(ctx context.Context, cfg Config) (*mongo.Client, error) {
+	opts := options.Client().
+		ApplyURI(cfg.URI).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetMaxConnIdleTime(cfg.MaxConnIdleTime).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ServerSelectionTimeout)
+	if cfg.OperationTimeout > 0 {
+		opts.SetTimeout(cfg.OperationTimeout)
+	}
+
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to MongoDB: %w", err)
 	}
 
-	if err := client.Ping(context.TODO(), nil); err != nil {
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		client.Disconnect(context.Background())
 		return nil, fmt.Errorf("MongoDB ping failed: %w", err)
 	}
 
-	return client.Database("crypto_tracker"), nil
+	return client, nil
+}
+
+// Open returns the store selected by STORAGE_BACKEND: "mongo" (the default),
+// "bolt" for a local file at BOLT_PATH, or "memory" for tests. It is meant to
+// be called once at startup; the returned store must be closed on exit.
+func Open(ctx context.Context) (Store, error) {
+	switch backend := strings.ToLower(os.Getenv("STORAGE_BACKEND")); backend {
+	case "", "mongo":
+		cfg, err := ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		client, err := Connect(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewMongoStore(client, cfg), nil
+	case "bolt":
+		path := os.Getenv("BOLT_PATH")
+		if path == "" {
+			path = "crypto_tracker.db"
+		}
+		return NewBoltStore(path)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
 }
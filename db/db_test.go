@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+	t.Setenv("MONGO_MAX_POOL_SIZE", "50")
+	t.Setenv("MONGO_CONNECT_TIMEOUT", "3s")
+	t.Setenv("MONGO_DISCONNECT_TIMEOUT", "30s")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxPoolSize != 50 || cfg.ConnectTimeout != 3*time.Second || cfg.DisconnectTimeout != 30*time.Second {
+		t.Errorf("overrides not applied: %+v", cfg)
+	}
+	if cfg.Database != "crypto_tracker" || cfg.ServerSelectionTimeout != DefaultConfig().ServerSelectionTimeout {
+		t.Errorf("defaults not kept: %+v", cfg)
+	}
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	t.Setenv("MONGO_URI", "")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected error without MONGO_URI, got nil")
+	}
+
+	t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+	t.Setenv("MONGO_OPERATION_TIMEOUT", "soon")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("expected error for bad duration, got nil")
+	}
+}
@@ -0,0 +1,412 @@
+package db
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps every collection in process memory. It is safe for
+// concurrent use and hands out copies, so callers never alias stored records.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	users        map[string]models.User
+	portfolios   map[string]models.Portfolio
+	watchlists   map[string]models.Watchlist
+	transactions []models.Transaction
+	alerts       []models.Alert
+	alertEvents  []models.AlertEvent
+	outbox       []models.OutboxMessage
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:      make(map[string]models.User),
+		portfolios: make(map[string]models.Portfolio),
+		watchlists: make(map[string]models.Watchlist),
+	}
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error { return ctx.Err() }
+func (s *MemoryStore) Close() error                   { return nil }
+
+func (s *MemoryStore) Users() UserRepository               { return memoryUsers{s} }
+func (s *MemoryStore) Portfolios() PortfolioRepository     { return memoryPortfolios{s} }
+func (s *MemoryStore) Watchlists() WatchlistRepository     { return memoryWatchlists{s} }
+func (s *MemoryStore) Transactions() TransactionRepository { return memoryTransactions{s} }
+func (s *MemoryStore) Alerts() AlertRepository             { return memoryAlerts{s} }
+func (s *MemoryStore) AlertEvents() AlertEventRepository   { return memoryAlertEvents{s} }
+func (s *MemoryStore) Outbox() OutboxRepository            { return memoryOutbox{s} }
+
+type memoryUsers struct{ s *MemoryStore }
+
+func copyUser(u models.User) models.User {
+	u.Channels = append([]models.NotificationChannel(nil), u.Channels...)
+	u.EmailTemplates = append([]models.EmailTemplate(nil), u.EmailTemplates...)
+	if u.Digest != nil {
+		d := *u.Digest
+		d.LastPrices = maps.Clone(d.LastPrices)
+		u.Digest = &d
+	}
+	return u
+}
+
+func (r memoryUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	u, ok := r.s.users[email]
+	if !ok {
+		return nil, customerrors.NewDatabaseError("fetch", "users", customerrors.ErrNotFound)
+	}
+	u = copyUser(u)
+	return &u, nil
+}
+
+func (r memoryUsers) ListDigestSubscribers(ctx context.Context) ([]models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var users []models.User
+	for _, u := range r.s.users {
+		if u.Digest.Enabled() {
+			users = append(users, copyUser(u))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users, nil
+}
+
+func (r memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[user.Email]; ok {
+		return customerrors.NewDatabaseError("insert", "users", customerrors.ErrEmailExists)
+	}
+	r.s.users[user.Email] = copyUser(*user)
+	return nil
+}
+
+func (r memoryUsers) Update(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[user.Email]; !ok {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrNotFound)
+	}
+	r.s.users[user.Email] = copyUser(*user)
+	return nil
+}
+
+func (r memoryUsers) UpdateDigest(ctx context.Context, email string, s *models.DigestSettings) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[email]
+	if !ok {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrNotFound)
+	}
+	u.Digest = s
+	r.s.users[email] = copyUser(u)
+	return nil
+}
+
+func (r memoryUsers) RecordDigest(ctx context.Context, email string, periodEnd time.Time, prices map[string]float64, currency string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[email]
+	if !ok {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrNotFound)
+	}
+	if u.Digest == nil || !periodEnd.After(u.Digest.LastPeriodEnd) {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrConflict)
+	}
+	u.Digest.LastPeriodEnd = periodEnd
+	u.Digest.LastPrices = maps.Clone(prices)
+	u.Digest.LastCurrency = currency
+	r.s.users[email] = u
+	return nil
+}
+
+type memoryPortfolios struct{ s *MemoryStore }
+
+func copyPortfolio(p models.Portfolio) models.Portfolio {
+	p.Holdings = append([]models.Holding{}, p.Holdings...)
+	return p
+}
+
+func (r memoryPortfolios) Get(ctx context.Context, userEmail string) (*models.Portfolio, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	p, ok := r.s.portfolios[userEmail]
+	if !ok {
+		return nil, customerrors.NewDatabaseError("fetch", "portfolios", customerrors.ErrNotFound)
+	}
+	p = copyPortfolio(p)
+	return &p, nil
+}
+
+func (r memoryPortfolios) Save(ctx context.Context, p *models.Portfolio) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.portfolios[p.UserEmail] = copyPortfolio(*p)
+	return nil
+}
+
+type memoryWatchlists struct{ s *MemoryStore }
+
+func copyWatchlist(w models.Watchlist) models.Watchlist {
+	w.Coins = append([]models.WatchedCoin{}, w.Coins...)
+	return w
+}
+
+func (r memoryWatchlists) Get(ctx context.Context, userEmail string) (*models.Watchlist, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	w, ok := r.s.watchlists[userEmail]
+	if !ok {
+		return nil, customerrors.NewDatabaseError("fetch", "watchlists", customerrors.ErrNotFound)
+	}
+	w = copyWatchlist(w)
+	return &w, nil
+}
+
+func (r memoryWatchlists) Save(ctx context.Context, w *models.Watchlist) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.watchlists[w.UserEmail] = copyWatchlist(*w)
+	return nil
+}
+
+type memoryTransactions struct{ s *MemoryStore }
+
+func (r memoryTransactions) Insert(ctx context.Context, txs ...models.Transaction) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.transactions = append(r.s.transactions, txs...)
+	return nil
+}
+
+func (r memoryTransactions) List(ctx context.Context, userEmail string, coinIDs ...string) ([]models.Transaction, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(coinIDs))
+	for _, id := range coinIDs {
+		wanted[id] = true
+	}
+
+	txs := []models.Transaction{}
+	for _, tx := range r.s.transactions {
+		if tx.UserEmail != userEmail || (len(wanted) > 0 && !wanted[tx.CoinID]) {
+			continue
+		}
+		txs = append(txs, tx)
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].ExecutedAt.Before(txs[j].ExecutedAt)
+	})
+	return txs, nil
+}
+
+type memoryAlerts struct{ s *MemoryStore }
+
+func (r memoryAlerts) Create(ctx context.Context, a *models.Alert) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.alerts = append(r.s.alerts, *a)
+	return nil
+}
+
+func (r memoryAlerts) ListActive(ctx context.Context, userEmail string) ([]models.Alert, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var alerts []models.Alert
+	for _, a := range r.s.alerts {
+		if a.UserEmail == userEmail && !a.Triggered {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts, nil
+}
+
+func (r memoryAlerts) ListAllActive(ctx context.Context) ([]models.Alert, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	var alerts []models.Alert
+	for _, a := range r.s.alerts {
+		if !a.Triggered {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts, nil
+}
+
+func (r memoryAlerts) Update(ctx context.Context, a *models.Alert) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.update(a)
+}
+
+func (r memoryAlerts) UpdateWithOutbox(ctx context.Context, a *models.Alert, events []models.AlertEvent, msgs ...models.OutboxMessage) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if err := r.update(a); err != nil {
+		return err
+	}
+	r.s.alertEvents = append(r.s.alertEvents, events...)
+	r.s.outbox = append(r.s.outbox, msgs...)
+	return nil
+}
+
+// update requires r.s.mu to be held.
+func (r memoryAlerts) update(a *models.Alert) error {
+	for i := range r.s.alerts {
+		if r.s.alerts[i].ID == a.ID {
+			if r.s.alerts[i].Version != a.Version {
+				return customerrors.NewDatabaseError("update", "alerts", customerrors.ErrConflict)
+			}
+			a.Version++
+			r.s.alerts[i] = *a
+			return nil
+		}
+	}
+	return customerrors.NewDatabaseError("update", "alerts", customerrors.ErrNotFound)
+}
+
+func (r memoryAlerts) Delete(ctx context.Context, userEmail, alertID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i := range r.s.alerts {
+		if r.s.alerts[i].ID == alertID && r.s.alerts[i].UserEmail == userEmail {
+			r.s.alerts = append(r.s.alerts[:i], r.s.alerts[i+1:]...)
+			return nil
+		}
+	}
+	return customerrors.NewDatabaseError("delete", "alerts", customerrors.ErrNotFound)
+}
+
+type memoryAlertEvents struct{ s *MemoryStore }
+
+func (r memoryAlertEvents) Insert(ctx context.Context, e *models.AlertEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.alertEvents = append(r.s.alertEvents, *e)
+	return nil
+}
+
+func (r memoryAlertEvents) List(ctx context.Context, userEmail string, f AlertEventFilter) ([]models.AlertEvent, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	events := []models.AlertEvent{}
+	for _, e := range r.s.alertEvents {
+		if e.UserEmail == userEmail && f.Match(&e) {
+			events = append(events, e)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].FiredAt.After(events[j].FiredAt)
+	})
+	return events, nil
+}
+
+func (r memoryAlertEvents) SetDelivery(ctx context.Context, eventID string, status models.DeliveryStatus, deliveryErr string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i := range r.s.alertEvents {
+		if r.s.alertEvents[i].ID == eventID {
+			r.s.alertEvents[i].Delivery = status
+			r.s.alertEvents[i].DeliveryError = deliveryErr
+			return nil
+		}
+	}
+	return customerrors.NewDatabaseError("update", "alert_events", customerrors.ErrNotFound)
+}
+
+type memoryOutbox struct{ s *MemoryStore }
+
+func (r memoryOutbox) Enqueue(ctx context.Context, msgs ...models.OutboxMessage) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.outbox = append(r.s.outbox, msgs...)
+	return nil
+}
+
+func (r memoryOutbox) Claim(ctx context.Context, now, until time.Time, limit int, ids ...string) ([]models.OutboxMessage, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var due []int
+	for i, m := range r.s.outbox {
+		if m.Status == models.OutboxPending && !m.NextAttemptAt.After(now) && (len(ids) == 0 || slices.Contains(ids, m.ID)) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return r.s.outbox[due[i]].NextAttemptAt.Before(r.s.outbox[due[j]].NextAttemptAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]models.OutboxMessage, 0, len(due))
+	for _, i := range due {
+		r.s.outbox[i].NextAttemptAt = until
+		claimed = append(claimed, r.s.outbox[i])
+	}
+	return claimed, nil
+}
+
+func (r memoryOutbox) Update(ctx context.Context, m *models.OutboxMessage) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i := range r.s.outbox {
+		if r.s.outbox[i].ID == m.ID {
+			r.s.outbox[i] = *m
+			return nil
+		}
+	}
+	return customerrors.NewDatabaseError("update", "outbox", customerrors.ErrNotFound)
+}
+
+func (r memoryOutbox) List(ctx context.Context, f OutboxFilter) ([]models.OutboxMessage, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	msgs := []models.OutboxMessage{}
+	for _, m := range r.s.outbox {
+		if f.Match(&m) {
+			msgs = append(msgs, m)
+		}
+	}
+
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+	})
+	return msgs, nil
+}
@@ -0,0 +1,569 @@
+package db
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// illegalOperationCode is returned by standalone servers, which cannot run
+// multi-document transactions.
+const illegalOperationCode = 20
+
+// MongoStore shares one pooled client across every repository it hands out.
+type MongoStore struct {
+	client            *mongo.Client
+	database          *mongo.Database
+	disconnectTimeout time.Duration
+}
+
+func NewMongoStore(client *mongo.Client, cfg Config) *MongoStore {
+	return &MongoStore{
+		client:            client,
+		database:          client.Database(cfg.Database),
+		disconnectTimeout: cfg.DisconnectTimeout,
+	}
+}
+
+func (s *MongoStore) Ping(ctx context.Context) error {
+	if err := s.client.Ping(ctx, readpref.Primary()); err != nil {
+		return customerrors.NewDatabaseError("ping", s.database.Name(), err)
+	}
+	return nil
+}
+
+// Close disconnects the shared client, waiting up to the configured
+// disconnect timeout for in-flight operations to finish.
+func (s *MongoStore) Close() error {
+	ctx := context.Background()
+	if s.disconnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.disconnectTimeout)
+		defer cancel()
+	}
+	return s.client.Disconnect(ctx)
+}
+
+func (s *MongoStore) Users() UserRepository {
+	return &mongoUsers{collection: s.database.Collection("users")}
+}
+
+func (s *MongoStore) Portfolios() PortfolioRepository {
+	return &mongoPortfolios{collection: s.database.Collection("portfolios")}
+}
+
+func (s *MongoStore) Watchlists() WatchlistRepository {
+	return &mongoWatchlists{collection: s.database.Collection("watchlists")}
+}
+
+func (s *MongoStore) Transactions() TransactionRepository {
+	return &mongoTransactions{collection: s.database.Collection("transactions")}
+}
+
+func (s *MongoStore) Alerts() AlertRepository {
+	return &mongoAlerts{
+		collection: s.database.Collection("alerts"),
+		events:     s.database.Collection("alert_events"),
+		outbox:     s.database.Collection("outbox"),
+	}
+}
+
+func (s *MongoStore) AlertEvents() AlertEventRepository {
+	return &mongoAlertEvents{collection: s.database.Collection("alert_events")}
+}
+
+func (s *MongoStore) Outbox() OutboxRepository {
+	return &mongoOutbox{collection: s.database.Collection("outbox")}
+}
+
+type mongoUsers struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var u models.User
+	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&u)
+	if err == mongo.ErrNoDocuments {
+		return nil, customerrors.NewDatabaseError("fetch", "users", customerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("fetch", "users", err)
+	}
+	return &u, nil
+}
+
+func (r *mongoUsers) Create(ctx context.Context, user *models.User) error {
+	if _, err := r.collection.InsertOne(ctx, user); err != nil {
+		return customerrors.NewDatabaseError("insert", "users", err)
+	}
+	return nil
+}
+
+func (r *mongoUsers) Update(ctx context.Context, user *models.User) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"email": user.Email}, user)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "users", err)
+	}
+	if result.MatchedCount == 0 {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrNotFound)
+	}
+	return nil
+}
+
+func (r *mongoUsers) UpdateDigest(ctx context.Context, email string, s *models.DigestSettings) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"digest": s}})
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "users", err)
+	}
+	if result.MatchedCount == 0 {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrNotFound)
+	}
+	return nil
+}
+
+func (r *mongoUsers) RecordDigest(ctx context.Context, email string, periodEnd time.Time, prices map[string]float64, currency string) error {
+	// A missing last_period_end is the zero time, which omitempty drops.
+	filter := bson.M{
+		"email":          email,
+		"digest.cadence": bson.M{"$exists": true},
+		"$or": bson.A{
+			bson.M{"digest.last_period_end": bson.M{"$lt": periodEnd}},
+			bson.M{"digest.last_period_end": bson.M{"$exists": false}},
+		},
+	}
+	update := bson.M{"$set": bson.M{
+		"digest.last_period_end": periodEnd,
+		"digest.last_prices":     prices,
+		"digest.last_currency":   currency,
+	}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "users", err)
+	}
+	if result.MatchedCount == 0 {
+		return customerrors.NewDatabaseError("update", "users", customerrors.ErrConflict)
+	}
+	return nil
+}
+
+func (r *mongoUsers) ListDigestSubscribers(ctx context.Context) ([]models.User, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"digest.cadence": bson.M{"$in": bson.A{models.DigestDaily, models.DigestWeekly}},
+	})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "users", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, customerrors.NewDatabaseError("decode", "users", err)
+	}
+	return users, nil
+}
+
+type mongoPortfolios struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPortfolios) Get(ctx context.Context, userEmail string) (*models.Portfolio, error) {
+	var p models.Portfolio
+	err := r.collection.FindOne(ctx, bson.M{"user_email": userEmail}).Decode(&p)
+	if err == mongo.ErrNoDocuments {
+		return nil, customerrors.NewDatabaseError("fetch", "portfolios", customerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("fetch", "portfolios", err)
+	}
+	return &p, nil
+}
+
+func (r *mongoPortfolios) Save(ctx context.Context, p *models.Portfolio) error {
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.M{"user_email": p.UserEmail},
+		p,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "portfolios", err)
+	}
+	return nil
+}
+
+type mongoWatchlists struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoWatchlists) Get(ctx context.Context, userEmail string) (*models.Watchlist, error) {
+	var w models.Watchlist
+	err := r.collection.FindOne(ctx, bson.M{"user_email": userEmail}).Decode(&w)
+	if err == mongo.ErrNoDocuments {
+		return nil, customerrors.NewDatabaseError("fetch", "watchlists", customerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("fetch", "watchlists", err)
+	}
+	return &w, nil
+}
+
+func (r *mongoWatchlists) Save(ctx context.Context, w *models.Watchlist) error {
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.M{"user_email": w.UserEmail},
+		w,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "watchlists", err)
+	}
+	return nil
+}
+
+type mongoTransactions struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoTransactions) Insert(ctx context.Context, txs ...models.Transaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(txs))
+	for i := range txs {
+		docs[i] = txs[i]
+	}
+	if _, err := r.collection.InsertMany(ctx, docs); err != nil {
+		return customerrors.NewDatabaseError("insert", "transactions", err)
+	}
+	return nil
+}
+
+func (r *mongoTransactions) List(ctx context.Context, userEmail string, coinIDs ...string) ([]models.Transaction, error) {
+	filter := bson.M{"user_email": userEmail}
+	if len(coinIDs) > 0 {
+		filter["coin_id"] = bson.M{"$in": coinIDs}
+	}
+
+	cursor, err := r.collection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "executed_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "transactions", err)
+	}
+	defer cursor.Close(ctx)
+
+	txs := []models.Transaction{}
+	if err := cursor.All(ctx, &txs); err != nil {
+		return nil, customerrors.NewDatabaseError("decode", "transactions", err)
+	}
+	return txs, nil
+}
+
+type mongoAlerts struct {
+	collection *mongo.Collection
+	events     *mongo.Collection
+	outbox     *mongo.Collection
+}
+
+func (r *mongoAlerts) Create(ctx context.Context, a *models.Alert) error {
+	if _, err := r.collection.InsertOne(ctx, a); err != nil {
+		return customerrors.NewDatabaseError("insert", "alerts", err)
+	}
+	return nil
+}
+
+func (r *mongoAlerts) ListActive(ctx context.Context, userEmail string) ([]models.Alert, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.M{"user_email": userEmail, "triggered": false},
+	)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "alerts", err)
+	}
+	defer cursor.Close(ctx)
+
+	var alerts []models.Alert
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, customerrors.NewDatabaseError("decode", "alerts", err)
+	}
+	return alerts, nil
+}
+
+func (r *mongoAlerts) ListAllActive(ctx context.Context) ([]models.Alert, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"triggered": false})
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "alerts", err)
+	}
+	defer cursor.Close(ctx)
+
+	var alerts []models.Alert
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, customerrors.NewDatabaseError("decode", "alerts", err)
+	}
+	return alerts, nil
+}
+
+func (r *mongoAlerts) Update(ctx context.Context, a *models.Alert) error {
+	filter := bson.M{"_id": a.ID, "version": a.Version}
+	if a.Version == 0 {
+		// Alerts written before versioning have no version field at all.
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	next := *a
+	next.Version++
+	result, err := r.collection.ReplaceOne(ctx, filter, next)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "alerts", err)
+	}
+	if result.MatchedCount == 0 {
+		n, err := r.collection.CountDocuments(ctx, bson.M{"_id": a.ID})
+		if err != nil {
+			return customerrors.NewDatabaseError("update", "alerts", err)
+		}
+		if n == 0 {
+			return customerrors.NewDatabaseError("update", "alerts", customerrors.ErrNotFound)
+		}
+		return customerrors.NewDatabaseError("update", "alerts", customerrors.ErrConflict)
+	}
+
+	a.Version = next.Version
+	return nil
+}
+
+// UpdateWithOutbox runs the update and the inserts in a transaction, which
+// needs a replica set; see withTransaction for standalone servers.
+func (r *mongoAlerts) UpdateWithOutbox(ctx context.Context, a *models.Alert, events []models.AlertEvent, msgs ...models.OutboxMessage) error {
+	if len(events) == 0 && len(msgs) == 0 {
+		return r.Update(ctx, a)
+	}
+
+	eventDocs := make([]interface{}, len(events))
+	for i := range events {
+		eventDocs[i] = events[i]
+	}
+	msgDocs := make([]interface{}, len(msgs))
+	for i := range msgs {
+		msgDocs[i] = msgs[i]
+	}
+	version := a.Version
+	write := func(ctx context.Context) error {
+		// A transaction may be retried, so start from the loaded version.
+		a.Version = version
+		if err := r.Update(ctx, a); err != nil {
+			return err
+		}
+		if len(eventDocs) > 0 {
+			if _, err := r.events.InsertMany(ctx, eventDocs); err != nil {
+				return customerrors.NewDatabaseError("insert", "alert_events", err)
+			}
+		}
+		if len(msgDocs) > 0 {
+			if _, err := r.outbox.InsertMany(ctx, msgDocs); err != nil {
+				return customerrors.NewDatabaseError("insert", "outbox", err)
+			}
+		}
+		return nil
+	}
+
+	session, err := r.collection.Database().Client().StartSession()
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "alerts", err)
+	}
+	defer session.EndSession(ctx)
+
+	run := func(ctx context.Context, fn func(context.Context) error) error {
+		_, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sc)
+		})
+		return err
+	}
+	if err := withTransaction(ctx, run, write); err != nil {
+		a.Version = version
+		return err
+	}
+	return nil
+}
+
+var standaloneWarning sync.Once
+
+// withTransaction runs fn through run, which wraps it in a transaction. A
+// standalone server cannot run transactions, so there fn is run on its own
+// instead, after a one-time warning: a crash part-way through it can then
+// lose or duplicate a notification.
+func withTransaction(ctx context.Context, run func(context.Context, func(context.Context) error) error, fn func(context.Context) error) error {
+	err := run(ctx, fn)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(illegalOperationCode) {
+		standaloneWarning.Do(func() {
+			fmt.Println("Warning: MongoDB is not running as a replica set, so alert updates and their emails are not saved atomically.")
+		})
+		return fn(ctx)
+	}
+	return err
+}
+
+func (r *mongoAlerts) Delete(ctx context.Context, userEmail, alertID string) error {
+	result, err := r.collection.DeleteOne(
+		ctx,
+		bson.M{"_id": alertID, "user_email": userEmail},
+	)
+	if err != nil {
+		return customerrors.NewDatabaseError("delete", "alerts", err)
+	}
+	if result.DeletedCount == 0 {
+		return customerrors.NewDatabaseError("delete", "alerts", customerrors.ErrNotFound)
+	}
+	return nil
+}
+
+type mongoAlertEvents struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAlertEvents) Insert(ctx context.Context, e *models.AlertEvent) error {
+	if _, err := r.collection.InsertOne(ctx, e); err != nil {
+		return customerrors.NewDatabaseError("insert", "alert_events", err)
+	}
+	return nil
+}
+
+func (r *mongoAlertEvents) List(ctx context.Context, userEmail string, f AlertEventFilter) ([]models.AlertEvent, error) {
+	filter := bson.M{"user_email": userEmail}
+	if f.CoinID != "" {
+		filter["coin_id"] = f.CoinID
+	}
+	firedAt := bson.M{}
+	if !f.From.IsZero() {
+		firedAt["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		firedAt["$lte"] = f.To
+	}
+	if len(firedAt) > 0 {
+		filter["fired_at"] = firedAt
+	}
+
+	cursor, err := r.collection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "fired_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "alert_events", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.AlertEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, customerrors.NewDatabaseError("decode", "alert_events", err)
+	}
+	return events, nil
+}
+
+func (r *mongoAlertEvents) SetDelivery(ctx context.Context, eventID string, status models.DeliveryStatus, deliveryErr string) error {
+	result, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": eventID},
+		bson.M{"$set": bson.M{"delivery": status, "delivery_error": deliveryErr}},
+	)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "alert_events", err)
+	}
+	if result.MatchedCount == 0 {
+		return customerrors.NewDatabaseError("update", "alert_events", customerrors.ErrNotFound)
+	}
+	return nil
+}
+
+type mongoOutbox struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoOutbox) Enqueue(ctx context.Context, msgs ...models.OutboxMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	docs := make([]interface{}, len(msgs))
+	for i := range msgs {
+		docs[i] = msgs[i]
+	}
+	if _, err := r.collection.InsertMany(ctx, docs); err != nil {
+		return customerrors.NewDatabaseError("insert", "outbox", err)
+	}
+	return nil
+}
+
+// Claim leases messages one at a time with FindOneAndUpdate, which is atomic
+// per document, so two workers never claim the same message.
+func (r *mongoOutbox) Claim(ctx context.Context, now, until time.Time, limit int, ids ...string) ([]models.OutboxMessage, error) {
+	filter := bson.M{"status": models.OutboxPending, "next_attempt_at": bson.M{"$lte": now}}
+	if len(ids) > 0 {
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var claimed []models.OutboxMessage
+	for limit <= 0 || len(claimed) < limit {
+		var m models.OutboxMessage
+		err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"next_attempt_at": until}}, opts).Decode(&m)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return claimed, customerrors.NewDatabaseError("claim", "outbox", err)
+		}
+		claimed = append(claimed, m)
+	}
+	return claimed, nil
+}
+
+func (r *mongoOutbox) Update(ctx context.Context, m *models.OutboxMessage) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": m.ID}, m)
+	if err != nil {
+		return customerrors.NewDatabaseError("update", "outbox", err)
+	}
+	if result.MatchedCount == 0 {
+		return customerrors.NewDatabaseError("update", "outbox", customerrors.ErrNotFound)
+	}
+	return nil
+}
+
+func (r *mongoOutbox) List(ctx context.Context, f OutboxFilter) ([]models.OutboxMessage, error) {
+	filter := bson.M{}
+	if f.To != "" {
+		filter["to"] = f.To
+	}
+	if len(f.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": f.Statuses}
+	}
+
+	cursor, err := r.collection.Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, customerrors.NewDatabaseError("find", "outbox", err)
+	}
+	defer cursor.Close(ctx)
+
+	msgs := []models.OutboxMessage{}
+	if err := cursor.All(ctx, &msgs); err != nil {
+		return nil, customerrors.NewDatabaseError("decode", "outbox", err)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestOutbox_UpdateWithOutboxAndClaim(t *testing.T) {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer bolt.Close()
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "bolt": bolt} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now().UTC().Truncate(time.Millisecond)
+
+			a := models.Alert{ID: "a1", UserEmail: "a@example.com"}
+			if err := store.Alerts().Create(ctx, &a); err != nil {
+				t.Fatalf("creating alert: %v", err)
+			}
+			stale := a
+
+			msg := models.OutboxMessage{ID: "m1", To: "a@example.com", Status: models.OutboxPending, NextAttemptAt: now, CreatedAt: now}
+			a.Triggered = true
+			event := models.AlertEvent{ID: "e1", AlertID: "a1", UserEmail: "a@example.com", FiredAt: now, Delivery: models.DeliveryQueued}
+			if err := store.Alerts().UpdateWithOutbox(ctx, &a, []models.AlertEvent{event}, msg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// A checker that lost the race must not enqueue a duplicate.
+			dup := msg
+			dup.ID = "m2"
+			stale.Triggered = true
+			dupEvent := event
+			dupEvent.ID = "e2"
+			if err := store.Alerts().UpdateWithOutbox(ctx, &stale, []models.AlertEvent{dupEvent}, dup); !errors.Is(err, customerrors.ErrConflict) {
+				t.Fatalf("expected ErrConflict, got: %v", err)
+			}
+			if events, _ := store.AlertEvents().List(ctx, "a@example.com", AlertEventFilter{}); len(events) != 1 || events[0].ID != "e1" {
+				t.Fatalf("expected only the winning update's event, got %+v", events)
+			}
+
+			later := models.OutboxMessage{ID: "m3", To: "b@example.com", Status: models.OutboxPending, NextAttemptAt: now.Add(time.Hour), CreatedAt: now.Add(time.Second)}
+			if err := store.Outbox().Enqueue(ctx, later); err != nil {
+				t.Fatalf("enqueueing: %v", err)
+			}
+
+			msgs, err := store.Outbox().List(ctx, OutboxFilter{})
+			if err != nil {
+				t.Fatalf("listing outbox: %v", err)
+			}
+			if len(msgs) != 2 || msgs[0].ID != "m3" || msgs[1].ID != "m1" {
+				t.Fatalf("expected m3 and m1 newest first, got %+v", msgs)
+			}
+
+			claimed, err := store.Outbox().Claim(ctx, now, now.Add(time.Minute), 10)
+			if err != nil {
+				t.Fatalf("claiming: %v", err)
+			}
+			if len(claimed) != 1 || claimed[0].ID != "m1" || !claimed[0].NextAttemptAt.Equal(now.Add(time.Minute)) {
+				t.Fatalf("expected only the due message to be leased, got %+v", claimed)
+			}
+			if again, _ := store.Outbox().Claim(ctx, now, now.Add(time.Minute), 10); len(again) != 0 {
+				t.Errorf("expected leased message to be skipped, got %+v", again)
+			}
+			if byID, _ := store.Outbox().Claim(ctx, now.Add(2*time.Hour), now.Add(3*time.Hour), 10, "m3"); len(byID) != 1 || byID[0].ID != "m3" {
+				t.Errorf("expected claim by ID to return m3 only, got %+v", byID)
+			}
+
+			claimed[0].Status = models.OutboxDead
+			if err := store.Outbox().Update(ctx, &claimed[0]); err != nil {
+				t.Fatalf("updating: %v", err)
+			}
+			dead, _ := store.Outbox().List(ctx, OutboxFilter{To: "a@example.com", Statuses: []models.OutboxStatus{models.OutboxDead}})
+			if len(dead) != 1 || dead[0].ID != "m1" {
+				t.Errorf("expected m1 dead-lettered, got %+v", dead)
+			}
+		})
+	}
+}
+
+func TestWithTransaction_FallsBackOnStandalone(t *testing.T) {
+	ctx := context.Background()
+	writes := 0
+	write := func(context.Context) error {
+		writes++
+		return nil
+	}
+
+	standalone := func(context.Context, func(context.Context) error) error {
+		return mongo.CommandError{Code: illegalOperationCode, Message: "Transaction numbers are only allowed on a replica set member or mongos"}
+	}
+	for i := 0; i < 2; i++ {
+		if err := withTransaction(ctx, standalone, write); err != nil {
+			t.Fatalf("expected fallback to succeed, got %v", err)
+		}
+	}
+	if writes != 2 {
+		t.Errorf("expected the writes to run once per call, got %d", writes)
+	}
+
+	failing := func(context.Context, func(context.Context) error) error {
+		return mongo.CommandError{Code: 112, Message: "WriteConflict"}
+	}
+	if err := withTransaction(ctx, failing, write); err == nil {
+		t.Error("expected other transaction errors to be returned")
+	}
+	if writes != 2 {
+		t.Errorf("expected no fallback for other errors, got %d writes", writes)
+	}
+}
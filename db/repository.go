@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"crypto-portfolio-tracker/models"
+	"time"
+)
+
+type UserRepository interface {
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, user *models.User) error
+	// UpdateDigest replaces the user's digest settings and nothing else.
+	UpdateDigest(ctx context.Context, email string, s *models.DigestSettings) error
+	// RecordDigest marks the digest for the period ending at periodEnd as
+	// sent, keeping prices for the next one. It fails with ErrConflict when
+	// that period or a later one was already recorded, or the user has no
+	// digest scheduled.
+	RecordDigest(ctx context.Context, email string, periodEnd time.Time, prices map[string]float64, currency string) error
+	// ListDigestSubscribers returns every user with a daily or weekly
+	// digest scheduled.
+	ListDigestSubscribers(ctx context.Context) ([]models.User, error)
+}
+
+type PortfolioRepository interface {
+	Get(ctx context.Context, userEmail string) (*models.Portfolio, error)
+	Save(ctx context.Context, p *models.Portfolio) error
+}
+
+type WatchlistRepository interface {
+	Get(ctx context.Context, userEmail string) (*models.Watchlist, error)
+	Save(ctx context.Context, w *models.Watchlist) error
+}
+
+type TransactionRepository interface {
+	Insert(ctx context.Context, txs ...models.Transaction) error
+	List(ctx context.Context, userEmail string, coinIDs ...string) ([]models.Transaction, error)
+}
+
+type AlertRepository interface {
+	Create(ctx context.Context, a *models.Alert) error
+	ListActive(ctx context.Context, userEmail string) ([]models.Alert, error)
+	// ListAllActive returns every untriggered alert across all users.
+	ListAllActive(ctx context.Context) ([]models.Alert, error)
+	// Update replaces the alert only if its stored Version still matches
+	// a.Version, returning an error wrapping errors.ErrConflict otherwise.
+	// On success a.Version is advanced to the stored value.
+	Update(ctx context.Context, a *models.Alert) error
+	// UpdateWithOutbox is Update that also records events in the alert
+	// history and enqueues msgs in the email outbox, atomically: they are
+	// stored only if the update succeeds, so a fired alert is never left
+	// without its notification, nor a notification without its history.
+	UpdateWithOutbox(ctx context.Context, a *models.Alert, events []models.AlertEvent, msgs ...models.OutboxMessage) error
+	Delete(ctx context.Context, userEmail, alertID string) error
+}
+
+// AlertEventFilter narrows an alert history listing. Zero fields match
+// everything; From and To bound FiredAt inclusively.
+type AlertEventFilter struct {
+	CoinID string
+	From   time.Time
+	To     time.Time
+}
+
+func (f AlertEventFilter) Match(e *models.AlertEvent) bool {
+	if f.CoinID != "" && e.CoinID != f.CoinID {
+		return false
+	}
+	if !f.From.IsZero() && e.FiredAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.FiredAt.After(f.To) {
+		return false
+	}
+	return true
+}
+
+type AlertEventRepository interface {
+	Insert(ctx context.Context, e *models.AlertEvent) error
+	// List returns the user's events matching f, most recent first.
+	List(ctx context.Context, userEmail string, f AlertEventFilter) ([]models.AlertEvent, error)
+	// SetDelivery records the final outcome of a queued notification.
+	SetDelivery(ctx context.Context, eventID string, status models.DeliveryStatus, deliveryErr string) error
+}
+
+// OutboxFilter narrows an outbox listing. Zero fields match everything.
+type OutboxFilter struct {
+	To       string
+	Statuses []models.OutboxStatus
+}
+
+func (f OutboxFilter) Match(m *models.OutboxMessage) bool {
+	if f.To != "" && m.To != f.To {
+		return false
+	}
+	if len(f.Statuses) == 0 {
+		return true
+	}
+	for _, s := range f.Statuses {
+		if m.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+type OutboxRepository interface {
+	Enqueue(ctx context.Context, msgs ...models.OutboxMessage) error
+	// Claim leases up to limit pending messages due at or before now by
+	// moving their NextAttemptAt to until, so concurrent workers skip them
+	// while they are being sent. When ids are given only those messages
+	// are considered. Claimed messages are returned oldest-due first.
+	Claim(ctx context.Context, now, until time.Time, limit int, ids ...string) ([]models.OutboxMessage, error)
+	// Update replaces a message, typically with the result of an attempt.
+	Update(ctx context.Context, m *models.OutboxMessage) error
+	// List returns the messages matching f, newest first.
+	List(ctx context.Context, f OutboxFilter) ([]models.OutboxMessage, error)
+}
+
+// Store groups the repositories the application packages depend on. Lookups
+// of a single missing record return an error wrapping errors.ErrNotFound.
+type Store interface {
+	Users() UserRepository
+	Portfolios() PortfolioRepository
+	Watchlists() WatchlistRepository
+	Transactions() TransactionRepository
+	Alerts() AlertRepository
+	AlertEvents() AlertEventRepository
+	Outbox() OutboxRepository
+
+	// Ping reports whether the backing database is reachable.
+	Ping(ctx context.Context) error
+	// Close releases the underlying connection or file handle.
+	Close() error
+}
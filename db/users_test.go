@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsers_DigestUpdatesKeepOtherFields(t *testing.T) {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "tracker.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+	defer bolt.Close()
+
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "bolt": bolt} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			end := time.Now().UTC().Truncate(time.Millisecond)
+
+			if err := store.Users().Create(ctx, &models.User{Email: "a@example.com", Currency: "usd"}); err != nil {
+				t.Fatalf("creating user: %v", err)
+			}
+			if err := store.Users().RecordDigest(ctx, "a@example.com", end, nil, "usd"); !errors.Is(err, customerrors.ErrConflict) {
+				t.Errorf("expected ErrConflict without a digest scheduled, got: %v", err)
+			}
+
+			// A stale copy of the user, as read before the digest was set up.
+			stale, err := store.Users().FindByEmail(ctx, "a@example.com")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := store.Users().UpdateDigest(ctx, "a@example.com", &models.DigestSettings{Cadence: models.DigestDaily}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stale.Currency = "eur"
+			stale.Digest = nil
+			if err := store.Users().Update(ctx, stale); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := store.Users().UpdateDigest(ctx, "a@example.com", &models.DigestSettings{Cadence: models.DigestWeekly}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if err := store.Users().RecordDigest(ctx, "a@example.com", end, map[string]float64{"bitcoin": 50000}, "eur"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := store.Users().RecordDigest(ctx, "a@example.com", end, nil, "eur"); !errors.Is(err, customerrors.ErrConflict) {
+				t.Errorf("expected ErrConflict recording the same period twice, got: %v", err)
+			}
+
+			u, err := store.Users().FindByEmail(ctx, "a@example.com")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if u.Currency != "eur" || u.Digest == nil || u.Digest.Cadence != models.DigestWeekly {
+				t.Errorf("expected the digest update to leave the currency alone, got %+v", u)
+			}
+			if !u.Digest.LastPeriodEnd.Equal(end) || u.Digest.LastPrices["bitcoin"] != 50000 || u.Digest.LastCurrency != "eur" {
+				t.Errorf("expected the digest to be recorded, got %+v", u.Digest)
+			}
+		})
+	}
+}
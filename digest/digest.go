@@ -0,0 +1,416 @@
+package digest
+
+import (
+	"context"
+	"crypto-portfolio-tracker/alert"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/email"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/outbox"
+	"crypto-portfolio-tracker/portfolio"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	// Timezones are looked up by name, so bundle the database for hosts
+	// without one.
+	_ "time/tzdata"
+)
+
+const (
+	DefaultHour          = 8
+	DefaultCheckInterval = 5 * time.Minute
+
+	// topMovers caps how many of the biggest price moves a digest lists.
+	topMovers = 3
+)
+
+// DefaultSettings is the schedule offered to users who have not set one.
+var DefaultSettings = models.DigestSettings{
+	Cadence:  models.DigestOff,
+	Timezone: "UTC",
+	Hour:     DefaultHour,
+	Weekday:  time.Monday,
+}
+
+func GetSettings(ctx context.Context, store db.Store, userEmail string) (models.DigestSettings, error) {
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return models.DigestSettings{}, err
+	}
+	if u.Digest == nil {
+		return DefaultSettings, nil
+	}
+	return *u.Digest, nil
+}
+
+// SetSettings validates and stores the user's digest schedule. The first
+// digest after a change covers the next full period rather than one that
+// ended before the schedule was set.
+func SetSettings(ctx context.Context, store db.Store, userEmail string, s models.DigestSettings) error {
+	if err := validate(&s); err != nil {
+		return err
+	}
+
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	if prev := u.Digest; prev != nil {
+		s.LastPrices, s.LastCurrency = prev.LastPrices, prev.LastCurrency
+	}
+	if s.Enabled() {
+		_, end, err := period(s, time.Now())
+		if err != nil {
+			return err
+		}
+		s.LastPeriodEnd = end
+	}
+	return store.Users().UpdateDigest(ctx, userEmail, &s)
+}
+
+func validate(s *models.DigestSettings) error {
+	switch s.Cadence {
+	case models.DigestOff, models.DigestDaily, models.DigestWeekly:
+	default:
+		return customerrors.NewValidationError("cadence", s.Cadence, fmt.Errorf("must be off, daily or weekly"))
+	}
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return customerrors.NewValidationError("timezone", s.Timezone, fmt.Errorf("must be an IANA name such as Europe/London"))
+	}
+	if s.Hour < 0 || s.Hour > 23 {
+		return customerrors.NewValidationError("hour", s.Hour, fmt.Errorf("must be between 0 and 23"))
+	}
+	if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+		return customerrors.NewValidationError("weekday", s.Weekday, fmt.Errorf("must be between Sunday and Saturday"))
+	}
+	return nil
+}
+
+// period returns the most recent digest period to have ended by now. Periods
+// end at s.Hour local time and are computed on the calendar, so a day
+// spanning a DST change is 23 or 25 hours long.
+func period(s models.DigestSettings, now time.Time) (start, end time.Time, err error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return start, end, err
+	}
+
+	local := now.In(loc)
+	end = time.Date(local.Year(), local.Month(), local.Day(), s.Hour, 0, 0, 0, loc)
+	days := 1
+	if s.Cadence == models.DigestWeekly {
+		days = 7
+		end = end.AddDate(0, 0, -((int(local.Weekday()) - int(s.Weekday) + 7) % 7))
+	}
+	if end.After(now) {
+		end = end.AddDate(0, 0, -days)
+	}
+	return end.AddDate(0, 0, -days), end, nil
+}
+
+// Build computes u's digest for the period [start, end]. It also returns the
+// current price of every holding, to measure the next digest's moves from.
+func Build(ctx context.Context, store db.Store, apiClient api.CryptoApi, u *models.User, start, end time.Time) (email.ReportData, map[string]float64, error) {
+	s := DefaultSettings
+	if u.Digest != nil {
+		s = *u.Digest
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return email.ReportData{}, nil, err
+	}
+	vsCurrency := currency.OrDefault(u.Currency)
+
+	title := "daily digest"
+	if s.Cadence == models.DigestWeekly {
+		title = "weekly digest"
+	}
+	data := email.ReportData{
+		Title:       title,
+		PeriodStart: start.In(loc),
+		PeriodEnd:   end.In(loc),
+		Currency:    vsCurrency,
+	}
+
+	p, err := portfolio.GetPortfolio(ctx, store, u.Email)
+	if err != nil {
+		return data, nil, err
+	}
+	prices := make(map[string]float64, len(p.Holdings))
+	if len(p.Holdings) > 0 {
+		coinIDs := make([]string, len(p.Holdings))
+		for i, h := range p.Holdings {
+			coinIDs[i] = h.CoinID
+		}
+		fetched, err := apiClient.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
+		if err != nil {
+			return data, nil, err
+		}
+		quotes := api.StaticPrices(fetched)
+
+		if data.TotalValue, err = portfolio.CalculateTotalValue(ctx, p, quotes, vsCurrency); err != nil {
+			return data, nil, err
+		}
+
+		// Holdings bought in another currency are valued but left out of
+		// the profit and loss, which cannot be compared across currencies.
+		var invested float64
+		for _, h := range p.Holdings {
+			prices[h.CoinID] = fetched[h.CoinID]
+			coin := models.Portfolio{Holdings: []models.Holding{h}}
+			value, err := portfolio.CalculateTotalValue(ctx, &coin, quotes, vsCurrency)
+			if err != nil {
+				return data, nil, err
+			}
+			rh := email.ReportHolding{
+				CoinID:   h.CoinID,
+				CoinName: h.CoinName,
+				Quantity: h.Quantity,
+				Value:    value,
+			}
+
+			pl, err := portfolio.CalculateProfitLoss(ctx, &coin, quotes, vsCurrency)
+			switch {
+			case errors.Is(err, customerrors.ErrCurrencyMismatch):
+				rh.BoughtIn = currency.OrDefault(h.Currency)
+			case err != nil:
+				return data, nil, err
+			default:
+				rh.ProfitLoss = pl[h.CoinID]
+				cost := rh.Value - rh.ProfitLoss
+				rh.ProfitLossPct = percentOf(rh.ProfitLoss, cost)
+				invested += cost
+				data.TotalProfitLoss += rh.ProfitLoss
+			}
+			data.Holdings = append(data.Holdings, rh)
+		}
+		data.TotalProfitLossPct = percentOf(data.TotalProfitLoss, invested)
+		data.TopMovers = movers(ctx, apiClient, s, vsCurrency, data.Holdings, prices)
+	}
+
+	events, err := store.AlertEvents().List(ctx, u.Email, db.AlertEventFilter{From: start, To: end})
+	if err != nil {
+		return data, nil, err
+	}
+	// Events are recorded per channel and listed newest first; the digest
+	// lists each firing once, oldest first.
+	seen := make(map[string]bool, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		key := e.AlertID + "@" + e.FiredAt.String()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		data.Alerts = append(data.Alerts, email.ReportAlert{
+			FiredAt:   e.FiredAt.In(loc),
+			CoinName:  e.CoinName,
+			Condition: e.Condition,
+			Observed:  alert.ObservedLabel(e),
+		})
+	}
+
+	return data, prices, nil
+}
+
+// movers sets each holding's price change over the period and returns the
+// largest moves. Changes are measured from the prices saved with the last
+// digest; without them a daily digest falls back to the provider's 24h
+// change, and a coin with neither is left out.
+func movers(ctx context.Context, apiClient api.CryptoApi, s models.DigestSettings, vsCurrency string, holdings []email.ReportHolding, prices map[string]float64) []email.ReportHolding {
+	var stats map[string]api.MarketData
+	if md, ok := apiClient.(api.MarketDataApi); ok && s.Cadence != models.DigestWeekly {
+		var missing []string
+		for _, h := range holdings {
+			if s.LastCurrency != vsCurrency || s.LastPrices[h.CoinID] <= 0 {
+				missing = append(missing, h.CoinID)
+			}
+		}
+		if len(missing) > 0 {
+			var err error
+			if stats, err = md.FetchMarketData(ctx, vsCurrency, missing...); err != nil {
+				fmt.Printf("  Warning: could not fetch 24h changes for digest: %v\n", err)
+			}
+		}
+	}
+
+	var moved []email.ReportHolding
+	for i := range holdings {
+		h := &holdings[i]
+		if last := s.LastPrices[h.CoinID]; s.LastCurrency == vsCurrency && last > 0 {
+			h.Change = percentOf(prices[h.CoinID]-last, last)
+		} else if d, ok := stats[h.CoinID]; ok {
+			h.Change = d.Change24h
+		} else {
+			continue
+		}
+		moved = append(moved, *h)
+	}
+
+	sort.SliceStable(moved, func(i, j int) bool {
+		return math.Abs(moved[i].Change) > math.Abs(moved[j].Change)
+	})
+	if len(moved) > topMovers {
+		moved = moved[:topMovers]
+	}
+	return moved
+}
+
+func percentOf(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole * 100
+}
+
+// queue renders data with the user's report template and puts it in the
+// email outbox, making one delivery attempt straight away.
+func queue(ctx context.Context, store db.Store, u *models.User, data email.ReportData) error {
+	content, err := email.RenderReport(u.EmailTemplate(models.TemplateReport), data)
+	if err != nil {
+		fmt.Printf("  Warning: report template for %s failed, using the built-in one: %v\n", u.Email, err)
+		if content, err = email.RenderReport(nil, data); err != nil {
+			return err
+		}
+	}
+
+	msg := outbox.NewMessage(models.OutboxReport, u.Email, content)
+	if err := outbox.Enqueue(ctx, store, msg); err != nil {
+		return err
+	}
+	if err := outbox.Deliver(ctx, store, msg.ID); err != nil {
+		fmt.Printf("  Warning: digest email to %s failed and will be retried: %v\n", u.Email, err)
+	}
+	return nil
+}
+
+// SendNow emails the user a digest for the period that ended most recently,
+// without affecting their schedule.
+func SendNow(ctx context.Context, store db.Store, apiClient api.CryptoApi, userEmail string) error {
+	u, err := store.Users().FindByEmail(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+	s := DefaultSettings
+	if u.Digest.Enabled() {
+		s = *u.Digest
+	} else {
+		s.Cadence = models.DigestDaily
+	}
+	u.Digest = &s
+
+	start, end, err := period(s, time.Now())
+	if err != nil {
+		return err
+	}
+	data, _, err := Build(ctx, store, apiClient, u, start, end)
+	if err != nil {
+		return err
+	}
+	return queue(ctx, store, u, data)
+}
+
+// Scheduler sends every subscribed user's digest once its period has ended.
+type Scheduler struct {
+	Store    db.Store
+	API      api.CryptoApi
+	Interval time.Duration
+
+	clock func() time.Time
+}
+
+func NewScheduler(store db.Store, apiClient api.CryptoApi, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	return &Scheduler{Store: store, API: apiClient, Interval: interval}
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// RunOnce queues the digest of every user whose period has ended since their
+// last one. A digest is marked sent before it is queued, so a failure can
+// skip a digest but never repeat one; periods missed while the scheduler was
+// down are collapsed into the latest.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	users, err := s.Store.Users().ListDigestSubscribers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	sent := 0
+	var errs []error
+	for _, u := range users {
+		start, end, err := period(*u.Digest, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest for %s: %w", u.Email, err))
+			continue
+		}
+		if !end.After(u.Digest.LastPeriodEnd) {
+			continue
+		}
+
+		data, prices, err := Build(ctx, s.Store, s.API, &u, start, end)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest for %s: %w", u.Email, err))
+			continue
+		}
+
+		if err := s.Store.Users().RecordDigest(ctx, u.Email, end, prices, data.Currency); err != nil {
+			if !errors.Is(err, customerrors.ErrConflict) {
+				errs = append(errs, fmt.Errorf("digest for %s: %w", u.Email, err))
+			}
+			// Otherwise the schedule changed or another scheduler sent
+			// this digest since the users were listed.
+			continue
+		}
+		if err := queue(ctx, s.Store, &u, data); err != nil {
+			errs = append(errs, fmt.Errorf("digest for %s: %w", u.Email, err))
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+// Run checks for due digests immediately and then after every interval until
+// ctx is cancelled, returning ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := s.RunOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Printf("[digest] %v\n", err)
+		}
+		if sent > 0 {
+			fmt.Printf("[digest] %s: %d digest(s) queued\n", s.now().Format(time.RFC3339), sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package digest
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/email/emailtest"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/portfolio"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockAPI struct {
+	prices map[string]float64
+}
+
+func (m *mockAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	return m.prices[coinID], nil
+}
+
+func (m *mockAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	result := make(map[string]float64, len(coinIDs))
+	for _, id := range coinIDs {
+		if p, ok := m.prices[id]; ok {
+			result[id] = p
+		}
+	}
+	return result, nil
+}
+
+func (m *mockAPI) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	return map[string]string{"bitcoin": "Bitcoin", "ethereum": "Ethereum"}, nil
+}
+
+const testUser = "test@example.com"
+
+func TestPeriod(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	tests := []struct {
+		name       string
+		s          models.DigestSettings
+		now        time.Time
+		start, end time.Time
+	}{
+		{
+			name:  "daily after the hour",
+			s:     models.DigestSettings{Cadence: models.DigestDaily, Timezone: "UTC", Hour: 8},
+			now:   time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC),
+			start: time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "daily before the hour",
+			s:     models.DigestSettings{Cadence: models.DigestDaily, Timezone: "UTC", Hour: 8},
+			now:   time.Date(2024, 3, 5, 7, 59, 0, 0, time.UTC),
+			start: time.Date(2024, 3, 3, 8, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "daily across a DST change",
+			s:     models.DigestSettings{Cadence: models.DigestDaily, Timezone: "America/New_York", Hour: 8},
+			now:   time.Date(2024, 3, 10, 13, 0, 0, 0, time.UTC),
+			start: time.Date(2024, 3, 9, 8, 0, 0, 0, ny),
+			end:   time.Date(2024, 3, 10, 8, 0, 0, 0, ny),
+		},
+		{
+			name:  "weekly",
+			s:     models.DigestSettings{Cadence: models.DigestWeekly, Timezone: "UTC", Hour: 8, Weekday: time.Monday},
+			now:   time.Date(2024, 3, 7, 12, 0, 0, 0, time.UTC), // Thursday
+			start: time.Date(2024, 2, 26, 8, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "weekly on the day before the hour",
+			s:     models.DigestSettings{Cadence: models.DigestWeekly, Timezone: "UTC", Hour: 8, Weekday: time.Monday},
+			now:   time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC),
+			start: time.Date(2024, 2, 19, 8, 0, 0, 0, time.UTC),
+			end:   time.Date(2024, 2, 26, 8, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := period(tt.s, tt.now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("expected %v - %v, got %v - %v", tt.start, tt.end, start, end)
+			}
+		})
+	}
+}
+
+func TestSetSettings_Validation(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	if err := store.Users().Create(ctx, &models.User{Email: testUser}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	for _, s := range []models.DigestSettings{
+		{Cadence: "hourly"},
+		{Cadence: models.DigestDaily, Timezone: "Mars/Olympus"},
+		{Cadence: models.DigestDaily, Hour: 24},
+		{Cadence: models.DigestWeekly, Weekday: 7},
+	} {
+		if err := SetSettings(ctx, store, testUser, s); err == nil {
+			t.Errorf("expected %+v to be rejected", s)
+		}
+	}
+}
+
+func TestScheduler_RunOnce(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	srv := emailtest.NewServer(t)
+	srv.Install(t)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000}}
+
+	if err := store.Users().Create(ctx, &models.User{Email: testUser}); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	err := portfolio.AddMultipleHoldings(ctx, store, testUser,
+		models.Holding{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, BuyPrice: 40000, AddedAt: time.Now()},
+		models.Holding{CoinID: "ethereum", CoinName: "Ethereum", Quantity: 2, BuyPrice: 2500, AddedAt: time.Now()},
+	)
+	if err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	if err := SetSettings(ctx, store, testUser, models.DigestSettings{Cadence: models.DigestDaily, Timezone: "UTC", Hour: 8}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The period that ended before the schedule was set is not sent.
+	now := time.Now()
+	s := NewScheduler(store, api, time.Minute)
+	s.clock = func() time.Time { return now }
+	if sent, err := s.RunOnce(ctx); err != nil || sent != 0 {
+		t.Fatalf("expected nothing due yet, got %d (%v)", sent, err)
+	}
+
+	_, end, _ := period(models.DigestSettings{Cadence: models.DigestDaily, Timezone: "UTC", Hour: 8}, now)
+	err = store.AlertEvents().Insert(ctx, &models.AlertEvent{
+		AlertID: "a1", UserEmail: testUser, CoinID: "bitcoin", CoinName: "Bitcoin",
+		AlertType: models.AlertTypeSell, Condition: "SELL at $45000.00", FiredAt: end.Add(time.Hour),
+		ObservedValue: 50000, Currency: "usd", Channel: "email", Delivery: models.DeliverySent,
+	})
+	if err != nil {
+		t.Fatalf("recording event: %v", err)
+	}
+
+	now = now.AddDate(0, 0, 1)
+	if sent, err := s.RunOnce(ctx); err != nil || sent != 1 {
+		t.Fatalf("expected one digest, got %d (%v)", sent, err)
+	}
+	if sent, err := s.RunOnce(ctx); err != nil || sent != 0 {
+		t.Fatalf("expected the digest to be sent once, got %d (%v)", sent, err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected one email, got %d", len(msgs))
+	}
+	m := msgs[0]
+	for _, want := range []string{"$54000.00", "Bitcoin", "Ethereum", "SELL at $45000.00", "$50000.00"} {
+		if !strings.Contains(m.Text, want) {
+			t.Errorf("expected digest to mention %q, got:\n%s", want, m.Text)
+		}
+	}
+
+	u, err := store.Users().FindByEmail(ctx, testUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.Digest.LastPrices["bitcoin"] != 50000 || u.Digest.LastPrices["ethereum"] != 2000 || u.Digest.LastCurrency != "usd" {
+		t.Errorf("expected prices to be saved for the next digest, got %+v", u.Digest)
+	}
+}
+
+func TestBuild_TopMovers(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000}}
+
+	err := portfolio.AddMultipleHoldings(ctx, store, testUser,
+		models.Holding{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, BuyPrice: 40000, AddedAt: time.Now()},
+		models.Holding{CoinID: "ethereum", CoinName: "Ethereum", Quantity: 2, BuyPrice: 2500, AddedAt: time.Now()},
+	)
+	if err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	u := &models.User{Email: testUser, Digest: &models.DigestSettings{
+		Cadence:      models.DigestWeekly,
+		Timezone:     "UTC",
+		LastPrices:   map[string]float64{"bitcoin": 48000, "ethereum": 2500},
+		LastCurrency: "usd",
+	}}
+
+	data, prices, err := Build(ctx, store, api, u, time.Now().AddDate(0, 0, -7), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.Title != "weekly digest" || data.TotalValue != 54000 || data.TotalProfitLoss != 9000 {
+		t.Errorf("unexpected totals: %+v", data)
+	}
+	if len(data.TopMovers) != 2 || data.TopMovers[0].CoinID != "ethereum" || data.TopMovers[0].Change != -20 {
+		t.Errorf("expected ethereum's 20%% drop first, got %+v", data.TopMovers)
+	}
+	if prices["bitcoin"] != 50000 {
+		t.Errorf("expected current prices, got %v", prices)
+	}
+}
+
+func TestBuild_LeavesOtherCurrenciesOutOfProfitLoss(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000, "ethereum": 2000}}
+
+	err := portfolio.AddMultipleHoldings(ctx, store, testUser,
+		models.Holding{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, BuyPrice: 40000, Currency: "usd", AddedAt: time.Now()},
+		models.Holding{CoinID: "ethereum", CoinName: "Ethereum", Quantity: 2, BuyPrice: 2500, Currency: "eur", AddedAt: time.Now()},
+	)
+	if err != nil {
+		t.Fatalf("seeding portfolio: %v", err)
+	}
+	u := &models.User{Email: testUser, Currency: "eur"}
+
+	data, _, err := Build(ctx, store, api, u, time.Now().AddDate(0, 0, -1), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.TotalValue != 54000 || data.TotalProfitLoss != -1000 || data.TotalProfitLossPct != -20 {
+		t.Errorf("expected only the EUR holding in the P/L, got %+v", data)
+	}
+	for _, h := range data.Holdings {
+		if want := map[string]string{"bitcoin": "usd"}[h.CoinID]; h.BoughtIn != want {
+			t.Errorf("%s: BoughtIn = %q, want %q", h.CoinID, h.BoughtIn, want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package email
+
+import (
+	"net/smtp"
+	"testing"
+)
+
+func TestLoginAuth_RequiresTLSForRemoteHosts(t *testing.T) {
+	auth := &loginAuth{username: "me@example.com", password: "secret"}
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"LOGIN"}}); err == nil {
+		t.Error("expected LOGIN over plain text to a remote host to be refused")
+	}
+	for _, server := range []smtp.ServerInfo{
+		{Name: "smtp.example.com", TLS: true},
+		{Name: "localhost"},
+		{Name: "127.0.0.1"},
+		{Name: "::1"},
+	} {
+		if mech, _, err := auth.Start(&server); err != nil || mech != "LOGIN" {
+			t.Errorf("%+v: expected LOGIN to start, got %q (%v)", server, mech, err)
+		}
+	}
+}
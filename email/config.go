@@ -0,0 +1,193 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TLSMode string
+
+const (
+	// TLSStartTLS connects in plain text and upgrades with STARTTLS.
+	TLSStartTLS TLSMode = "starttls"
+	// TLSImplicit speaks TLS from the first byte, usually on port 465.
+	TLSImplicit TLSMode = "implicit"
+	// TLSNone never encrypts; only for local relays and tests.
+	TLSNone TLSMode = "none"
+)
+
+type AuthMechanism string
+
+const (
+	AuthPlain   AuthMechanism = "plain"
+	AuthLogin   AuthMechanism = "login"
+	AuthCRAMMD5 AuthMechanism = "cram-md5"
+	AuthNone    AuthMechanism = "none"
+)
+
+// Config describes the SMTP server mail is sent through and the sender
+// identity used on every message.
+type Config struct {
+	Host string
+	Port int
+	TLS  TLSMode
+	// InsecureSkipVerify disables certificate checks, for relays with
+	// self-signed certificates.
+	InsecureSkipVerify bool
+	Auth               AuthMechanism
+	Username           string
+	Password           string
+	From               string
+	FromName           string
+	// Timeout bounds a send when the caller's context has no deadline.
+	Timeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Host:     "smtp.gmail.com",
+		Port:     587,
+		TLS:      TLSStartTLS,
+		Auth:     AuthPlain,
+		FromName: "Crypto Portfolio Tracker",
+		Timeout:  30 * time.Second,
+	}
+}
+
+func (c Config) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// Validate reports settings that would make every send fail, including
+// missing credentials.
+func (c Config) Validate() error {
+	if err := c.validateTransport(); err != nil {
+		return err
+	}
+	if c.Auth != AuthNone && (c.Username == "" || c.Password == "") {
+		return fmt.Errorf("SMTP credentials not set: configure EMAIL and PASSWORD (or SMTP_USERNAME and SMTP_PASSWORD)")
+	}
+	if c.From == "" {
+		return fmt.Errorf("sender address not set: configure EMAIL or SMTP_FROM")
+	}
+	return nil
+}
+
+func (c Config) validateTransport() error {
+	if c.Host == "" {
+		return fmt.Errorf("SMTP host not set")
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid SMTP port %d", c.Port)
+	}
+	switch c.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return fmt.Errorf("invalid SMTP TLS mode %q (use starttls, implicit or none)", c.TLS)
+	}
+	switch c.Auth {
+	case AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone:
+	default:
+		return fmt.Errorf("invalid SMTP auth mechanism %q (use plain, login, cram-md5 or none)", c.Auth)
+	}
+	return nil
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_TLS (starttls, implicit or
+// none), SMTP_TLS_SKIP_VERIFY, SMTP_AUTH (plain, login, cram-md5 or none),
+// SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM, SMTP_FROM_NAME and SMTP_TIMEOUT
+// over DefaultConfig. The username and sender default to EMAIL and the
+// password to PASSWORD. Missing credentials are reported by Validate, not
+// here, so the application can start without mail configured.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+
+	if v := os.Getenv("SMTP_HOST"); v != "" {
+		cfg.Host = v
+	}
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SMTP_PORT %q: %w", v, err)
+		}
+		cfg.Port = port
+	}
+	if v := os.Getenv("SMTP_TLS"); v != "" {
+		cfg.TLS = TLSMode(strings.ToLower(v))
+		if cfg.TLS == TLSImplicit && os.Getenv("SMTP_PORT") == "" {
+			cfg.Port = 465
+		}
+	}
+	if v := os.Getenv("SMTP_TLS_SKIP_VERIFY"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SMTP_TLS_SKIP_VERIFY %q: %w", v, err)
+		}
+		cfg.InsecureSkipVerify = skip
+	}
+	if v := os.Getenv("SMTP_AUTH"); v != "" {
+		cfg.Auth = AuthMechanism(strings.ToLower(v))
+	}
+	if v := os.Getenv("SMTP_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SMTP_TIMEOUT %q: %w", v, err)
+		}
+		cfg.Timeout = d
+	}
+
+	cfg.Username = firstEnv("SMTP_USERNAME", "EMAIL")
+	cfg.Password = firstEnv("SMTP_PASSWORD", "PASSWORD")
+	cfg.From = firstEnv("SMTP_FROM", "EMAIL")
+	if v, ok := os.LookupEnv("SMTP_FROM_NAME"); ok {
+		cfg.FromName = v
+	}
+
+	if err := cfg.validateTransport(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var (
+	configMu sync.RWMutex
+	config   *Config
+)
+
+// Configure sets the transport used by every send. Until it is called, or
+// after it is called with nil, each send reads the environment.
+func Configure(cfg *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if cfg == nil {
+		config = nil
+		return
+	}
+	c := *cfg
+	config = &c
+}
+
+func currentConfig() (Config, error) {
+	configMu.RLock()
+	cfg := config
+	configMu.RUnlock()
+
+	if cfg != nil {
+		return *cfg, nil
+	}
+	return ConfigFromEnv()
+}
@@ -1,55 +1,217 @@
 package email
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
-	"os"
-
-	"github.com/joho/godotenv"
+	"net/textproto"
+	"strings"
+	"time"
 )
 
-func loadCredentials() (from, password string, err error) {
-	if err = godotenv.Load(); err != nil {
-		return "", "", fmt.Errorf("error loading .env file: %w", err)
-	}
-	from = os.Getenv("EMAIL")
-	password = os.Getenv("PASSWORD")
-	if from == "" || password == "" {
-		return "", "", fmt.Errorf("EMAIL or PASSWORD not set in .env file")
+// SendMail delivers one message through the configured transport, returning
+// any failure for the caller to retry.
+func SendMail(ctx context.Context, to string, c Content) error {
+	cfg, err := currentConfig()
+	if err != nil {
+		return err
 	}
-	return from, password, nil
+	return Send(ctx, cfg, to, c)
 }
 
-func sendMail(to, subject, body string) error {
-	from, password, err := loadCredentials()
+// Send delivers one message through the server described by cfg.
+func Send(ctx context.Context, cfg Config, to string, c Content) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	msg, err := buildMessage(mail.Address{Name: cfg.FromName, Address: cfg.From}, to, c, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok && cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	var conn net.Conn
+	if cfg.TLS == TLSImplicit {
+		dialer := tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", cfg.Addr())
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", cfg.Addr())
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", cfg.Addr(), err)
+	}
+	defer conn.Close()
+
+	// net/smtp has no context support, so the deadline is applied to the
+	// connection and cancellation closes it to unblock any pending I/O.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if cfg.TLS == TLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if auth := cfg.smtpAuth(); auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(cfg.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
 	if err != nil {
 		return err
 	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage renders c as a MIME message: text/plain alone, or
+// multipart/alternative with an HTML part when c.HTML is set. Parts are
+// quoted-printable so long lines and non-ASCII text survive any relay.
+func buildMessage(from mail.Address, to string, c Content, date time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", c.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if c.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, c.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", c.Text},
+		{"text/html; charset=utf-8", c.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func (c Config) smtpAuth() smtp.Auth {
+	switch c.Auth {
+	case AuthPlain:
+		return smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	case AuthLogin:
+		return &loginAuth{username: c.Username, password: c.Password}
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(c.Username, c.Password)
+	}
+	return nil
+}
 
-	msg := "From: " + from + "\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n\r\n" +
-		body
+// loginAuth implements the LOGIN mechanism, which net/smtp does not provide
+// but some providers (notably Office 365) require.
+type loginAuth struct {
+	username, password string
+}
 
-	auth := smtp.PlainAuth("", from, password, "smtp.gmail.com")
-	return smtp.SendMail("smtp.gmail.com:587", auth, from, []string{to}, []byte(msg))
+// Start refuses to send credentials over an unencrypted connection to
+// anything but localhost, as smtp.PlainAuth does.
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
 }
 
-func SendOTP(toEmail, otp string) {
-	subject := "Crypto Tracker OTP Verification"
-	body := "Your OTP is: " + otp
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
 
-	if err := sendMail(toEmail, subject, body); err != nil {
-		fmt.Println("Error sending OTP email:", err)
-		return
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, errors.New("unexpected LOGIN challenge: " + string(fromServer))
 	}
-	fmt.Println("OTP sent to", toEmail)
 }
 
-func SendAlert(toEmail, subject, body string) {
-	if err := sendMail(toEmail, subject, body); err != nil {
+func SendAlert(ctx context.Context, toEmail, subject, body string) error {
+	if err := SendMail(ctx, toEmail, Content{Subject: subject, Text: body}); err != nil {
 		fmt.Println("Error sending alert email:", err)
-		return
+		return err
 	}
 	fmt.Println("Alert email sent to", toEmail)
+	return nil
 }
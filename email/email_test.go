@@ -0,0 +1,126 @@
+package email_test
+
+import (
+	"context"
+	"crypto-portfolio-tracker/email"
+	"crypto-portfolio-tracker/email/emailtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendMail_DeliversToServer(t *testing.T) {
+	srv := emailtest.NewServer(t)
+	srv.Install(t)
+
+	content, err := email.RenderOTP(nil, email.OTPData{Email: "user@example.com", OTP: "123456", ValidFor: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("rendering OTP email: %v", err)
+	}
+	if err := email.SendMail(context.Background(), "user@example.com", content); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected one message, got %d", len(msgs))
+	}
+	m := msgs[0]
+	if m.From != emailtest.From || len(m.To) != 1 || m.To[0] != "user@example.com" {
+		t.Errorf("unexpected envelope: from %q to %v", m.From, m.To)
+	}
+	if m.AuthUser != emailtest.Username {
+		t.Errorf("expected authenticated session, got user %q", m.AuthUser)
+	}
+	if m.Subject != "Crypto Tracker OTP Verification" || !strings.Contains(m.Text, "Your OTP is: 123456") {
+		t.Errorf("unexpected message: %q / %q", m.Subject, m.Text)
+	}
+	if !strings.Contains(m.HTML, ">123456</p>") || !strings.Contains(m.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Errorf("expected an HTML alternative, got %q (%s)", m.HTML, m.Header.Get("Content-Type"))
+	}
+	if got := m.Header.Get("From"); !strings.Contains(got, "Crypto Portfolio Tracker") {
+		t.Errorf("expected sender name in From header, got %q", got)
+	}
+}
+
+func TestSendMail_PlainTextOnly(t *testing.T) {
+	srv := emailtest.NewServer(t)
+	srv.Install(t)
+
+	body := "Prix : 45 000 € — " + strings.Repeat("long line ", 20)
+	if err := email.SendAlert(context.Background(), "user@example.com", "Alerte : €", body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m := srv.Messages()[0]
+	if m.Subject != "Alerte : €" || strings.TrimSuffix(m.Text, "\n") != body || m.HTML != "" {
+		t.Errorf("expected decoded plain-text message, got %q / %q / %q", m.Subject, m.Text, m.HTML)
+	}
+	if !strings.HasPrefix(m.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("expected a single text/plain part, got %s", m.Header.Get("Content-Type"))
+	}
+}
+
+func TestSend_LoginAuth(t *testing.T) {
+	srv := emailtest.NewServer(t)
+	cfg := srv.Config()
+	cfg.Auth = email.AuthLogin
+
+	if err := email.Send(context.Background(), cfg, "user@example.com", email.Content{Subject: "hi", Text: "body"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(srv.Messages()) != 1 {
+		t.Errorf("expected message delivered with LOGIN auth")
+	}
+}
+
+func TestSend_RejectsBadCredentials(t *testing.T) {
+	srv := emailtest.NewServer(t)
+	cfg := srv.Config()
+	cfg.Password = "wrong"
+
+	if err := email.Send(context.Background(), cfg, "user@example.com", email.Content{Subject: "hi", Text: "body"}); err == nil {
+		t.Error("expected authentication failure")
+	}
+	if len(srv.Messages()) != 0 {
+		t.Errorf("expected nothing delivered, got %d", len(srv.Messages()))
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("EMAIL", "me@example.com")
+	t.Setenv("PASSWORD", "app-password")
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("SMTP_TLS", "implicit")
+	t.Setenv("SMTP_AUTH", "login")
+	t.Setenv("SMTP_TIMEOUT", "5s")
+
+	cfg, err := email.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Host != "mail.example.com" || cfg.Port != 465 || cfg.TLS != email.TLSImplicit || cfg.Auth != email.AuthLogin {
+		t.Errorf("overrides not applied: %+v", cfg)
+	}
+	if cfg.Username != "me@example.com" || cfg.From != "me@example.com" || cfg.Timeout != 5*time.Second {
+		t.Errorf("credential fallbacks not applied: %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected valid config, got: %v", err)
+	}
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	for key, value := range map[string]string{
+		"SMTP_PORT": "smtp",
+		"SMTP_TLS":  "ssl3",
+		"SMTP_AUTH": "xoauth",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := email.ConfigFromEnv(); err == nil {
+				t.Errorf("expected error for %s=%q", key, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+// Package emailtest provides an in-process SMTP server for tests that need
+// to assert on the mail the application sends.
+package emailtest
+
+import (
+	"crypto-portfolio-tracker/email"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	Username = "tracker"
+	Password = "secret"
+	From     = "tracker@example.com"
+)
+
+// Message is one message accepted by the Server.
+type Message struct {
+	From     string
+	To       []string
+	AuthUser string
+	Raw      string
+	Header   mail.Header
+	Subject  string
+	// Text and HTML are the decoded plain-text and HTML parts; HTML is
+	// empty for single-part messages.
+	Text string
+	HTML string
+}
+
+// Server is a minimal plain-text SMTP server supporting AUTH PLAIN and
+// LOGIN. It accepts Username and Password and records every message.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts a server on a free loopback port and stops it when the
+// test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("emailtest: listen: %v", err)
+	}
+
+	s := &Server{ln: ln}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Config returns a transport configuration that delivers to s.
+func (s *Server) Config() email.Config {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return email.Config{
+		Host:     "127.0.0.1",
+		Port:     addr.Port,
+		TLS:      email.TLSNone,
+		Auth:     email.AuthPlain,
+		Username: Username,
+		Password: Password,
+		From:     From,
+		FromName: "Crypto Portfolio Tracker",
+		Timeout:  5 * time.Second,
+	}
+}
+
+// Install makes s the transport for every send until the test ends.
+func (s *Server) Install(t testing.TB) {
+	cfg := s.Config()
+	email.Configure(&cfg)
+	t.Cleanup(func() { email.Configure(nil) })
+}
+
+// Messages returns the messages accepted so far, oldest first.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+func (s *Server) Close() {
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(10 * time.Second))
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+func (s *Server) handle(c *textproto.Conn) {
+	reply := func(code int, msg string) { c.PrintfLine("%d %s", code, msg) }
+
+	var msg Message
+	var authUser string
+	reply(220, "emailtest ESMTP ready")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			c.PrintfLine("250-emailtest")
+			c.PrintfLine("250-8BITMIME")
+			c.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "HELO":
+			reply(250, "emailtest")
+		case "AUTH":
+			user, ok := s.auth(c, arg)
+			if !ok {
+				reply(535, "authentication failed")
+				continue
+			}
+			authUser = user
+			reply(235, "authenticated")
+		case "MAIL":
+			msg = Message{From: trimPath(arg, "FROM:"), AuthUser: authUser}
+			reply(250, "ok")
+		case "RCPT":
+			msg.To = append(msg.To, trimPath(arg, "TO:"))
+			reply(250, "ok")
+		case "DATA":
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.record(msg, data)
+			reply(250, "queued")
+		case "RSET":
+			msg = Message{AuthUser: authUser}
+			reply(250, "ok")
+		case "NOOP":
+			reply(250, "ok")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+func (s *Server) auth(c *textproto.Conn, arg string) (string, bool) {
+	mech, initial, _ := strings.Cut(arg, " ")
+	challenge := func(prompt string) string {
+		c.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, _ := c.ReadLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded)
+	}
+
+	switch strings.ToUpper(mech) {
+	case "PLAIN":
+		var creds string
+		if initial != "" {
+			decoded, _ := base64.StdEncoding.DecodeString(initial)
+			creds = string(decoded)
+		} else {
+			creds = challenge("")
+		}
+		parts := strings.Split(creds, "\x00")
+		if len(parts) != 3 {
+			return "", false
+		}
+		return parts[1], parts[1] == Username && parts[2] == Password
+	case "LOGIN":
+		user := challenge("Username:")
+		pass := challenge("Password:")
+		return user, user == Username && pass == Password
+	}
+	return "", false
+}
+
+func (s *Server) record(msg Message, data []byte) {
+	msg.Raw = string(data)
+	if parsed, err := mail.ReadMessage(strings.NewReader(msg.Raw)); err == nil {
+		msg.Header = parsed.Header
+		msg.Subject, _ = new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		readParts(&msg, textproto.MIMEHeader(parsed.Header), parsed.Body)
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	s.mu.Unlock()
+}
+
+// readParts decodes a text/plain or multipart/alternative body into msg.
+func readParts(msg *Message, header textproto.MIMEHeader, body io.Reader) {
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextPart undoes quoted-printable itself.
+			part, err := mr.NextPart()
+			if err != nil {
+				return
+			}
+			readParts(msg, part.Header, part)
+		}
+	}
+
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	content, _ := io.ReadAll(body)
+	if mediaType == "text/html" {
+		msg.HTML = string(content)
+	} else {
+		msg.Text = string(content)
+	}
+}
+
+func trimPath(arg, prefix string) string {
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	arg, _, _ = strings.Cut(arg, " ")
+	return strings.Trim(arg, "<>")
+}
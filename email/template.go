@@ -0,0 +1,229 @@
+package email
+
+import (
+	"bytes"
+	"crypto-portfolio-tracker/currency"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var builtinFS embed.FS
+
+// Content is a rendered email. HTML is optional; when set the message is
+// sent as multipart/alternative with Text as the fallback.
+type Content struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type OTPData struct {
+	Email    string
+	OTP      string
+	ValidFor time.Duration
+}
+
+// AlertData describes a fired alert. Subject and Message are the built-in
+// plain-text rendering, which custom templates may reuse.
+type AlertData struct {
+	CoinID    string
+	CoinName  string
+	AlertType models.AlertType
+	Condition string
+	// Observed is the formatted price or metric that met the condition.
+	Observed string
+	Currency string
+	FiredAt  time.Time
+	Subject  string
+	Message  string
+}
+
+// ReportData is a portfolio summary over a period, such as a digest.
+type ReportData struct {
+	Title              string
+	PeriodStart        time.Time
+	PeriodEnd          time.Time
+	Currency           string
+	TotalValue         float64
+	TotalProfitLoss    float64
+	TotalProfitLossPct float64
+	Holdings           []ReportHolding
+	// TopMovers are the holdings with the largest price change over the
+	// period, biggest first.
+	TopMovers []ReportHolding
+	Alerts    []ReportAlert
+}
+
+type ReportHolding struct {
+	CoinID        string
+	CoinName      string
+	Quantity      float64
+	Value         float64
+	ProfitLoss    float64
+	ProfitLossPct float64
+	// BoughtIn is set to the purchase currency when it differs from the
+	// report's, in which case the holding has no profit or loss.
+	BoughtIn string
+	// Change is the price change over the period, in percent.
+	Change float64
+}
+
+type ReportAlert struct {
+	FiredAt   time.Time
+	CoinName  string
+	Condition string
+	Observed  string
+}
+
+var templateFuncs = map[string]any{
+	"money":       currency.Format,
+	"signedMoney": currency.FormatSigned,
+	"pct":         func(v float64) string { return fmt.Sprintf("%+.2f%%", v) },
+	"date":        func(t time.Time) string { return t.Format("02 Jan 2006, 15:04 MST") },
+	"minutes":     func(d time.Duration) int { return int(d.Round(time.Minute).Minutes()) },
+	"upper":       strings.ToUpper,
+}
+
+// sampleData is rendered when a template is validated, so references to
+// missing fields are caught on save rather than when the email is sent.
+var sampleData = map[models.TemplateKind]any{
+	models.TemplateOTP: OTPData{Email: "user@example.com", OTP: "123456", ValidFor: 10 * time.Minute},
+	models.TemplateAlert: AlertData{
+		CoinID: "bitcoin", CoinName: "Bitcoin", AlertType: models.AlertTypeSell,
+		Condition: "SELL at $45000.00", Observed: "$45100.00", Currency: "usd",
+		FiredAt: time.Date(2024, 1, 2, 15, 4, 0, 0, time.UTC),
+		Subject: "Crypto Alert: Bitcoin SELL threshold reached!", Message: "Hello,\n\nYour SELL alert for Bitcoin has been triggered.",
+	},
+	models.TemplateReport: ReportData{
+		Title: "daily digest", Currency: "usd",
+		PeriodStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), PeriodEnd: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		TotalValue: 52000, TotalProfitLoss: 2000, TotalProfitLossPct: 4,
+		Holdings:  []ReportHolding{{CoinID: "bitcoin", CoinName: "Bitcoin", Quantity: 1, Value: 52000, ProfitLoss: 2000, ProfitLossPct: 4, Change: 1.5}},
+		TopMovers: []ReportHolding{{CoinID: "bitcoin", CoinName: "Bitcoin", Value: 52000, Change: 1.5}},
+		Alerts:    []ReportAlert{{FiredAt: time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), CoinName: "Bitcoin", Condition: "SELL at $51000.00", Observed: "$51020.00"}},
+	},
+}
+
+// Builtin returns the built-in template source for kind, for display and as
+// a starting point for overrides.
+func Builtin(kind models.TemplateKind) (models.EmailTemplate, error) {
+	t := models.EmailTemplate{Kind: kind}
+	for _, part := range []struct {
+		ext string
+		dst *string
+	}{{"subject", &t.Subject}, {"txt", &t.Text}, {"html", &t.HTML}} {
+		src, err := builtinFS.ReadFile("templates/" + string(kind) + "." + part.ext + ".tmpl")
+		if err != nil {
+			return t, customerrors.NewValidationError("template kind", kind, fmt.Errorf("%w: unknown kind", customerrors.ErrInvalidTemplate))
+		}
+		*part.dst = string(src)
+	}
+	return t, nil
+}
+
+// ValidateTemplate parses every part of t and renders it against sample
+// data of its kind.
+func ValidateTemplate(t models.EmailTemplate) error {
+	sample, ok := sampleData[t.Kind]
+	if !ok {
+		return customerrors.NewValidationError("template kind", t.Kind, fmt.Errorf("%w: unknown kind", customerrors.ErrInvalidTemplate))
+	}
+	_, err := render(t.Kind, &t, sample)
+	return err
+}
+
+// Preview renders the given template, or the built-in one when override is
+// nil, against sample data.
+func Preview(kind models.TemplateKind, override *models.EmailTemplate) (Content, error) {
+	sample, ok := sampleData[kind]
+	if !ok {
+		return Content{}, customerrors.NewValidationError("template kind", kind, fmt.Errorf("%w: unknown kind", customerrors.ErrInvalidTemplate))
+	}
+	return render(kind, override, sample)
+}
+
+// RenderOTP, RenderAlert and RenderReport render an email from the user's
+// override, which may be nil, falling back to the built-in template for any
+// part the override leaves empty.
+func RenderOTP(override *models.EmailTemplate, d OTPData) (Content, error) {
+	return render(models.TemplateOTP, override, d)
+}
+
+func RenderAlert(override *models.EmailTemplate, d AlertData) (Content, error) {
+	return render(models.TemplateAlert, override, d)
+}
+
+func RenderReport(override *models.EmailTemplate, d ReportData) (Content, error) {
+	return render(models.TemplateReport, override, d)
+}
+
+func render(kind models.TemplateKind, override *models.EmailTemplate, data any) (Content, error) {
+	src, err := Builtin(kind)
+	if err != nil {
+		return Content{}, err
+	}
+	if override != nil {
+		if override.Subject != "" {
+			src.Subject = override.Subject
+		}
+		if override.Text != "" {
+			src.Text = override.Text
+		}
+		if override.HTML != "" {
+			src.HTML = override.HTML
+		}
+	}
+
+	var c Content
+	if c.Subject, err = renderText(kind, "subject", src.Subject, data); err != nil {
+		return Content{}, err
+	}
+	c.Subject = strings.Join(strings.Fields(c.Subject), " ")
+	if c.Subject == "" {
+		return Content{}, templateError(kind, "subject", fmt.Errorf("renders to an empty subject"))
+	}
+	if c.Text, err = renderText(kind, "text", src.Text, data); err != nil {
+		return Content{}, err
+	}
+	if c.HTML, err = renderHTML(kind, src.HTML, data); err != nil {
+		return Content{}, err
+	}
+	return c, nil
+}
+
+func renderText(kind models.TemplateKind, part, src string, data any) (string, error) {
+	t, err := template.New(part).Funcs(templateFuncs).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", templateError(kind, part, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", templateError(kind, part, err)
+	}
+	return buf.String(), nil
+}
+
+func renderHTML(kind models.TemplateKind, src string, data any) (string, error) {
+	t, err := htmltemplate.New("html").Funcs(templateFuncs).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", templateError(kind, "html", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", templateError(kind, "html", err)
+	}
+	return buf.String(), nil
+}
+
+// templateError names the failing part rather than echoing its source,
+// which can run to many lines.
+func templateError(kind models.TemplateKind, part string, err error) error {
+	return customerrors.NewValidationError("template", string(kind)+" "+part, fmt.Errorf("%w: %v", customerrors.ErrInvalidTemplate, err))
+}
@@ -0,0 +1,74 @@
+package email
+
+import (
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreview_Builtins(t *testing.T) {
+	for _, kind := range []models.TemplateKind{models.TemplateOTP, models.TemplateAlert, models.TemplateReport} {
+		c, err := Preview(kind, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if c.Subject == "" || c.Text == "" || c.HTML == "" {
+			t.Errorf("%s: expected every part rendered, got %+v", kind, c)
+		}
+	}
+
+	c, _ := Preview(models.TemplateReport, nil)
+	for _, want := range []string{"Total Value     : $52000.00", "Bitcoin         : $52000.00, P/L +$2000.00 (+4.00%)", "Alerts fired:"} {
+		if !strings.Contains(c.Text, want) {
+			t.Errorf("expected report text to contain %q, got:\n%s", want, c.Text)
+		}
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		tmpl models.EmailTemplate
+		want string
+	}{
+		{"syntax", models.EmailTemplate{Kind: models.TemplateAlert, Text: "{{.CoinName"}, "alert text"},
+		{"unknown field", models.EmailTemplate{Kind: models.TemplateAlert, HTML: "<p>{{.Price}}</p>"}, "alert html"},
+		{"unknown func", models.EmailTemplate{Kind: models.TemplateReport, Subject: "{{euro .TotalValue}}"}, "report subject"},
+		{"empty subject", models.EmailTemplate{Kind: models.TemplateAlert, Subject: "{{if false}}x{{end}}"}, "empty subject"},
+		{"unknown kind", models.EmailTemplate{Kind: "digest"}, "unknown kind"},
+	}
+	for _, tt := range tests {
+		err := ValidateTemplate(tt.tmpl)
+		if !errors.Is(err, customerrors.ErrInvalidTemplate) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected ErrInvalidTemplate mentioning %q, got: %v", tt.name, tt.want, err)
+		}
+	}
+
+	ok := models.EmailTemplate{Kind: models.TemplateAlert, Subject: "{{upper .CoinName}} hit {{.Observed}}"}
+	if err := ValidateTemplate(ok); err != nil {
+		t.Errorf("expected valid template, got: %v", err)
+	}
+}
+
+func TestRenderAlert_Override(t *testing.T) {
+	override := &models.EmailTemplate{
+		Kind:    models.TemplateAlert,
+		Subject: "{{.CoinName}}\n  alert",
+		HTML:    "<b>{{.Condition}}</b>",
+	}
+	c, err := RenderAlert(override, AlertData{CoinName: "Bit<coin>", Condition: "price < 5 && x", Message: "plain body"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Subject != "Bit<coin> alert" {
+		t.Errorf("expected subject on one line, got %q", c.Subject)
+	}
+	if c.Text != "plain body\n" {
+		t.Errorf("expected built-in text part to be kept, got %q", c.Text)
+	}
+	if c.HTML != "<b>price &lt; 5 &amp;&amp; x</b>" {
+		t.Errorf("expected escaped HTML, got %q", c.HTML)
+	}
+}
@@ -6,17 +6,29 @@ import (
 )
 
 var (
-	ErrEmptyHoldings      = errors.New("no holdings provided")
-	ErrEmptyPortfolio     = errors.New("portfolio is empty")
-	ErrCoinNotFound       = errors.New("coin not found in portfolio")
-	ErrPriceNotAvailable  = errors.New("price not available")
-	ErrInvalidQuantity    = errors.New("invalid quantity")
-	ErrInvalidPrice       = errors.New("invalid price")
-	ErrDatabaseConnection = errors.New("database connection failed")
-	ErrRateLimitExceeded  = errors.New("API rate limit exceeded")
-	ErrAuthFailed         = errors.New("authentication failed")
-	ErrEmailExists        = errors.New("email already exists")
-	ErrInvalidOTP         = errors.New("invalid OTP")
+	ErrEmptyHoldings          = errors.New("no holdings provided")
+	ErrEmptyPortfolio         = errors.New("portfolio is empty")
+	ErrCoinNotFound           = errors.New("coin not found in portfolio")
+	ErrPriceNotAvailable      = errors.New("price not available")
+	ErrInvalidQuantity        = errors.New("invalid quantity")
+	ErrInvalidPrice           = errors.New("invalid price")
+	ErrDatabaseConnection     = errors.New("database connection failed")
+	ErrRateLimitExceeded      = errors.New("API rate limit exceeded")
+	ErrAuthFailed             = errors.New("authentication failed")
+	ErrEmailExists            = errors.New("email already exists")
+	ErrInvalidOTP             = errors.New("invalid OTP")
+	ErrInvalidTransaction     = errors.New("invalid transaction")
+	ErrInsufficientFunds      = errors.New("insufficient quantity held")
+	ErrInvalidCostBasisMethod = errors.New("unknown cost basis method")
+	ErrUnsupportedCurrency    = errors.New("unsupported currency")
+	ErrCurrencyMismatch       = errors.New("amounts are in different currencies")
+	ErrNotFound               = errors.New("record not found")
+	ErrConflict               = errors.New("record was modified concurrently")
+	ErrInvalidAlert           = errors.New("invalid alert")
+	ErrUnknownCoin            = errors.New("coin not supported by the price provider")
+	ErrAlreadyWatched         = errors.New("coin is already on the watchlist")
+	ErrNotWatched             = errors.New("coin is not on the watchlist")
+	ErrInvalidTemplate        = errors.New("invalid email template")
 )
 
 type PortfolioError struct {
@@ -2,19 +2,23 @@ module crypto-portfolio-tracker
 
 go 1.25.5
 
+require (
+	github.com/joho/godotenv v1.5.1
+	go.etcd.io/bbolt v1.4.3
+	go.mongodb.org/mongo-driver v1.17.6
+	golang.org/x/crypto v0.26.0
+	golang.org/x/sync v0.10.0
+	golang.org/x/term v0.41.0
+)
+
 require (
 	github.com/golang/snappy v0.0.4 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/klauspost/compress v1.16.7 // indirect
 	github.com/montanaflynn/stats v0.7.1 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/scram v1.1.2 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
-	go.mongodb.org/mongo-driver v1.17.6 // indirect
-	golang.org/x/crypto v0.26.0 // indirect
-	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.42.0 // indirect
-	golang.org/x/term v0.41.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
 )
@@ -2,29 +2,114 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"crypto-portfolio-tracker/alert"
 	"crypto-portfolio-tracker/api"
 	"crypto-portfolio-tracker/auth"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/digest"
+	"crypto-portfolio-tracker/email"
 	customerrors "crypto-portfolio-tracker/errors"
 	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/outbox"
 	"crypto-portfolio-tracker/portfolio"
+	"crypto-portfolio-tracker/watchlist"
+
+	"github.com/joho/godotenv"
 )
 
 func main() {
+	schedulerMode := flag.Bool("scheduler", false, "run the background alert scheduler instead of the interactive menu")
+	interval := flag.Duration("interval", alert.DefaultCheckInterval, "delay between scheduled alert checks")
+	jitter := flag.Duration("jitter", 10*time.Second, "maximum random delay added to each scheduled check")
+	flag.Parse()
+
 	reader := bufio.NewReader(os.Stdin)
 
-	cryptoAPI, err := api.NewCoinGecko()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Failed to load .env file: %v\n", err)
+		return
+	}
+
+	if cfg, err := email.ConfigFromEnv(); err != nil {
+		fmt.Printf("Warning: invalid SMTP settings, emails will not be sent: %v\n", err)
+	} else {
+		email.Configure(&cfg)
+	}
+
+	cryptoAPI, err := api.NewFromEnv()
+	if err != nil {
+		fmt.Printf("Failed to initialize price providers: %v\n", err)
+		return
+	}
+	printCacheStats := func() {}
+	if cache, ok := cryptoAPI.(*api.Cache); ok {
+		printCacheStats = func() { fmt.Printf("Price cache: %v\n", cache.Stats()) }
+	}
+	defer printCacheStats()
+
+	store, err := db.Open(ctx)
 	if err != nil {
-		fmt.Printf("Failed to initialize CoinGecko API: %v\n", err)
+		fmt.Printf("Failed to open storage: %v\n", err)
 		return
 	}
+	defer store.Close()
+
+	if err := store.Ping(ctx); err != nil {
+		fmt.Printf("Storage is not reachable: %v\n", err)
+		return
+	}
+
+	if *schedulerMode {
+		runScheduler(ctx, store, cryptoAPI, *interval, *jitter)
+		return
+	}
+
+	// Retry queued emails while the menu is open too, so a failed OTP or
+	// alert email does not wait for a scheduler process.
+	w := outbox.NewWorker(store, outbox.DefaultInterval)
+	w.Quiet = true
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-outboxDone
+	}()
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-shutdown
+		fmt.Println("\nShutting down...")
+		// Cancelling first aborts any in-flight API, database or SMTP call
+		// before the store is closed underneath it.
+		cancel()
+		<-outboxDone
+		if err := store.Close(); err != nil {
+			fmt.Printf("Error closing storage: %v\n", err)
+		}
+		// os.Exit skips the deferred calls in main.
+		printCacheStats()
+		os.Exit(0)
+	}()
 
 	for {
 		fmt.Println("\n1. Signup\n2. Login\n3. Exit")
@@ -50,7 +135,7 @@ func main() {
 				continue
 			}
 
-			if auth.Signup(email, password, reader) {
+			if auth.Signup(ctx, store, email, password, reader) {
 				fmt.Println("You can now log in with your new account.")
 			}
 
@@ -65,8 +150,8 @@ func main() {
 				continue
 			}
 
-			if auth.Login(email, password) {
-				handlePortfolioMenu(email, cryptoAPI, reader)
+			if auth.Login(ctx, store, email, password) {
+				handlePortfolioMenu(ctx, store, email, cryptoAPI, reader)
 			} else {
 				fmt.Println("Login failed. Please check your email and password.")
 			}
@@ -80,7 +165,45 @@ func main() {
 	}
 }
 
-func handlePortfolioMenu(userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+func runScheduler(ctx context.Context, store db.Store, cryptoAPI api.CryptoApi, interval, jitter time.Duration) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The email outbox is drained alongside, so alert emails that failed
+	// their first attempt are retried.
+	w := outbox.NewWorker(store, outbox.DefaultInterval)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	defer func() { <-done }()
+
+	d := digest.NewScheduler(store, cryptoAPI, digest.DefaultCheckInterval)
+	digestDone := make(chan struct{})
+	go func() {
+		defer close(digestDone)
+		d.Run(ctx)
+	}()
+	defer func() { <-digestDone }()
+
+	s := alert.NewScheduler(store, cryptoAPI, interval, jitter)
+	fmt.Printf("Alert scheduler started (interval %v, jitter %v). Press Ctrl-C to stop.\n", s.Interval, s.Jitter)
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		stop()
+		fmt.Printf("Alert scheduler stopped: %v\n", err)
+		return
+	}
+	fmt.Println("Alert scheduler stopped.")
+}
+
+func handlePortfolioMenu(ctx context.Context, store db.Store, userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	vsCurrency, err := auth.GetPreferredCurrency(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Could not load preferred currency, using %s: %v\n", strings.ToUpper(currency.Default), err)
+		vsCurrency = currency.Default
+	}
+
 	for {
 		fmt.Println("\n\n=== Portfolio Menu ===")
 		fmt.Println("1. View Portfolio")
@@ -94,7 +217,21 @@ func handlePortfolioMenu(userEmail string, cryptoAPI api.CryptoApi, reader *bufi
 		fmt.Println("9. View Active Alerts")
 		fmt.Println("10. Check Alerts Now")
 		fmt.Println("11. Delete Alert")
-		fmt.Println("12. LogOut")
+		fmt.Println("12. Record Transaction (Sell/Transfer/Fee/Reward)")
+		fmt.Println("13. View Transaction History")
+		fmt.Println("14. View Cost Basis Lots")
+		fmt.Println("15. Set Cost Basis Method")
+		fmt.Println("16. Export Tax Report (CSV)")
+		fmt.Printf("17. Set Preferred Currency (current: %s)\n", strings.ToUpper(vsCurrency))
+		fmt.Println("18. Set Portfolio Alert (Total Value/P&L/Coin Weight)")
+		fmt.Println("19. Set Custom Condition Alert")
+		fmt.Println("20. Manage Watchlist")
+		fmt.Println("21. View Alert History")
+		fmt.Println("22. Set Notification Channels (Email/Webhook/File)")
+		fmt.Println("23. View Email Outbox")
+		fmt.Println("24. Customize Email Templates")
+		fmt.Println("25. Schedule Portfolio Digest Emails")
+		fmt.Println("26. LogOut")
 		fmt.Print("Enter The Option: ")
 
 		choice, _ := reader.ReadString('\n')
@@ -108,46 +245,90 @@ func handlePortfolioMenu(userEmail string, cryptoAPI api.CryptoApi, reader *bufi
 
 		switch option {
 		case 1:
-			if err := portfolio.DisplayPortfolio(userEmail, cryptoAPI); err != nil {
+			if err := portfolio.DisplayPortfolio(ctx, store, userEmail, cryptoAPI, vsCurrency); err != nil {
 				fmt.Printf("Error displaying portfolio: %v\n", err)
 			}
 
 		case 2:
-			addSingleHolding(userEmail, reader)
+			addSingleHolding(ctx, store, userEmail, vsCurrency, reader)
 
 		case 3:
-			addMultipleHoldings(userEmail, reader)
+			addMultipleHoldings(ctx, store, userEmail, vsCurrency, reader)
 
 		case 4:
-			calculateTotal(userEmail, cryptoAPI)
+			calculateTotal(ctx, store, userEmail, vsCurrency, cryptoAPI)
 
 		case 5:
-			calculateProfitLoss(userEmail, cryptoAPI, reader)
+			calculateProfitLoss(ctx, store, userEmail, vsCurrency, cryptoAPI, reader)
 
 		case 6:
-			exportPortfolioJSON(userEmail)
+			exportPortfolioJSON(ctx, store, userEmail)
 
 		case 7:
-			importPortfolioJSON(reader)
+			importPortfolioJSON(vsCurrency, reader)
 
 		case 8:
-			setPriceAlert(userEmail, cryptoAPI, reader)
+			setPriceAlert(ctx, store, userEmail, vsCurrency, cryptoAPI, reader)
 
 		case 9:
-			if err := alert.DisplayAlerts(userEmail); err != nil {
+			if err := alert.DisplayAlerts(ctx, store, userEmail); err != nil {
 				fmt.Printf("Error displaying alerts: %v\n", err)
 			}
 
 		case 10:
 			fmt.Println("\nChecking alerts against current prices...")
-			if err := alert.CheckAndTriggerAlerts(userEmail, cryptoAPI); err != nil {
+			if err := alert.CheckAndTriggerAlerts(ctx, store, userEmail, cryptoAPI); err != nil {
 				fmt.Printf("Error checking alerts: %v\n", err)
 			}
 
 		case 11:
-			deleteAlert(userEmail, reader)
+			deleteAlert(ctx, store, userEmail, reader)
 
 		case 12:
+			recordTransaction(ctx, store, userEmail, vsCurrency, reader)
+
+		case 13:
+			viewTransactions(ctx, store, userEmail, reader)
+
+		case 14:
+			viewCostBasis(ctx, store, userEmail)
+
+		case 15:
+			setCostBasisMethod(ctx, store, userEmail, reader)
+
+		case 16:
+			exportTaxReport(ctx, store, userEmail, reader)
+
+		case 17:
+			if code, ok := setPreferredCurrency(ctx, store, userEmail, reader); ok {
+				vsCurrency = code
+			}
+
+		case 18:
+			setPortfolioAlert(ctx, store, userEmail, vsCurrency, cryptoAPI, reader)
+
+		case 19:
+			setExpressionAlert(ctx, store, userEmail, vsCurrency, cryptoAPI, reader)
+
+		case 20:
+			manageWatchlist(ctx, store, userEmail, vsCurrency, cryptoAPI, reader)
+
+		case 21:
+			viewAlertHistory(ctx, store, userEmail, reader)
+
+		case 22:
+			setNotificationChannels(ctx, store, userEmail, reader)
+
+		case 23:
+			viewOutbox(ctx, store, userEmail, reader)
+
+		case 24:
+			customizeEmailTemplates(ctx, store, userEmail, reader)
+
+		case 25:
+			scheduleDigest(ctx, store, userEmail, cryptoAPI, reader)
+
+		case 26:
 			fmt.Println("Logging Out")
 			return
 		default:
@@ -156,8 +337,8 @@ func handlePortfolioMenu(userEmail string, cryptoAPI api.CryptoApi, reader *bufi
 	}
 }
 
-func exportPortfolioJSON(userEmail string) {
-	p, err := portfolio.GetPortfolio(userEmail)
+func exportPortfolioJSON(ctx context.Context, store db.Store, userEmail string) {
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
 	if err != nil {
 		fmt.Printf("Error fetching portfolio: %v\n", err)
 		return
@@ -182,7 +363,7 @@ func exportPortfolioJSON(userEmail string) {
 	fmt.Println(string(prettyBytes))
 }
 
-func importPortfolioJSON(reader *bufio.Reader) {
+func importPortfolioJSON(vsCurrency string, reader *bufio.Reader) {
 	fmt.Print("\n")
 	fmt.Println(`Example:`)
 	fmt.Println(`{"user_email":"you@example.com","holdings":[{"coin_id":"bitcoin","coin_name":"Bitcoin","quantity":0.5,"buy_price":40000,"added_at":"2024-01-15T10:30:00Z"}]}`)
@@ -212,14 +393,18 @@ func importPortfolioJSON(reader *bufio.Reader) {
 		fmt.Printf("\n  Holding[%d]:\n", i+1)
 		fmt.Printf("    Coin      : %s (%s)\n", h.CoinName, h.CoinID)
 		fmt.Printf("    Quantity  : %.4f\n", h.Quantity)
-		fmt.Printf("    Buy Price : $%.2f\n", h.BuyPrice)
+		buyCurrency := h.Currency
+		if buyCurrency == "" {
+			buyCurrency = vsCurrency
+		}
+		fmt.Printf("    Buy Price : %s\n", currency.Format(h.BuyPrice, buyCurrency))
 		fmt.Printf("    Added At  : %s\n",
 			h.AddedAt.Format("02 Jan 2006, 15:04:05 UTC"))
 	}
 
 }
 
-func addMultipleHoldings(userEmail string, reader *bufio.Reader) {
+func addMultipleHoldings(ctx context.Context, store db.Store, userEmail, vsCurrency string, reader *bufio.Reader) {
 	fmt.Print("How many holdings do you want to add? ")
 	countStr, _ := reader.ReadString('\n')
 	count, err := strconv.Atoi(strings.TrimSpace(countStr))
@@ -260,7 +445,7 @@ func addMultipleHoldings(userEmail string, reader *bufio.Reader) {
 		priceType, _ := reader.ReadString('\n')
 		priceType = strings.TrimSpace(strings.ToLower(priceType))
 
-		fmt.Print("Buy Price: ")
+		fmt.Printf("Buy Price (%s): ", strings.ToUpper(vsCurrency))
 		priceStr, _ := reader.ReadString('\n')
 		buyPrice, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
 		if err != nil || buyPrice <= 0 {
@@ -270,7 +455,7 @@ func addMultipleHoldings(userEmail string, reader *bufio.Reader) {
 
 		if priceType == "t" {
 			buyPrice = buyPrice / quantity
-			fmt.Printf("Per-coin price calculated: $%.2f\n", buyPrice)
+			fmt.Printf("Per-coin price calculated: %s\n", currency.Format(buyPrice, vsCurrency))
 		}
 
 		holdings = append(holdings, models.Holding{
@@ -278,6 +463,7 @@ func addMultipleHoldings(userEmail string, reader *bufio.Reader) {
 			CoinName: coinName,
 			Quantity: quantity,
 			BuyPrice: buyPrice,
+			Currency: vsCurrency,
 		})
 	}
 
@@ -286,7 +472,7 @@ func addMultipleHoldings(userEmail string, reader *bufio.Reader) {
 		return
 	}
 
-	if err := portfolio.AddMultipleHoldings(userEmail, holdings...); err != nil {
+	if err := portfolio.AddMultipleHoldings(ctx, store, userEmail, holdings...); err != nil {
 		fmt.Printf("Error adding holdings: %v\n", err)
 		return
 	}
@@ -294,8 +480,8 @@ func addMultipleHoldings(userEmail string, reader *bufio.Reader) {
 	fmt.Printf("%d holding(s) added successfully!\n", len(holdings))
 }
 
-func calculateTotal(userEmail string, cryptoAPI api.CryptoApi) {
-	p, err := portfolio.GetPortfolio(userEmail)
+func calculateTotal(ctx context.Context, store db.Store, userEmail, vsCurrency string, cryptoAPI api.CryptoApi) {
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
@@ -306,18 +492,18 @@ func calculateTotal(userEmail string, cryptoAPI api.CryptoApi) {
 		return
 	}
 
-	total, err := portfolio.CalculateTotalValue(p, cryptoAPI)
+	total, err := portfolio.CalculateTotalValue(ctx, p, cryptoAPI, vsCurrency)
 	if err != nil {
 		fmt.Printf("Error calculating total: %v\n", err)
 		return
 	}
 
-	fmt.Printf("\nTotal Portfolio Value: $%.2f\n", total)
+	fmt.Printf("\nTotal Portfolio Value: %s\n", currency.Format(total, vsCurrency))
 }
 
-func calculateProfitLoss(userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+func calculateProfitLoss(ctx context.Context, store db.Store, userEmail, vsCurrency string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
 	fmt.Println("\nLoading your portfolio...")
-	p, err := portfolio.GetPortfolio(userEmail)
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
 	if err != nil {
 		var dbErr *customerrors.DatabaseError
 		if errors.As(err, &dbErr) {
@@ -337,7 +523,7 @@ func calculateProfitLoss(userEmail string, cryptoAPI api.CryptoApi, reader *bufi
 	choice, _ := reader.ReadString('\n')
 	choice = strings.TrimSpace(strings.ToLower(choice))
 
-	var profitLoss map[string]float64
+	var report *portfolio.ProfitLossReport
 
 	if choice == "y" {
 		fmt.Print("Enter coin IDs (comma-separated): ")
@@ -360,10 +546,10 @@ func calculateProfitLoss(userEmail string, cryptoAPI api.CryptoApi, reader *bufi
 		}
 
 		fmt.Println("\nCalculating profit/loss...")
-		profitLoss, err = portfolio.CalculateProfitLoss(p, cryptoAPI, filtered...)
+		report, err = portfolio.GenerateProfitLossReport(ctx, store, userEmail, cryptoAPI, vsCurrency, filtered...)
 	} else {
 		fmt.Println("\nCalculating profit/loss for all holdings...")
-		profitLoss, err = portfolio.CalculateProfitLoss(p, cryptoAPI)
+		report, err = portfolio.GenerateProfitLossReport(ctx, store, userEmail, cryptoAPI, vsCurrency)
 	}
 
 	if err != nil {
@@ -387,27 +573,61 @@ func calculateProfitLoss(userEmail string, cryptoAPI api.CryptoApi, reader *bufi
 		return
 	}
 
-	if len(profitLoss) == 0 {
+	if len(report.Coins) == 0 {
 		fmt.Println("No profit/loss data available.")
 		return
 	}
 
-	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("PROFIT/LOSS ANALYSIS")
-	fmt.Println(strings.Repeat("=", 60))
+	printProfitLossReport(report)
+}
 
-	var totalProfitLoss float64
-	for coin, pl := range profitLoss {
-		fmt.Printf(" %-20s: $%+.2f\n", coin, pl)
-		totalProfitLoss += pl
+func formatHoldingPeriod(d time.Duration) string {
+	if d <= 0 {
+		return "-"
 	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
 
-	fmt.Println(strings.Repeat("-", 60))
-	fmt.Printf("TOTAL PROFIT/LOSS: $%+.2f\n", totalProfitLoss)
-	fmt.Println(strings.Repeat("=", 60))
+func printProfitLossReport(report *portfolio.ProfitLossReport) {
+	fmt.Println("\n" + strings.Repeat("=", 100))
+	fmt.Printf("PROFIT/LOSS REPORT (%s, %s cost basis)\n", strings.ToUpper(report.Currency), strings.ToUpper(string(report.Method)))
+	fmt.Println(strings.Repeat("=", 100))
+	fmt.Printf(" %-14s %12s %13s %13s %14s %8s %13s %8s %6s\n",
+		"Coin", "Quantity", "Cost Basis", "Value", "Unrealized", "%", "Realized", "%", "Held")
+	fmt.Println(strings.Repeat("-", 100))
+
+	for _, c := range report.Coins {
+		fmt.Printf(" %-14s %12.4f %13.2f %13.2f %+14.2f %+7.2f%% %+13.2f %+7.2f%% %6s\n",
+			c.CoinID,
+			c.Quantity,
+			c.CostBasis,
+			c.MarketValue,
+			c.Unrealized,
+			c.UnrealizedPercent,
+			c.Realized,
+			c.RealizedPercent,
+			formatHoldingPeriod(c.HoldingPeriod),
+		)
+	}
+
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf(" %-14s %12s %13.2f %13.2f %+14.2f %+7.2f%% %+13.2f %+7.2f%%\n",
+		"TOTAL", "",
+		report.TotalCostBasis,
+		report.TotalMarketValue,
+		report.TotalUnrealized,
+		report.TotalUnrealizedPercent,
+		report.TotalRealized,
+		report.TotalRealizedPercent,
+	)
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("UNREALIZED P/L : %s\n", currency.FormatSigned(report.TotalUnrealized, report.Currency))
+	fmt.Printf("REALIZED P/L   : %s\n", currency.FormatSigned(report.TotalRealized, report.Currency))
+	fmt.Printf("TOTAL P/L      : %s\n", currency.FormatSigned(report.Total, report.Currency))
+	fmt.Println(strings.Repeat("=", 100))
 }
 
-func addSingleHolding(userEmail string, reader *bufio.Reader) {
+func addSingleHolding(ctx context.Context, store db.Store, userEmail, vsCurrency string, reader *bufio.Reader) {
 	fmt.Print("Enter Coin ID (e.g., bitcoin): ")
 	coinID, _ := reader.ReadString('\n')
 	coinID = strings.TrimSpace(coinID)
@@ -428,7 +648,7 @@ func addSingleHolding(userEmail string, reader *bufio.Reader) {
 	priceType, _ := reader.ReadString('\n')
 	priceType = strings.TrimSpace(strings.ToLower(priceType))
 
-	fmt.Print("Enter Buy Price: ")
+	fmt.Printf("Enter Buy Price (%s): ", strings.ToUpper(vsCurrency))
 	priceStr, _ := reader.ReadString('\n')
 	buyPrice, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
 	if err != nil || buyPrice <= 0 {
@@ -438,7 +658,7 @@ func addSingleHolding(userEmail string, reader *bufio.Reader) {
 
 	if priceType == "t" {
 		buyPrice = buyPrice / quantity
-		fmt.Printf("Per-coin price calculated: $%.2f\n", buyPrice)
+		fmt.Printf("Per-coin price calculated: %s\n", currency.Format(buyPrice, vsCurrency))
 	}
 
 	holding := models.Holding{
@@ -446,9 +666,10 @@ func addSingleHolding(userEmail string, reader *bufio.Reader) {
 		CoinName: coinName,
 		Quantity: quantity,
 		BuyPrice: buyPrice,
+		Currency: vsCurrency,
 	}
 
-	if err := portfolio.AddMultipleHoldings(userEmail, holding); err != nil {
+	if err := portfolio.AddMultipleHoldings(ctx, store, userEmail, holding); err != nil {
 		if errors.Is(err, customerrors.ErrInvalidQuantity) {
 			fmt.Println("Quantity must be greater than 0")
 		} else if errors.Is(err, customerrors.ErrInvalidPrice) {
@@ -462,49 +683,71 @@ func addSingleHolding(userEmail string, reader *bufio.Reader) {
 	fmt.Println("Holding added successfully!")
 }
 
-func setPriceAlert(userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
-	p, err := portfolio.GetPortfolio(userEmail)
+func setPriceAlert(ctx context.Context, store db.Store, userEmail, vsCurrency string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
 	if err != nil {
 		fmt.Printf("Error loading portfolio: %v\n", err)
 		return
 	}
+	w, err := watchlist.GetWatchlist(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error loading watchlist: %v\n", err)
+		return
+	}
 
-	if len(p.Holdings) == 0 {
-		fmt.Println("Your portfolio is empty. Add holdings before setting alerts.")
+	// Watched coins are offered as holdings with no quantity.
+	choices := append([]models.Holding{}, p.Holdings...)
+	for _, c := range w.Coins {
+		choices = append(choices, models.Holding{CoinID: c.CoinID, CoinName: c.CoinName})
+	}
+
+	if len(choices) == 0 {
+		fmt.Println("Your portfolio and watchlist are empty. Add holdings or watch a coin before setting alerts.")
 		return
 	}
 
-	fmt.Println("\n=== Your Portfolio Coins ===")
-	for i, h := range p.Holdings {
+	if len(p.Holdings) > 0 {
+		fmt.Println("\n=== Your Portfolio Coins ===")
+	}
+	for i, h := range choices {
+		if i == len(p.Holdings) {
+			fmt.Println("\n=== Your Watchlist ===")
+		}
 		fmt.Printf("  %d. %s (%s)\n", i+1, h.CoinName, h.CoinID)
 	}
 
 	fmt.Print("\nSelect coin number: ")
 	numStr, _ := reader.ReadString('\n')
 	num, err := strconv.Atoi(strings.TrimSpace(numStr))
-	if err != nil || num < 1 || num > len(p.Holdings) {
+	if err != nil || num < 1 || num > len(choices) {
 		fmt.Println("Invalid selection.")
 		return
 	}
 
-	selectedHolding := p.Holdings[num-1]
+	selectedHolding := choices[num-1]
 	coinID := selectedHolding.CoinID
 	coinName := selectedHolding.CoinName
 
 	fmt.Printf("\nValidating coin %q with CoinGecko...\n", coinID)
-	if err := alert.ValidateCoinExists(coinID, userEmail, cryptoAPI); err != nil {
+	if err := alert.ValidateCoinExists(ctx, store, coinID, userEmail, cryptoAPI); err != nil {
 		fmt.Printf("Coin validation failed: %v\n", err)
 		fmt.Println("Alert not created. Please check your coin ID.")
 		return
 	}
 	fmt.Println("Coin validated successfully.")
 
-	fmt.Print("\nAlert type — Buy (b) or Sell (s)? ")
+	fmt.Print("\nAlert type — Buy (b), Sell (s), Percent move (p) or Trailing stop (t)? ")
 	typeStr, _ := reader.ReadString('\n')
 	typeStr = strings.TrimSpace(strings.ToLower(typeStr))
 
 	var alertType models.AlertType
 	switch typeStr {
+	case "p":
+		setPercentAlert(ctx, store, userEmail, vsCurrency, selectedHolding, cryptoAPI, reader)
+		return
+	case "t":
+		setTrailingStopAlert(ctx, store, userEmail, vsCurrency, selectedHolding, cryptoAPI, reader)
+		return
 	case "b":
 		alertType = models.AlertTypeBuy
 		fmt.Println("  → Buy alert: you will be notified when the price drops TO or BELOW your threshold.")
@@ -512,11 +755,11 @@ func setPriceAlert(userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Read
 		alertType = models.AlertTypeSell
 		fmt.Println("  → Sell alert: you will be notified when the price rises TO or ABOVE your threshold.")
 	default:
-		fmt.Println("Invalid type. Enter 'b' for buy or 's' for sell.")
+		fmt.Println("Invalid type. Enter 'b' for buy, 's' for sell, 'p' for percent move or 't' for trailing stop.")
 		return
 	}
 
-	fmt.Print("Enter threshold price ($): ")
+	fmt.Printf("Enter threshold price (%s): ", strings.ToUpper(vsCurrency))
 	priceStr, _ := reader.ReadString('\n')
 	threshold, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
 	if err != nil || threshold <= 0 {
@@ -524,10 +767,10 @@ func setPriceAlert(userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Read
 		return
 	}
 
-	currentPrice, err := cryptoAPI.FetchPrice(coinID)
+	currentPrice, err := cryptoAPI.FetchPrice(ctx, coinID, vsCurrency)
 	if err == nil {
-		fmt.Printf("\n  Current price of %s: $%.2f\n", coinName, currentPrice)
-		fmt.Printf("  Your threshold    : $%.2f\n", threshold)
+		fmt.Printf("\n  Current price of %s: %s\n", coinName, currency.Format(currentPrice, vsCurrency))
+		fmt.Printf("  Your threshold    : %s\n", currency.Format(threshold, vsCurrency))
 		if alertType == models.AlertTypeBuy && threshold >= currentPrice {
 			fmt.Println("  Note: threshold is at or above current price — alert may trigger immediately on next check.")
 		}
@@ -536,23 +779,341 @@ func setPriceAlert(userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Read
 		}
 	}
 
-	if err := alert.CreateAlert(userEmail, coinID, coinName, alertType, threshold, cryptoAPI); err != nil {
+	req := models.Alert{
+		UserEmail:      userEmail,
+		CoinID:         coinID,
+		CoinName:       coinName,
+		AlertType:      alertType,
+		ThresholdPrice: threshold,
+		Currency:       vsCurrency,
+	}
+	if !promptAlertSchedule(&req, reader) {
+		return
+	}
+	if _, err := alert.AddAlert(ctx, store, cryptoAPI, req); err != nil {
 		fmt.Printf("Error creating alert: %v\n", err)
 		return
 	}
 
-	fmt.Printf("\nAlert set! You will receive an email at %s when %s %s $%.2f.\n",
+	fmt.Printf("\nAlert set! You will receive an email at %s when %s %s %s.\n",
 		userEmail, coinName,
 		map[models.AlertType]string{
 			models.AlertTypeBuy:  "drops to or below",
 			models.AlertTypeSell: "rises to or above",
 		}[alertType],
-		threshold,
+		currency.Format(threshold, vsCurrency),
+	)
+}
+
+func setPercentAlert(ctx context.Context, store db.Store, userEmail, vsCurrency string, h models.Holding, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	fmt.Print("Enter percentage move (e.g. 8 for 8%): ")
+	pctStr, _ := reader.ReadString('\n')
+	pct, err := strconv.ParseFloat(strings.TrimSpace(pctStr), 64)
+	if err != nil || pct <= 0 {
+		fmt.Println("Invalid percentage. Must be a number greater than 0.")
+		return
+	}
+
+	fmt.Print("Direction — Up (u), Down (d) or Either (e) [e]: ")
+	dirStr, _ := reader.ReadString('\n')
+	direction := models.MoveEither
+	switch strings.TrimSpace(strings.ToLower(dirStr)) {
+	case "u":
+		direction = models.MoveUp
+	case "d":
+		direction = models.MoveDown
+	case "", "e":
+	default:
+		fmt.Println("Invalid direction.")
+		return
+	}
+
+	fmt.Print("Measure from current price (c) or your average buy price (a) [c]: ")
+	refStr, _ := reader.ReadString('\n')
+	source := models.ReferenceCreation
+	switch strings.TrimSpace(strings.ToLower(refStr)) {
+	case "a":
+		source = models.ReferenceAvgBuy
+	case "", "c":
+	default:
+		fmt.Println("Invalid reference.")
+		return
+	}
+
+	req := models.Alert{
+		UserEmail:       userEmail,
+		CoinID:          h.CoinID,
+		CoinName:        h.CoinName,
+		AlertType:       models.AlertTypePercentMove,
+		PercentChange:   pct,
+		Direction:       direction,
+		ReferenceSource: source,
+		Currency:        vsCurrency,
+	}
+	if !promptAlertSchedule(&req, reader) {
+		return
+	}
+	a, err := alert.AddAlert(ctx, store, cryptoAPI, req)
+	if err != nil {
+		fmt.Printf("Error creating alert: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nAlert set! You will receive an email at %s when %s moves %s %.2f%% from %s.\n",
+		userEmail, h.CoinName,
+		map[models.MoveDirection]string{
+			models.MoveUp:     "up",
+			models.MoveDown:   "down",
+			models.MoveEither: "up or down",
+		}[a.Direction],
+		a.PercentChange,
+		currency.Format(a.ReferencePrice, a.Currency),
+	)
+}
+
+func setTrailingStopAlert(ctx context.Context, store db.Store, userEmail, vsCurrency string, h models.Holding, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	fmt.Print("Trail by percentage (p) or fixed amount (a)? ")
+	modeStr, _ := reader.ReadString('\n')
+	mode := strings.TrimSpace(strings.ToLower(modeStr))
+	if mode != "p" && mode != "a" {
+		fmt.Println("Invalid choice. Enter 'p' or 'a'.")
+		return
+	}
+
+	if mode == "p" {
+		fmt.Print("Enter trail percentage (e.g. 5 for 5%): ")
+	} else {
+		fmt.Printf("Enter trail amount (%s): ", strings.ToUpper(vsCurrency))
+	}
+	valStr, _ := reader.ReadString('\n')
+	val, err := strconv.ParseFloat(strings.TrimSpace(valStr), 64)
+	if err != nil || val <= 0 {
+		fmt.Println("Invalid value. Must be a number greater than 0.")
+		return
+	}
+
+	req := models.Alert{
+		UserEmail: userEmail,
+		CoinID:    h.CoinID,
+		CoinName:  h.CoinName,
+		AlertType: models.AlertTypeTrailingStop,
+		Currency:  vsCurrency,
+	}
+	if mode == "p" {
+		req.TrailPercent = val
+	} else {
+		req.TrailAmount = val
+	}
+	if !promptAlertSchedule(&req, reader) {
+		return
+	}
+
+	a, err := alert.AddAlert(ctx, store, cryptoAPI, req)
+	if err != nil {
+		fmt.Printf("Error creating alert: %v\n", err)
+		return
+	}
+
+	fmt.Printf("\nTrailing stop set! Current high %s, stop at %s. The stop rises with the price and you will receive an email at %s if %s falls back through it.\n",
+		currency.Format(a.HighWaterMark, a.Currency),
+		currency.Format(a.EffectiveStop(), a.Currency),
+		userEmail, h.CoinName,
 	)
 }
 
-func deleteAlert(userEmail string, reader *bufio.Reader) {
-	alerts, err := alert.GetAlerts(userEmail)
+func setPortfolioAlert(ctx context.Context, store db.Store, userEmail, vsCurrency string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error loading portfolio: %v\n", err)
+		return
+	}
+	if len(p.Holdings) == 0 {
+		fmt.Println("Your portfolio is empty. Add holdings before setting alerts.")
+		return
+	}
+
+	fmt.Println("\n=== Portfolio Alert ===")
+	fmt.Println("  1. Total portfolio value")
+	fmt.Println("  2. Total profit/loss")
+	fmt.Println("  3. Single coin's share of the portfolio")
+	fmt.Print("Select metric: ")
+	metricStr, _ := reader.ReadString('\n')
+
+	req := models.Alert{UserEmail: userEmail, Currency: vsCurrency}
+	switch strings.TrimSpace(metricStr) {
+	case "1":
+		req.AlertType = models.AlertTypePortfolioValue
+	case "2":
+		req.AlertType = models.AlertTypePortfolioPL
+	case "3":
+		req.AlertType = models.AlertTypeCoinWeight
+		for i, h := range p.Holdings {
+			fmt.Printf("  %d. %s (%s)\n", i+1, h.CoinName, h.CoinID)
+		}
+		fmt.Print("Select coin number: ")
+		numStr, _ := reader.ReadString('\n')
+		num, err := strconv.Atoi(strings.TrimSpace(numStr))
+		if err != nil || num < 1 || num > len(p.Holdings) {
+			fmt.Println("Invalid selection.")
+			return
+		}
+		req.CoinID = p.Holdings[num-1].CoinID
+		req.CoinName = p.Holdings[num-1].CoinName
+	default:
+		fmt.Println("Invalid selection.")
+		return
+	}
+
+	fmt.Print("Notify when the metric goes above (a) or below (b)? ")
+	cmpStr, _ := reader.ReadString('\n')
+	switch strings.TrimSpace(strings.ToLower(cmpStr)) {
+	case "a":
+		req.Comparator = models.ComparatorAbove
+	case "b":
+		req.Comparator = models.ComparatorBelow
+	default:
+		fmt.Println("Invalid choice. Enter 'a' or 'b'.")
+		return
+	}
+
+	if req.AlertType == models.AlertTypeCoinWeight {
+		fmt.Print("Enter threshold percentage of total value (e.g. 40): ")
+	} else {
+		fmt.Printf("Enter threshold (%s, may be negative for P/L): ", strings.ToUpper(vsCurrency))
+	}
+	thrStr, _ := reader.ReadString('\n')
+	threshold, err := strconv.ParseFloat(strings.TrimSpace(thrStr), 64)
+	if err != nil {
+		fmt.Println("Invalid number.")
+		return
+	}
+	req.Threshold = threshold
+	if !promptAlertSchedule(&req, reader) {
+		return
+	}
+
+	a, err := alert.AddAlert(ctx, store, cryptoAPI, req)
+	if err != nil {
+		fmt.Printf("Error creating alert: %v\n", err)
+		return
+	}
+	fmt.Printf("\nAlert set: %s. You will receive an email at %s when it triggers.\n", alert.Describe(*a), userEmail)
+}
+
+func setExpressionAlert(ctx context.Context, store db.Store, userEmail, vsCurrency string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	fmt.Println("\n=== Custom Condition Alert ===")
+	fmt.Println("Functions: price, change24h, volume24h, marketcap, weight (each takes a coin ID in quotes),")
+	fmt.Println("           portfolio_value(), portfolio_pl()")
+	fmt.Println("Operators: + - * /  < <= > >= == !=  && || !  ( )")
+	fmt.Printf("Amounts are in %s. Example:\n", strings.ToUpper(vsCurrency))
+	fmt.Println(`  price("ethereum") / price("bitcoin") < 0.05 && change24h("ethereum") < -5`)
+	fmt.Print("Condition: ")
+	exprStr, _ := reader.ReadString('\n')
+
+	req := models.Alert{
+		UserEmail:  userEmail,
+		AlertType:  models.AlertTypeExpression,
+		Expression: strings.TrimSpace(exprStr),
+		Currency:   vsCurrency,
+	}
+	if !promptAlertSchedule(&req, reader) {
+		return
+	}
+
+	a, err := alert.AddAlert(ctx, store, cryptoAPI, req)
+	if err != nil {
+		fmt.Printf("Error creating alert: %v\n", err)
+		return
+	}
+	fmt.Printf("\nAlert set: %s. You will receive an email at %s when it triggers.\n", alert.Describe(*a), userEmail)
+}
+
+func manageWatchlist(ctx context.Context, store db.Store, userEmail, vsCurrency string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	if err := watchlist.DisplayWatchlist(ctx, store, userEmail, cryptoAPI, vsCurrency); err != nil {
+		fmt.Printf("Error displaying watchlist: %v\n", err)
+		return
+	}
+
+	fmt.Print("\nAdd a coin (a), remove a coin (r) or go back (Enter)? ")
+	choice, _ := reader.ReadString('\n')
+	switch strings.TrimSpace(strings.ToLower(choice)) {
+	case "a":
+		fmt.Print("Enter coin ID (e.g. solana): ")
+		coinID, _ := reader.ReadString('\n')
+		coin, err := watchlist.AddCoin(ctx, store, cryptoAPI, userEmail, coinID)
+		if err != nil {
+			fmt.Printf("Error adding coin: %v\n", err)
+			return
+		}
+		fmt.Printf("%s (%s) added to your watchlist. You can now set alerts on it.\n", coin.CoinName, coin.CoinID)
+	case "r":
+		fmt.Print("Enter coin ID to remove: ")
+		coinID, _ := reader.ReadString('\n')
+		if err := watchlist.RemoveCoin(ctx, store, userEmail, coinID); err != nil {
+			fmt.Printf("Error removing coin: %v\n", err)
+			return
+		}
+		fmt.Println("Coin removed from your watchlist.")
+	}
+}
+
+// promptAlertSchedule asks whether the alert should repeat and, if so, how it
+// re-arms, plus an optional expiry date. It returns false on invalid input.
+func promptAlertSchedule(a *models.Alert, reader *bufio.Reader) bool {
+	fmt.Print("Repeat this alert each time the condition is met again? (y/N): ")
+	recurStr, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(recurStr)) == "y" {
+		a.Recurring = true
+
+		fmt.Print("  Re-arm once the value moves back past the trigger by what % [0]: ")
+		rearmStr, _ := reader.ReadString('\n')
+		if rearmStr = strings.TrimSpace(rearmStr); rearmStr != "" {
+			v, err := strconv.ParseFloat(rearmStr, 64)
+			if err != nil || v < 0 {
+				fmt.Println("Invalid percentage.")
+				return false
+			}
+			a.RearmPercent = v
+		}
+
+		fmt.Print("  Minimum time between notifications, e.g. 30m or 4h [none]: ")
+		coolStr, _ := reader.ReadString('\n')
+		if coolStr = strings.TrimSpace(coolStr); coolStr != "" {
+			d, err := time.ParseDuration(coolStr)
+			if err != nil || d < 0 {
+				fmt.Println("Invalid duration.")
+				return false
+			}
+			a.Cooldown = d
+		}
+
+		fmt.Print("  Maximum number of notifications [unlimited]: ")
+		maxStr, _ := reader.ReadString('\n')
+		if maxStr = strings.TrimSpace(maxStr); maxStr != "" {
+			n, err := strconv.Atoi(maxStr)
+			if err != nil || n < 0 {
+				fmt.Println("Invalid number.")
+				return false
+			}
+			a.MaxFirings = n
+		}
+	}
+
+	fmt.Print("Expiry date (YYYY-MM-DD) [never]: ")
+	expStr, _ := reader.ReadString('\n')
+	if expStr = strings.TrimSpace(expStr); expStr != "" {
+		t, err := time.Parse("2006-01-02", expStr)
+		if err != nil {
+			fmt.Println("Invalid date. Use YYYY-MM-DD.")
+			return false
+		}
+		a.ExpiresAt = t.Add(24*time.Hour - time.Second)
+	}
+	return true
+}
+
+func deleteAlert(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	alerts, err := alert.GetAlerts(ctx, store, userEmail)
 	if err != nil {
 		fmt.Printf("Error fetching alerts: %v\n", err)
 		return
@@ -565,13 +1126,7 @@ func deleteAlert(userEmail string, reader *bufio.Reader) {
 
 	fmt.Println("\n========== YOUR ALERTS ==========")
 	for i, a := range alerts {
-		fmt.Printf("  %d. %s (%s) — %s at $%.2f\n",
-			i+1,
-			a.CoinName,
-			a.CoinID,
-			strings.ToUpper(string(a.AlertType)),
-			a.ThresholdPrice,
-		)
+		fmt.Printf("  %d. %s (%s) — %s\n", i+1, a.CoinName, a.CoinID, alert.Describe(a))
 	}
 
 	fmt.Print("\nEnter alert number to delete (0 to cancel): ")
@@ -588,21 +1143,660 @@ func deleteAlert(userEmail string, reader *bufio.Reader) {
 
 	selected := alerts[num-1]
 
-	fmt.Printf("\nDelete %s alert for %s at $%.2f? (y/n): ",
-		strings.ToUpper(string(selected.AlertType)),
-		selected.CoinName,
-		selected.ThresholdPrice,
-	)
+	fmt.Printf("\nDelete %s alert (%s)? (y/n): ", selected.CoinName, alert.Describe(selected))
 	confirm, _ := reader.ReadString('\n')
 	if strings.TrimSpace(strings.ToLower(confirm)) != "y" {
 		fmt.Println("Cancelled.")
 		return
 	}
 
-	if err := alert.DeleteAlert(userEmail, selected.ID); err != nil {
+	if err := alert.DeleteAlert(ctx, store, userEmail, selected.ID); err != nil {
 		fmt.Printf("Error deleting alert: %v\n", err)
 		return
 	}
 
 	fmt.Printf("Alert for %s deleted successfully.\n", selected.CoinName)
 }
+
+func viewAlertHistory(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	var filter db.AlertEventFilter
+
+	fmt.Print("Filter by coin ID (blank for all): ")
+	coinStr, _ := reader.ReadString('\n')
+	filter.CoinID = strings.ToLower(strings.TrimSpace(coinStr))
+
+	fmt.Print("From date (YYYY-MM-DD, blank for any): ")
+	fromStr, _ := reader.ReadString('\n')
+	if fromStr = strings.TrimSpace(fromStr); fromStr != "" {
+		t, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			fmt.Println("Invalid date. Use YYYY-MM-DD.")
+			return
+		}
+		filter.From = t
+	}
+
+	fmt.Print("To date (YYYY-MM-DD, blank for any): ")
+	toStr, _ := reader.ReadString('\n')
+	if toStr = strings.TrimSpace(toStr); toStr != "" {
+		t, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			fmt.Println("Invalid date. Use YYYY-MM-DD.")
+			return
+		}
+		// Include the whole of the end day.
+		filter.To = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	if err := alert.DisplayAlertHistory(ctx, store, userEmail, filter); err != nil {
+		fmt.Printf("Error displaying alert history: %v\n", err)
+	}
+}
+
+func viewOutbox(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	if err := outbox.DisplayOutbox(ctx, store, userEmail); err != nil {
+		fmt.Printf("Error displaying outbox: %v\n", err)
+		return
+	}
+
+	fmt.Print("Retry failed emails now? (y/n): ")
+	answer, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(answer)) != "y" {
+		return
+	}
+
+	ids, err := outbox.Retry(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error requeueing emails: %v\n", err)
+		return
+	}
+	if len(ids) == 0 {
+		fmt.Println("No failed emails to retry.")
+		return
+	}
+	if err := outbox.Deliver(ctx, store, ids...); err != nil {
+		fmt.Printf("Some emails failed again and will be retried: %v\n", err)
+		return
+	}
+	fmt.Printf("%d email(s) sent.\n", len(ids))
+}
+
+func recordTransaction(ctx context.Context, store db.Store, userEmail, vsCurrency string, reader *bufio.Reader) {
+	fmt.Println("\nTransaction type:")
+	fmt.Println("  1. Buy")
+	fmt.Println("  2. Sell")
+	fmt.Println("  3. Transfer In")
+	fmt.Println("  4. Transfer Out")
+	fmt.Println("  5. Fee (paid in coin)")
+	fmt.Println("  6. Reward (staking, airdrop, ...)")
+	fmt.Print("Select type: ")
+	typeStr, _ := reader.ReadString('\n')
+
+	txTypes := map[string]models.TransactionType{
+		"1": models.TransactionTypeBuy,
+		"2": models.TransactionTypeSell,
+		"3": models.TransactionTypeTransferIn,
+		"4": models.TransactionTypeTransferOut,
+		"5": models.TransactionTypeFee,
+		"6": models.TransactionTypeReward,
+	}
+	txType, ok := txTypes[strings.TrimSpace(typeStr)]
+	if !ok {
+		fmt.Println("Invalid type.")
+		return
+	}
+
+	fmt.Print("Coin ID (e.g., bitcoin): ")
+	coinID, _ := reader.ReadString('\n')
+	coinID = strings.TrimSpace(coinID)
+
+	fmt.Print("Coin Name (e.g., Bitcoin): ")
+	coinName, _ := reader.ReadString('\n')
+	coinName = strings.TrimSpace(coinName)
+
+	fmt.Print("Quantity: ")
+	quantityStr, _ := reader.ReadString('\n')
+	quantity, err := strconv.ParseFloat(strings.TrimSpace(quantityStr), 64)
+	if err != nil || quantity <= 0 {
+		fmt.Println("Invalid quantity")
+		return
+	}
+
+	var price float64
+	switch txType {
+	case models.TransactionTypeBuy, models.TransactionTypeSell:
+		fmt.Printf("Price per coin (%s): ", strings.ToUpper(vsCurrency))
+	case models.TransactionTypeTransferIn:
+		fmt.Printf("Original cost per coin (%s, 0 if unknown): ", strings.ToUpper(vsCurrency))
+	case models.TransactionTypeReward:
+		fmt.Printf("Market value per coin when received (%s): ", strings.ToUpper(vsCurrency))
+	}
+	if txType != models.TransactionTypeTransferOut && txType != models.TransactionTypeFee {
+		priceStr, _ := reader.ReadString('\n')
+		price, err = strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
+		if err != nil || price < 0 {
+			fmt.Println("Invalid price")
+			return
+		}
+	}
+
+	var fee float64
+	if txType == models.TransactionTypeBuy || txType == models.TransactionTypeSell {
+		fmt.Printf("Exchange fee paid (%s, 0 for none): ", strings.ToUpper(vsCurrency))
+		feeStr, _ := reader.ReadString('\n')
+		if feeStr = strings.TrimSpace(feeStr); feeStr != "" {
+			fee, err = strconv.ParseFloat(feeStr, 64)
+			if err != nil || fee < 0 {
+				fmt.Println("Invalid fee")
+				return
+			}
+		}
+	}
+
+	fmt.Print("Date (YYYY-MM-DD, blank for now): ")
+	dateStr, _ := reader.ReadString('\n')
+	var executedAt time.Time
+	if dateStr = strings.TrimSpace(dateStr); dateStr != "" {
+		executedAt, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			fmt.Println("Invalid date")
+			return
+		}
+	}
+
+	fmt.Print("Note (optional): ")
+	note, _ := reader.ReadString('\n')
+
+	tx := models.Transaction{
+		CoinID:     coinID,
+		CoinName:   coinName,
+		Type:       txType,
+		Quantity:   quantity,
+		Price:      price,
+		Fee:        fee,
+		Currency:   vsCurrency,
+		Note:       strings.TrimSpace(note),
+		ExecutedAt: executedAt,
+	}
+
+	if err := portfolio.RecordTransactions(ctx, store, userEmail, tx); err != nil {
+		if errors.Is(err, customerrors.ErrInsufficientFunds) {
+			fmt.Printf("You do not hold enough %s for this transaction: %v\n", coinID, err)
+		} else {
+			fmt.Printf("Error recording transaction: %v\n", err)
+		}
+		return
+	}
+
+	fmt.Println("Transaction recorded successfully!")
+}
+
+func viewTransactions(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	fmt.Print("Filter by coin IDs (comma-separated, blank for all): ")
+	coinsStr, _ := reader.ReadString('\n')
+
+	var coinIDs []string
+	for _, id := range strings.Split(coinsStr, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			coinIDs = append(coinIDs, id)
+		}
+	}
+
+	txs, err := portfolio.GetTransactions(ctx, store, userEmail, coinIDs...)
+	if err != nil {
+		fmt.Printf("Error fetching transactions: %v\n", err)
+		return
+	}
+
+	if len(txs) == 0 {
+		fmt.Println("No transactions recorded.")
+		return
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 91))
+	fmt.Println("TRANSACTION HISTORY")
+	fmt.Println(strings.Repeat("=", 91))
+	fmt.Printf(" %-12s %-13s %-15s %14s %14s %10s %4s\n", "Date", "Type", "Coin", "Quantity", "Price", "Fee", "Cur")
+	fmt.Println(strings.Repeat("-", 91))
+	for _, tx := range txs {
+		fmt.Printf(" %-12s %-13s %-15s %14.6f %14.2f %10.2f %4s\n",
+			tx.ExecutedAt.Format("2006-01-02"),
+			strings.ToUpper(string(tx.Type)),
+			tx.CoinID,
+			tx.Quantity,
+			tx.Price,
+			tx.Fee,
+			strings.ToUpper(currency.OrDefault(tx.Currency)),
+		)
+	}
+	fmt.Println(strings.Repeat("=", 91))
+}
+
+func viewCostBasis(ctx context.Context, store db.Store, userEmail string) {
+	p, err := portfolio.GetPortfolio(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error loading portfolio: %v\n", err)
+		return
+	}
+
+	bases, err := portfolio.GetCostBasis(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error computing cost basis: %v\n", err)
+		return
+	}
+
+	if len(p.Holdings) == 0 {
+		fmt.Println("You have no open lots.")
+		return
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 70))
+	fmt.Printf("COST BASIS LOTS (%s)\n", strings.ToUpper(string(p.Method())))
+	fmt.Println(strings.Repeat("=", 70))
+
+	for _, h := range p.Holdings {
+		cb, ok := bases[h.CoinID]
+		if !ok {
+			continue
+		}
+		fmt.Printf("\n%s (%s), in %s\n", cb.CoinName, cb.CoinID, strings.ToUpper(currency.OrDefault(cb.Currency)))
+		fmt.Printf("  %-12s %-12s %14s %12s %14s\n", "Acquired", "Type", "Remaining", "Unit Cost", "Basis")
+		for _, l := range cb.Lots {
+			fmt.Printf("  %-12s %-12s %14.6f %12.2f %14.2f\n",
+				l.AcquiredAt.Format("2006-01-02"),
+				strings.ToUpper(string(l.Type)),
+				l.Remaining,
+				l.UnitCost,
+				l.RemainingBasis(),
+			)
+		}
+		fmt.Printf("  %-25s %14.6f %12s %14.2f\n", "Total", cb.RemainingQuantity(), "", cb.RemainingBasis())
+	}
+	fmt.Println(strings.Repeat("=", 70))
+}
+
+func setCostBasisMethod(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	fmt.Println("\nCost basis method:")
+	fmt.Println("  1. FIFO    (first in, first out)")
+	fmt.Println("  2. LIFO    (last in, first out)")
+	fmt.Println("  3. HIFO    (highest cost first out)")
+	fmt.Println("  4. Average (weighted average cost)")
+	fmt.Print("Select method: ")
+	choice, _ := reader.ReadString('\n')
+
+	methods := map[string]models.CostBasisMethod{
+		"1": models.CostBasisFIFO,
+		"2": models.CostBasisLIFO,
+		"3": models.CostBasisHIFO,
+		"4": models.CostBasisAverage,
+	}
+	method, ok := methods[strings.TrimSpace(choice)]
+	if !ok {
+		fmt.Println("Invalid method.")
+		return
+	}
+
+	if err := portfolio.SetCostBasisMethod(ctx, store, userEmail, method); err != nil {
+		fmt.Printf("Error saving cost basis method: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Cost basis method set to %s.\n", strings.ToUpper(string(method)))
+}
+
+func exportTaxReport(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	defaultYear := time.Now().Year() - 1
+	fmt.Printf("Tax year (blank for %d): ", defaultYear)
+	yearStr, _ := reader.ReadString('\n')
+	year := defaultYear
+	if yearStr = strings.TrimSpace(yearStr); yearStr != "" {
+		y, err := strconv.Atoi(yearStr)
+		if err != nil || y < 2009 {
+			fmt.Println("Invalid year")
+			return
+		}
+		year = y
+	}
+
+	defaultDays := int(portfolio.DefaultLongTermThreshold.Hours() / 24)
+	fmt.Printf("Long-term holding period in days (blank for %d): ", defaultDays)
+	daysStr, _ := reader.ReadString('\n')
+	days := defaultDays
+	if daysStr = strings.TrimSpace(daysStr); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d <= 0 {
+			fmt.Println("Invalid number of days")
+			return
+		}
+		days = d
+	}
+
+	rows, err := portfolio.GenerateTaxReport(ctx, store, userEmail, year, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		fmt.Printf("Error generating tax report: %v\n", err)
+		return
+	}
+
+	if len(rows) == 0 {
+		fmt.Printf("No disposals recorded in %d.\n", year)
+		return
+	}
+
+	defaultPath := fmt.Sprintf("tax_report_%d.csv", year)
+	fmt.Printf("Output file (blank for %s): ", defaultPath)
+	path, _ := reader.ReadString('\n')
+	if path = strings.TrimSpace(path); path == "" {
+		path = defaultPath
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("Error creating file: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	if err := portfolio.WriteTaxReportCSV(f, rows); err != nil {
+		fmt.Printf("Error writing tax report: %v\n", err)
+		return
+	}
+
+	// Gains are totalled per currency, since rows for coins traded in
+	// different currencies cannot be added up.
+	var codes []string
+	shortGain := make(map[string]float64)
+	longGain := make(map[string]float64)
+	for _, r := range rows {
+		if _, ok := shortGain[r.Currency]; !ok {
+			codes = append(codes, r.Currency)
+			shortGain[r.Currency], longGain[r.Currency] = 0, 0
+		}
+		if r.Term == portfolio.TaxTermLong {
+			longGain[r.Currency] += r.Gain
+		} else {
+			shortGain[r.Currency] += r.Gain
+		}
+	}
+
+	fmt.Printf("\n%d disposal row(s) written to %s\n", len(rows), path)
+	for _, code := range codes {
+		fmt.Printf("  Short-term gain/loss : %s\n", currency.FormatSigned(shortGain[code], code))
+		fmt.Printf("  Long-term gain/loss  : %s\n", currency.FormatSigned(longGain[code], code))
+	}
+}
+
+func setPreferredCurrency(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) (string, bool) {
+	codes := currency.Supported()
+	upper := make([]string, len(codes))
+	for i, c := range codes {
+		upper[i] = strings.ToUpper(c)
+	}
+
+	fmt.Printf("\nSupported currencies: %s\n", strings.Join(upper, ", "))
+	fmt.Println("Note: recorded prices are not converted, so the currency cannot change while any are recorded in another one.")
+	fmt.Print("Enter currency code: ")
+	code, _ := reader.ReadString('\n')
+
+	normalized, err := currency.Normalize(code)
+	if err != nil {
+		fmt.Printf("Invalid currency: %v\n", err)
+		return "", false
+	}
+
+	err = auth.SetPreferredCurrency(ctx, store, userEmail, normalized)
+	if errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		fmt.Printf("Cannot switch to %s: %v\n", strings.ToUpper(normalized), errors.Unwrap(err))
+		return "", false
+	}
+	if err != nil {
+		fmt.Printf("Error saving preferred currency: %v\n", err)
+		return "", false
+	}
+
+	fmt.Printf("Preferred currency set to %s.\n", strings.ToUpper(normalized))
+	return normalized, true
+}
+
+func setNotificationChannels(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	current, err := auth.GetNotificationChannels(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error loading notification channels: %v\n", err)
+		return
+	}
+
+	fmt.Println("\n=== Notification Channels ===")
+	for _, ch := range current {
+		switch ch.Kind {
+		case models.ChannelWebhook:
+			signed := "unsigned"
+			if ch.Secret != "" {
+				signed = "signed"
+			}
+			fmt.Printf("  webhook : %s (%s)\n", ch.URL, signed)
+		case models.ChannelFile:
+			fmt.Printf("  file    : %s\n", ch.Path)
+		default:
+			fmt.Printf("  email   : %s\n", userEmail)
+		}
+	}
+
+	var channels []models.NotificationChannel
+
+	fmt.Print("\nSend alerts by email? (Y/n): ")
+	emailStr, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(emailStr)) != "n" {
+		channels = append(channels, models.NotificationChannel{Kind: models.ChannelEmail})
+	}
+
+	fmt.Print("Webhook URL (blank for none): ")
+	urlStr, _ := reader.ReadString('\n')
+	if urlStr = strings.TrimSpace(urlStr); urlStr != "" {
+		fmt.Print("Webhook signing secret (blank for unsigned): ")
+		secret, _ := reader.ReadString('\n')
+		channels = append(channels, models.NotificationChannel{
+			Kind:   models.ChannelWebhook,
+			URL:    urlStr,
+			Secret: strings.TrimSpace(secret),
+		})
+	}
+
+	fmt.Print("Log alerts to a file (path, - for stdout, blank for none): ")
+	pathStr, _ := reader.ReadString('\n')
+	if pathStr = strings.TrimSpace(pathStr); pathStr != "" {
+		channels = append(channels, models.NotificationChannel{Kind: models.ChannelFile, Path: pathStr})
+	}
+
+	if err := auth.SetNotificationChannels(ctx, store, userEmail, channels); err != nil {
+		fmt.Printf("Error saving notification channels: %v\n", err)
+		return
+	}
+	fmt.Printf("Alerts will be delivered over %d channel(s).\n", len(channels))
+}
+
+func customizeEmailTemplates(ctx context.Context, store db.Store, userEmail string, reader *bufio.Reader) {
+	fmt.Println("\n=== Email Templates ===")
+	for i, kind := range models.CustomizableTemplates {
+		fmt.Printf("%d. %s emails\n", i+1, kind)
+	}
+	fmt.Print("Select email: ")
+	kindStr, _ := reader.ReadString('\n')
+	num, err := strconv.Atoi(strings.TrimSpace(kindStr))
+	if err != nil || num < 1 || num > len(models.CustomizableTemplates) {
+		fmt.Println("Invalid selection.")
+		return
+	}
+	kind := models.CustomizableTemplates[num-1]
+
+	current, custom, err := auth.GetEmailTemplate(ctx, store, userEmail, kind)
+	if err != nil {
+		fmt.Printf("Error loading template: %v\n", err)
+		return
+	}
+	if custom {
+		fmt.Printf("Using your custom %s template (updated %s).\n", kind, current.UpdatedAt.Format("02 Jan 2006, 15:04"))
+	} else {
+		fmt.Printf("Using the built-in %s template.\n", kind)
+	}
+
+	fmt.Println("\n1. Preview")
+	fmt.Println("2. Edit subject")
+	fmt.Println("3. Edit plain-text body")
+	fmt.Println("4. Edit HTML body")
+	fmt.Println("5. Reset to built-in")
+	fmt.Print("Choose an option: ")
+	actionStr, _ := reader.ReadString('\n')
+
+	// Parts the user has not customised stay empty so they keep following
+	// the built-in template.
+	override := models.EmailTemplate{Kind: kind}
+	if custom {
+		override = current
+	}
+
+	var part *string
+	var source string
+	switch strings.TrimSpace(actionStr) {
+	case "1":
+		var preview *models.EmailTemplate
+		if custom {
+			preview = &current
+		}
+		content, err := email.Preview(kind, preview)
+		if err != nil {
+			fmt.Printf("Error rendering template: %v\n", err)
+			return
+		}
+		fmt.Printf("\nSubject: %s\n\n%s\n", content.Subject, content.Text)
+		fmt.Printf("(plus a %d-byte HTML version)\n", len(content.HTML))
+		return
+	case "2":
+		part, source = &override.Subject, current.Subject
+	case "3":
+		part, source = &override.Text, current.Text
+	case "4":
+		part, source = &override.HTML, current.HTML
+	case "5":
+		if err := auth.ResetEmailTemplate(ctx, store, userEmail, kind); err != nil {
+			fmt.Printf("Error resetting template: %v\n", err)
+			return
+		}
+		fmt.Printf("%s emails now use the built-in template.\n", kind)
+		return
+	default:
+		fmt.Println("Invalid option.")
+		return
+	}
+
+	fmt.Printf("\nCurrent template:\n%s\n", source)
+	fmt.Println("\nEnter the new template (Go template syntax). Finish with a line containing only a dot:")
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." || (err != nil && line == "") {
+			break
+		}
+		lines = append(lines, line)
+		if err != nil {
+			break
+		}
+	}
+	*part = strings.Join(lines, "\n")
+	if strings.TrimSpace(*part) == "" {
+		fmt.Println("Empty template, nothing changed.")
+		return
+	}
+
+	if err := auth.SetEmailTemplate(ctx, store, userEmail, override); err != nil {
+		fmt.Printf("Template not saved: %v\n", err)
+		return
+	}
+	fmt.Printf("Custom %s template saved.\n", kind)
+}
+
+func scheduleDigest(ctx context.Context, store db.Store, userEmail string, cryptoAPI api.CryptoApi, reader *bufio.Reader) {
+	current, err := digest.GetSettings(ctx, store, userEmail)
+	if err != nil {
+		fmt.Printf("Error loading digest schedule: %v\n", err)
+		return
+	}
+
+	fmt.Println("\n=== Portfolio Digest ===")
+	switch current.Cadence {
+	case models.DigestDaily:
+		fmt.Printf("Daily at %02d:00 %s\n", current.Hour, current.Timezone)
+	case models.DigestWeekly:
+		fmt.Printf("Every %s at %02d:00 %s\n", current.Weekday, current.Hour, current.Timezone)
+	default:
+		fmt.Println("Digest emails are off.")
+	}
+
+	fmt.Println("\n1. Daily")
+	fmt.Println("2. Weekly")
+	fmt.Println("3. Off")
+	fmt.Println("4. Send a digest now")
+	fmt.Print("Choose an option: ")
+	choiceStr, _ := reader.ReadString('\n')
+
+	s := current
+	switch strings.TrimSpace(choiceStr) {
+	case "1":
+		s.Cadence = models.DigestDaily
+	case "2":
+		s.Cadence = models.DigestWeekly
+	case "3":
+		s.Cadence = models.DigestOff
+	case "4":
+		if err := digest.SendNow(ctx, store, cryptoAPI, userEmail); err != nil {
+			fmt.Printf("Error sending digest: %v\n", err)
+			return
+		}
+		fmt.Println("Digest queued; see the email outbox for its delivery.")
+		return
+	default:
+		fmt.Println("Invalid option.")
+		return
+	}
+
+	if s.Cadence != models.DigestOff {
+		fmt.Printf("Timezone, e.g. Europe/London (blank for %s): ", s.Timezone)
+		tzStr, _ := reader.ReadString('\n')
+		if tzStr = strings.TrimSpace(tzStr); tzStr != "" {
+			s.Timezone = tzStr
+		}
+
+		fmt.Printf("Hour of day to send, 0-23 (blank for %d): ", s.Hour)
+		hourStr, _ := reader.ReadString('\n')
+		if hourStr = strings.TrimSpace(hourStr); hourStr != "" {
+			hour, err := strconv.Atoi(hourStr)
+			if err != nil {
+				fmt.Println("Invalid hour.")
+				return
+			}
+			s.Hour = hour
+		}
+
+		if s.Cadence == models.DigestWeekly {
+			fmt.Printf("Day of week, 0=Sunday .. 6=Saturday (blank for %s): ", s.Weekday)
+			dayStr, _ := reader.ReadString('\n')
+			if dayStr = strings.TrimSpace(dayStr); dayStr != "" {
+				day, err := strconv.Atoi(dayStr)
+				if err != nil {
+					fmt.Println("Invalid day.")
+					return
+				}
+				s.Weekday = time.Weekday(day)
+			}
+		}
+	}
+
+	if err := digest.SetSettings(ctx, store, userEmail, s); err != nil {
+		fmt.Printf("Digest schedule not saved: %v\n", err)
+		return
+	}
+	if s.Cadence == models.DigestOff {
+		fmt.Println("Digest emails turned off.")
+		return
+	}
+	fmt.Println("Digest schedule saved. Digests are sent while the scheduler (-scheduler) is running.")
+}
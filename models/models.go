@@ -6,11 +6,13 @@ import (
 	"time"
 )
 
+// Holding is an open position; BuyPrice is in Currency, or USD when empty.
 type Holding struct {
 	CoinID   string    `bson:"coin_id"   json:"coin_id"`
 	CoinName string    `bson:"coin_name" json:"coin_name"`
 	Quantity float64   `bson:"quantity"  json:"quantity"`
 	BuyPrice float64   `bson:"buy_price" json:"buy_price"`
+	Currency string    `bson:"currency,omitempty" json:"currency,omitempty"`
 	AddedAt  time.Time `bson:"added_at"  json:"added_at"`
 }
 
@@ -19,6 +21,7 @@ type holdingJSON struct {
 	CoinName string  `json:"coin_name"`
 	Quantity float64 `json:"quantity"`
 	BuyPrice float64 `json:"buy_price"`
+	Currency string  `json:"currency,omitempty"`
 	AddedAt  string  `json:"added_at"`
 }
 
@@ -28,6 +31,7 @@ func (h Holding) MarshalJSON() ([]byte, error) {
 		CoinName: h.CoinName,
 		Quantity: h.Quantity,
 		BuyPrice: h.BuyPrice,
+		Currency: h.Currency,
 		AddedAt:  h.AddedAt.UTC().Format(time.RFC3339),
 	})
 }
@@ -47,27 +51,56 @@ func (h *Holding) UnmarshalJSON(data []byte) error {
 	h.CoinName = raw.CoinName
 	h.Quantity = raw.Quantity
 	h.BuyPrice = raw.BuyPrice
+	h.Currency = raw.Currency
 	h.AddedAt = t.UTC()
 	return nil
 }
 
+type CostBasisMethod string
+
+const (
+	CostBasisFIFO    CostBasisMethod = "fifo"
+	CostBasisLIFO    CostBasisMethod = "lifo"
+	CostBasisHIFO    CostBasisMethod = "hifo"
+	CostBasisAverage CostBasisMethod = "average"
+)
+
+func (m CostBasisMethod) Valid() bool {
+	switch m {
+	case CostBasisFIFO, CostBasisLIFO, CostBasisHIFO, CostBasisAverage:
+		return true
+	}
+	return false
+}
+
 type Portfolio struct {
-	UserEmail string    `bson:"user_email" json:"user_email"`
-	Holdings  []Holding `bson:"holdings"   json:"holdings"`
-	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	UserEmail       string          `bson:"user_email"                  json:"user_email"`
+	Holdings        []Holding       `bson:"holdings"                    json:"holdings"`
+	CostBasisMethod CostBasisMethod `bson:"cost_basis_method,omitempty" json:"cost_basis_method,omitempty"`
+	UpdatedAt       time.Time       `bson:"updated_at"                  json:"updated_at"`
+}
+
+// Method returns the user's cost-basis method, defaulting to FIFO.
+func (p Portfolio) Method() CostBasisMethod {
+	if p.CostBasisMethod.Valid() {
+		return p.CostBasisMethod
+	}
+	return CostBasisFIFO
 }
 
 type portfolioJSON struct {
-	UserEmail string    `json:"user_email"`
-	Holdings  []Holding `json:"holdings"`
-	UpdatedAt string    `json:"updated_at"`
+	UserEmail       string          `json:"user_email"`
+	Holdings        []Holding       `json:"holdings"`
+	CostBasisMethod CostBasisMethod `json:"cost_basis_method,omitempty"`
+	UpdatedAt       string          `json:"updated_at"`
 }
 
 func (p Portfolio) MarshalJSON() ([]byte, error) {
 	return json.Marshal(portfolioJSON{
-		UserEmail: p.UserEmail,
-		Holdings:  p.Holdings,
-		UpdatedAt: p.UpdatedAt.UTC().Format(time.RFC3339),
+		UserEmail:       p.UserEmail,
+		Holdings:        p.Holdings,
+		CostBasisMethod: p.CostBasisMethod,
+		UpdatedAt:       p.UpdatedAt.UTC().Format(time.RFC3339),
 	})
 }
 
@@ -84,6 +117,7 @@ func (p *Portfolio) UnmarshalJSON(data []byte) error {
 
 	p.UserEmail = raw.UserEmail
 	p.Holdings = raw.Holdings
+	p.CostBasisMethod = raw.CostBasisMethod
 	p.UpdatedAt = t.UTC()
 	return nil
 }
@@ -5,10 +5,73 @@ import "time"
 type AlertType string
 
 const (
-	AlertTypeBuy  AlertType = "buy"
-	AlertTypeSell AlertType = "sell"
+	AlertTypeBuy          AlertType = "buy"
+	AlertTypeSell         AlertType = "sell"
+	AlertTypePercentMove  AlertType = "percent_move"
+	AlertTypeTrailingStop AlertType = "trailing_stop"
+
+	// Portfolio-level alerts compare an aggregate metric against Threshold.
+	AlertTypePortfolioValue AlertType = "portfolio_value"
+	AlertTypePortfolioPL    AlertType = "portfolio_pl"
+	AlertTypeCoinWeight     AlertType = "coin_weight"
+
+	// Expression alerts fire when the boolean Expression holds.
+	AlertTypeExpression AlertType = "expression"
+)
+
+// IsPortfolioLevel reports whether the alert watches an aggregate portfolio
+// metric rather than a single coin's price.
+func (t AlertType) IsPortfolioLevel() bool {
+	switch t {
+	case AlertTypePortfolioValue, AlertTypePortfolioPL, AlertTypeCoinWeight:
+		return true
+	}
+	return false
+}
+
+type Comparator string
+
+const (
+	ComparatorAbove Comparator = "above"
+	ComparatorBelow Comparator = "below"
+)
+
+func (c Comparator) Valid() bool {
+	return c == ComparatorAbove || c == ComparatorBelow
+}
+
+// Met reports whether value has crossed threshold in the comparator's direction.
+func (c Comparator) Met(value, threshold float64) bool {
+	if c == ComparatorAbove {
+		return value >= threshold
+	}
+	return value <= threshold
+}
+
+// ReferenceSource says where a percent-move alert's reference price came from.
+type ReferenceSource string
+
+const (
+	ReferenceCreation ReferenceSource = "creation"
+	ReferenceAvgBuy   ReferenceSource = "avg_buy"
+)
+
+func (r ReferenceSource) Valid() bool {
+	return r == ReferenceCreation || r == ReferenceAvgBuy
+}
+
+type MoveDirection string
+
+const (
+	MoveUp     MoveDirection = "up"
+	MoveDown   MoveDirection = "down"
+	MoveEither MoveDirection = "either"
 )
 
+func (d MoveDirection) Valid() bool {
+	return d == MoveUp || d == MoveDown || d == MoveEither
+}
+
 type Alert struct {
 	ID             string    `bson:"_id,omitempty"  json:"id"`
 	UserEmail      string    `bson:"user_email"     json:"user_email"`
@@ -16,7 +79,76 @@ type Alert struct {
 	CoinName       string    `bson:"coin_name"      json:"coin_name"`
 	AlertType      AlertType `bson:"alert_type"     json:"alert_type"`
 	ThresholdPrice float64   `bson:"threshold_price" json:"threshold_price"`
+	Currency       string    `bson:"currency,omitempty" json:"currency,omitempty"`
 	Triggered      bool      `bson:"triggered"      json:"triggered"`
 	CreatedAt      time.Time `bson:"created_at"     json:"created_at"`
 	TriggeredAt    time.Time `bson:"triggered_at,omitempty" json:"triggered_at,omitempty"`
+
+	// Percent-move alerts fire once the price has moved PercentChange
+	// percent from ReferencePrice in Direction. ReferencePrice is in
+	// ReferenceCurrency, which is empty on alerts that predate it.
+	ReferencePrice    float64         `bson:"reference_price,omitempty"    json:"reference_price,omitempty"`
+	ReferenceCurrency string          `bson:"reference_currency,omitempty" json:"reference_currency,omitempty"`
+	ReferenceSource   ReferenceSource `bson:"reference_source,omitempty"   json:"reference_source,omitempty"`
+	PercentChange     float64         `bson:"percent_change,omitempty"     json:"percent_change,omitempty"`
+	Direction         MoveDirection   `bson:"direction,omitempty"          json:"direction,omitempty"`
+
+	// Trailing-stop alerts trail HighWaterMark, the highest price seen since
+	// creation, by either TrailAmount or TrailPercent.
+	TrailAmount   float64 `bson:"trail_amount,omitempty"    json:"trail_amount,omitempty"`
+	TrailPercent  float64 `bson:"trail_percent,omitempty"   json:"trail_percent,omitempty"`
+	HighWaterMark float64 `bson:"high_water_mark,omitempty" json:"high_water_mark,omitempty"`
+
+	// Threshold is in the alert currency for portfolio_value and
+	// portfolio_pl, and a percentage of total value for coin_weight.
+	Threshold  float64    `bson:"threshold,omitempty"  json:"threshold,omitempty"`
+	Comparator Comparator `bson:"comparator,omitempty" json:"comparator,omitempty"`
+
+	// Expression is the condition of an expression alert, e.g.
+	// price("ethereum") / price("bitcoin") < 0.05.
+	Expression string `bson:"expression,omitempty" json:"expression,omitempty"`
+
+	// Recurring alerts stay active after firing: they disarm, then re-arm
+	// once the observed value has moved RearmPercent back past the trigger
+	// condition (for trailing stops, RearmPercent of the trail distance above
+	// the stop), and never fire twice within Cooldown. MaxFirings of zero
+	// means no cap. Any alert past ExpiresAt is retired without firing.
+	// Triggered is set only once a recurring alert is retired.
+	Recurring    bool          `bson:"recurring,omitempty"     json:"recurring,omitempty"`
+	RearmPercent float64       `bson:"rearm_percent,omitempty" json:"rearm_percent,omitempty"`
+	Cooldown     time.Duration `bson:"cooldown,omitempty"      json:"cooldown,omitempty"`
+	MaxFirings   int           `bson:"max_firings,omitempty"   json:"max_firings,omitempty"`
+	ExpiresAt    time.Time     `bson:"expires_at,omitempty"    json:"expires_at,omitempty"`
+	FireCount    int           `bson:"fire_count,omitempty"    json:"fire_count,omitempty"`
+	LastFiredAt  time.Time     `bson:"last_fired_at,omitempty" json:"last_fired_at,omitempty"`
+	Disarmed     bool          `bson:"disarmed,omitempty"      json:"disarmed,omitempty"`
+	Expired      bool          `bson:"expired,omitempty"       json:"expired,omitempty"`
+
+	// Version is bumped on every update so concurrent checkers cannot both
+	// fire the same alert.
+	Version int64 `bson:"version" json:"version"`
+}
+
+// MoveFromReference is the signed percentage change from ReferencePrice.
+func (a Alert) MoveFromReference(price float64) float64 {
+	if a.ReferencePrice <= 0 {
+		return 0
+	}
+	return (price - a.ReferencePrice) / a.ReferencePrice * 100
+}
+
+// EffectiveStop is the price at which a trailing-stop alert currently fires.
+func (a Alert) EffectiveStop() float64 {
+	if a.TrailPercent > 0 {
+		return a.HighWaterMark * (1 - a.TrailPercent/100)
+	}
+	return a.HighWaterMark - a.TrailAmount
+}
+
+func (a Alert) IsExpired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && !now.Before(a.ExpiresAt)
+}
+
+func (a Alert) InCooldown(now time.Time) bool {
+	return a.Cooldown > 0 && !a.LastFiredAt.IsZero() && now.Before(a.LastFiredAt.Add(a.Cooldown))
 }
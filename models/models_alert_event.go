@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type DeliveryStatus string
+
+const (
+	DeliverySent   DeliveryStatus = "sent"
+	DeliveryFailed DeliveryStatus = "failed"
+	// DeliveryQueued means the notification is in the email outbox and
+	// has not been delivered or given up on yet.
+	DeliveryQueued DeliveryStatus = "queued"
+)
+
+// AlertEvent records one firing of an alert and what happened to its
+// notification. Events outlive the alert, so the alert's coin and condition
+// are copied in at fire time.
+type AlertEvent struct {
+	ID        string    `bson:"_id,omitempty" json:"id"`
+	AlertID   string    `bson:"alert_id"      json:"alert_id"`
+	UserEmail string    `bson:"user_email"    json:"user_email"`
+	CoinID    string    `bson:"coin_id"       json:"coin_id"`
+	CoinName  string    `bson:"coin_name"     json:"coin_name"`
+	AlertType AlertType `bson:"alert_type"    json:"alert_type"`
+	Condition string    `bson:"condition"     json:"condition"`
+	FiredAt   time.Time `bson:"fired_at"      json:"fired_at"`
+
+	// ObservedValue is the price, or for portfolio-level alerts the metric,
+	// that met the condition, in Currency.
+	ObservedValue float64 `bson:"observed_value" json:"observed_value"`
+	Currency      string  `bson:"currency"       json:"currency"`
+
+	Channel       string         `bson:"channel"                  json:"channel"`
+	Delivery      DeliveryStatus `bson:"delivery"                 json:"delivery"`
+	DeliveryError string         `bson:"delivery_error,omitempty" json:"delivery_error,omitempty"`
+}
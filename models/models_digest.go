@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+type DigestCadence string
+
+const (
+	DigestOff    DigestCadence = "off"
+	DigestDaily  DigestCadence = "daily"
+	DigestWeekly DigestCadence = "weekly"
+)
+
+// DigestSettings schedules a user's portfolio digest email. It is sent at
+// Hour o'clock in Timezone, every day or, for weekly digests, on Weekday.
+type DigestSettings struct {
+	Cadence  DigestCadence `bson:"cadence"            json:"cadence"`
+	Timezone string        `bson:"timezone,omitempty" json:"timezone,omitempty"`
+	Hour     int           `bson:"hour"               json:"hour"`
+	Weekday  time.Weekday  `bson:"weekday"            json:"weekday"`
+
+	// LastPeriodEnd is the end of the most recent period a digest was sent
+	// for. LastPrices are the coin prices, in LastCurrency, at that time, so
+	// the next digest can report how much each coin moved in between.
+	LastPeriodEnd time.Time          `bson:"last_period_end,omitempty" json:"last_period_end,omitempty"`
+	LastPrices    map[string]float64 `bson:"last_prices,omitempty"     json:"-"`
+	LastCurrency  string             `bson:"last_currency,omitempty"   json:"-"`
+}
+
+func (s *DigestSettings) Enabled() bool {
+	return s != nil && (s.Cadence == DigestDaily || s.Cadence == DigestWeekly)
+}
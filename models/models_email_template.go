@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type TemplateKind string
+
+const (
+	TemplateOTP    TemplateKind = "otp"
+	TemplateAlert  TemplateKind = "alert"
+	TemplateReport TemplateKind = "report"
+)
+
+// CustomizableTemplates are the kinds a user may override. OTP emails go out
+// before the account exists, so there is no user to hold an override.
+var CustomizableTemplates = []TemplateKind{TemplateAlert, TemplateReport}
+
+// EmailTemplate overrides the built-in template for one kind of email. Subject
+// and Text use text/template syntax and HTML uses html/template; an empty
+// part keeps the built-in one.
+type EmailTemplate struct {
+	Kind      TemplateKind `bson:"kind"              json:"kind"`
+	Subject   string       `bson:"subject,omitempty" json:"subject,omitempty"`
+	Text      string       `bson:"text,omitempty"    json:"text,omitempty"`
+	HTML      string       `bson:"html,omitempty"    json:"html,omitempty"`
+	UpdatedAt time.Time    `bson:"updated_at"        json:"updated_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+type OutboxKind string
+
+const (
+	OutboxOTP    OutboxKind = "otp"
+	OutboxAlert  OutboxKind = "alert"
+	OutboxReport OutboxKind = "report"
+)
+
+type OutboxStatus string
+
+const (
+	// OutboxPending messages are waiting for their first or a retry attempt.
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	// OutboxDead messages ran out of attempts or expired and are kept for
+	// inspection until retried by hand.
+	OutboxDead OutboxStatus = "dead"
+)
+
+// OutboxMessage is an email waiting in, or finished with, the delivery
+// outbox.
+type OutboxMessage struct {
+	ID      string     `bson:"_id,omitempty" json:"id"`
+	Kind    OutboxKind `bson:"kind"          json:"kind"`
+	To      string     `bson:"to"            json:"to"`
+	Subject string     `bson:"subject"       json:"subject"`
+	Body    string     `bson:"body"          json:"-"`
+	HTML    string     `bson:"html,omitempty" json:"-"`
+
+	// AlertEventID links an alert email to the history record whose
+	// delivery status it settles.
+	AlertEventID string `bson:"alert_event_id,omitempty" json:"alert_event_id,omitempty"`
+
+	Status        OutboxStatus `bson:"status"                 json:"status"`
+	Attempts      int          `bson:"attempts"               json:"attempts"`
+	MaxAttempts   int          `bson:"max_attempts"           json:"max_attempts"`
+	NextAttemptAt time.Time    `bson:"next_attempt_at"        json:"next_attempt_at"`
+	LastError     string       `bson:"last_error,omitempty"   json:"last_error,omitempty"`
+	CreatedAt     time.Time    `bson:"created_at"             json:"created_at"`
+	ExpiresAt     time.Time    `bson:"expires_at,omitempty"   json:"expires_at,omitempty"`
+	SentAt        time.Time    `bson:"sent_at,omitempty"      json:"sent_at,omitempty"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+type TransactionType string
+
+const (
+	TransactionTypeBuy         TransactionType = "buy"
+	TransactionTypeSell        TransactionType = "sell"
+	TransactionTypeTransferIn  TransactionType = "transfer_in"
+	TransactionTypeTransferOut TransactionType = "transfer_out"
+	TransactionTypeFee         TransactionType = "fee"
+	TransactionTypeReward      TransactionType = "reward"
+)
+
+func (t TransactionType) Valid() bool {
+	switch t {
+	case TransactionTypeBuy, TransactionTypeSell,
+		TransactionTypeTransferIn, TransactionTypeTransferOut,
+		TransactionTypeFee, TransactionTypeReward:
+		return true
+	}
+	return false
+}
+
+// IsAcquisition reports whether the transaction adds coins to the position.
+func (t TransactionType) IsAcquisition() bool {
+	return t == TransactionTypeBuy || t == TransactionTypeTransferIn || t == TransactionTypeReward
+}
+
+// IsDisposal reports whether the transaction removes coins from the position.
+func (t TransactionType) IsDisposal() bool {
+	return t == TransactionTypeSell || t == TransactionTypeTransferOut || t == TransactionTypeFee
+}
+
+// Transaction is one ledger entry. Price and Fee are in Currency; entries
+// recorded before currencies were tracked have none and are in USD.
+type Transaction struct {
+	ID         string          `bson:"_id,omitempty"  json:"id"`
+	UserEmail  string          `bson:"user_email"     json:"user_email"`
+	CoinID     string          `bson:"coin_id"        json:"coin_id"`
+	CoinName   string          `bson:"coin_name"      json:"coin_name"`
+	Type       TransactionType `bson:"type"           json:"type"`
+	Quantity   float64         `bson:"quantity"       json:"quantity"`
+	Price      float64         `bson:"price"          json:"price"`
+	Fee        float64         `bson:"fee"            json:"fee"`
+	Currency   string          `bson:"currency,omitempty" json:"currency,omitempty"`
+	Note       string          `bson:"note,omitempty" json:"note,omitempty"`
+	ExecutedAt time.Time       `bson:"executed_at"    json:"executed_at"`
+	CreatedAt  time.Time       `bson:"created_at"     json:"created_at"`
+}
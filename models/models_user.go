@@ -0,0 +1,48 @@
+package models
+
+type User struct {
+	Email    string `bson:"email"`
+	Password string `bson:"password"`
+	Verified bool   `bson:"verified"`
+	OTP      string `bson:"otp"`
+	Currency string `bson:"currency,omitempty"`
+
+	// Channels lists where alert notifications go. Empty means email only.
+	Channels []NotificationChannel `bson:"notification_channels,omitempty"`
+
+	// EmailTemplates holds the user's overrides of the built-in emails.
+	EmailTemplates []EmailTemplate `bson:"email_templates,omitempty"`
+
+	// Digest is nil until the user schedules a digest email.
+	Digest *DigestSettings `bson:"digest,omitempty"`
+}
+
+// EmailTemplate returns the user's override for kind, or nil.
+func (u *User) EmailTemplate(kind TemplateKind) *EmailTemplate {
+	if u == nil {
+		return nil
+	}
+	for i := range u.EmailTemplates {
+		if u.EmailTemplates[i].Kind == kind {
+			return &u.EmailTemplates[i]
+		}
+	}
+	return nil
+}
+
+type ChannelKind string
+
+const (
+	ChannelEmail   ChannelKind = "email"
+	ChannelWebhook ChannelKind = "webhook"
+	ChannelFile    ChannelKind = "file"
+)
+
+// NotificationChannel is one destination for a user's alerts. URL and Secret
+// apply to webhooks; Path applies to file sinks, where "-" means stdout.
+type NotificationChannel struct {
+	Kind   ChannelKind `bson:"kind"             json:"kind"`
+	URL    string      `bson:"url,omitempty"    json:"url,omitempty"`
+	Secret string      `bson:"secret,omitempty" json:"-"`
+	Path   string      `bson:"path,omitempty"   json:"path,omitempty"`
+}
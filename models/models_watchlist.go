@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+type WatchedCoin struct {
+	CoinID   string    `bson:"coin_id"   json:"coin_id"`
+	CoinName string    `bson:"coin_name" json:"coin_name"`
+	AddedAt  time.Time `bson:"added_at"  json:"added_at"`
+}
+
+// Watchlist holds coins a user follows without owning, so they can carry
+// alerts. It is stored separately from the portfolio.
+type Watchlist struct {
+	UserEmail string        `bson:"user_email" json:"user_email"`
+	Coins     []WatchedCoin `bson:"coins"      json:"coins"`
+	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+func (w Watchlist) Has(coinID string) bool {
+	for _, c := range w.Coins {
+		if c.CoinID == coinID {
+			return true
+		}
+	}
+	return false
+}
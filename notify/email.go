@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	emailpkg "crypto-portfolio-tracker/email"
+	"crypto-portfolio-tracker/models"
+	"crypto-portfolio-tracker/outbox"
+	"errors"
+)
+
+// Email queues the message for the alert owner in Store's email outbox and
+// makes one delivery attempt; failures are retried by the outbox worker.
+type Email struct {
+	Store db.Store
+}
+
+func (Email) Name() string { return string(models.ChannelEmail) }
+
+func (e Email) Notify(ctx context.Context, msg Message) error {
+	if e.Store == nil {
+		return errors.New("email notifier has no outbox store")
+	}
+
+	m := outbox.NewMessage(models.OutboxAlert, msg.UserEmail, emailpkg.Content{Subject: msg.Subject, Text: msg.Body})
+	if err := outbox.Enqueue(ctx, e.Store, m); err != nil {
+		return err
+	}
+	return outbox.Deliver(ctx, e.Store, m.ID)
+}
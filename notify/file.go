@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"crypto-portfolio-tracker/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// fileMu serialises writes so concurrent alerts never interleave lines.
+var fileMu sync.Mutex
+
+// File appends each message as a JSON line to Path, or writes it to stdout
+// when Path is "-".
+type File struct {
+	Path string
+}
+
+func (f File) Name() string { return string(models.ChannelFile) }
+
+func (f File) Notify(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+	line = append(line, '\n')
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if f.Path == "-" {
+		_, err := os.Stdout.Write(line)
+		return err
+	}
+
+	out, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", f.Path, err)
+	}
+	if _, err := out.Write(line); err != nil {
+		out.Close()
+		return fmt.Errorf("error writing %s: %w", f.Path, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Message is a fired alert ready for delivery. Subject and Body are the
+// human-readable rendering; the other fields let machine consumers such as
+// webhooks act on the alert without parsing text.
+type Message struct {
+	AlertID   string           `json:"alert_id"`
+	UserEmail string           `json:"user_email"`
+	CoinID    string           `json:"coin_id,omitempty"`
+	CoinName  string           `json:"coin_name"`
+	AlertType models.AlertType `json:"alert_type"`
+	Condition string           `json:"condition"`
+	Value     float64          `json:"value"`
+	Currency  string           `json:"currency"`
+	FiredAt   time.Time        `json:"fired_at"`
+	Subject   string           `json:"subject"`
+	Body      string           `json:"body"`
+}
+
+// Notifier delivers alert messages over one channel.
+type Notifier interface {
+	// Name identifies the channel in alert history, e.g. "email".
+	Name() string
+	Notify(ctx context.Context, msg Message) error
+}
+
+// DefaultChannels is used for users who have not chosen any channel.
+var DefaultChannels = []models.NotificationChannel{{Kind: models.ChannelEmail}}
+
+// New builds the notifier for ch, validating its settings. Email is queued
+// in store's outbox.
+func New(store db.Store, ch models.NotificationChannel) (Notifier, error) {
+	switch ch.Kind {
+	case models.ChannelEmail:
+		return Email{Store: store}, nil
+
+	case models.ChannelWebhook:
+		u, err := url.Parse(ch.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, customerrors.NewValidationError("webhook url", ch.URL, fmt.Errorf("must be an absolute http(s) URL"))
+		}
+		return NewWebhook(ch.URL, ch.Secret), nil
+
+	case models.ChannelFile:
+		if ch.Path == "" {
+			return nil, customerrors.NewValidationError("file path", ch.Path, fmt.Errorf("must be a file path or - for stdout"))
+		}
+		return File{Path: ch.Path}, nil
+	}
+	return nil, customerrors.NewValidationError("channel", ch.Kind, fmt.Errorf("unknown notification channel"))
+}
+
+// ForUser returns a notifier for each of the user's channels, falling back
+// to DefaultChannels when none are set.
+func ForUser(store db.Store, u *models.User) ([]Notifier, error) {
+	channels := DefaultChannels
+	if u != nil && len(u.Channels) > 0 {
+		channels = u.Channels
+	}
+
+	notifiers := make([]Notifier, 0, len(channels))
+	for _, ch := range channels {
+		n, err := New(store, ch)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhook_SignsJSONPayload(t *testing.T) {
+	var got Message
+	var signature, timestamp string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		timestamp = r.Header.Get(TimestampHeader)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	n, err := New(nil, models.NotificationChannel{Kind: models.ChannelWebhook, URL: srv.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := Message{AlertID: "a1", CoinID: "bitcoin", Value: 50000, Subject: "hi"}
+	if err := n.Notify(context.Background(), msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.AlertID != "a1" || got.Value != 50000 {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+	if signature != Sign("s3cret", timestamp, body) || !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("signature %q does not match body", signature)
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("expected a current timestamp header, got %q", timestamp)
+	}
+	if Sign("s3cret", strconv.FormatInt(ts-3600, 10), body) == signature {
+		t.Error("expected the signature to depend on the timestamp")
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL, "").Notify(context.Background(), Message{}); err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+}
+
+func TestFile_AppendsJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.log")
+	n := File{Path: path}
+
+	for _, id := range []string{"a1", "a2"} {
+		if err := n.Notify(context.Background(), Message{AlertID: id}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"alert_id":"a2"`) {
+		t.Errorf("unexpected log contents: %q", data)
+	}
+}
+
+func TestEmail_QueuesInOutbox(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+
+	n, err := New(store, models.NotificationChannel{Kind: models.ChannelEmail})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// No SMTP server is configured, so the first attempt fails and the
+	// message stays queued for a retry.
+	if err := n.Notify(ctx, Message{UserEmail: "user@example.com", Subject: "hi", Body: "body"}); err == nil {
+		t.Error("expected the first delivery attempt to fail")
+	}
+
+	msgs, err := store.Outbox().List(ctx, db.OutboxFilter{To: "user@example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Kind != models.OutboxAlert || msgs[0].Status != models.OutboxPending || msgs[0].Subject != "hi" {
+		t.Errorf("expected the email to wait in the outbox, got %+v", msgs)
+	}
+}
+
+func TestNew_RejectsInvalidChannels(t *testing.T) {
+	for _, ch := range []models.NotificationChannel{
+		{Kind: "sms"},
+		{Kind: models.ChannelWebhook, URL: "example.com/hook"},
+		{Kind: models.ChannelFile},
+	} {
+		if _, err := New(nil, ch); err == nil {
+			t.Errorf("expected error for %+v", ch)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto-portfolio-tracker/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256, keyed with the channel secret
+// and prefixed with "sha256=", of TimestampHeader's value, a dot and the
+// request body. Signing the timestamp lets receivers reject replayed
+// payloads by refusing old timestamps.
+const (
+	SignatureHeader = "X-Tracker-Signature"
+	TimestampHeader = "X-Tracker-Timestamp"
+)
+
+// Webhook POSTs the message as JSON to URL. When Secret is set the body is
+// signed so the receiver can verify it came from this tracker.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *Webhook) Name() string { return string(models.ChannelWebhook) }
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, Sign(w.Secret, ts, payload))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp, the
+// TimestampHeader value in Unix seconds.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,273 @@
+package outbox
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/email"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultInterval    = 15 * time.Second
+
+	// baseBackoff doubles after every failed attempt up to maxBackoff, so
+	// the default attempts span a little over an hour.
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+
+	// claimLease is how long a claimed message is hidden from other
+	// workers. It must comfortably exceed the SMTP timeout.
+	claimLease = 2 * time.Minute
+
+	defaultBatchSize = 50
+)
+
+// OTPValidFor bounds how late an OTP may still be delivered; a code that
+// arrives after the signup prompt has gone is useless.
+const OTPValidFor = 10 * time.Minute
+
+var errExpired = errors.New("message expired before it could be delivered")
+
+// NewMessage builds a pending message that is due immediately.
+func NewMessage(kind models.OutboxKind, to string, c email.Content) models.OutboxMessage {
+	now := time.Now()
+	m := models.OutboxMessage{
+		ID:            primitive.NewObjectID().Hex(),
+		Kind:          kind,
+		To:            to,
+		Subject:       c.Subject,
+		Body:          c.Text,
+		HTML:          c.HTML,
+		Status:        models.OutboxPending,
+		MaxAttempts:   DefaultMaxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if kind == models.OutboxOTP {
+		m.ExpiresAt = now.Add(OTPValidFor)
+	}
+	return m
+}
+
+func Enqueue(ctx context.Context, store db.Store, msgs ...models.OutboxMessage) error {
+	return store.Outbox().Enqueue(ctx, msgs...)
+}
+
+// Deliver makes one immediate attempt at the given pending messages. Those
+// that fail stay in the outbox and are retried by the worker.
+func Deliver(ctx context.Context, store db.Store, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := NewWorker(store, 0).RunOnce(ctx, ids...)
+	return err
+}
+
+// backoff returns the delay before the next attempt after the given number
+// of failed attempts.
+func backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// Worker delivers due outbox messages. Claims are leased, so any number of
+// workers and immediate Deliver calls can share one store; a message whose
+// worker dies mid-send is retried once its lease runs out.
+type Worker struct {
+	Store db.Store
+	// Send delivers one email; it defaults to email.SendMail.
+	Send      func(ctx context.Context, to string, c email.Content) error
+	Interval  time.Duration
+	BatchSize int
+	// Quiet keeps Run from printing, for running behind the interactive menu.
+	Quiet bool
+
+	clock func() time.Time
+}
+
+func NewWorker(store db.Store, interval time.Duration) *Worker {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Worker{Store: store, Send: email.SendMail, Interval: interval, BatchSize: defaultBatchSize}
+}
+
+func (w *Worker) now() time.Time {
+	if w.clock != nil {
+		return w.clock()
+	}
+	return time.Now()
+}
+
+// RunOnce attempts every due message, or only those in ids when given. It
+// returns how many were sent and the errors of those that were not.
+func (w *Worker) RunOnce(ctx context.Context, ids ...string) (int, error) {
+	now := w.now()
+	msgs, err := w.Store.Outbox().Claim(ctx, now, now.Add(claimLease), w.BatchSize, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+	for i := range msgs {
+		if err := w.attempt(ctx, &msgs[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+func (w *Worker) attempt(ctx context.Context, m *models.OutboxMessage) error {
+	var sendErr error
+	if !m.ExpiresAt.IsZero() && w.now().After(m.ExpiresAt) {
+		sendErr = errExpired
+		m.Status = models.OutboxDead
+	} else {
+		sendErr = w.Send(ctx, m.To, email.Content{Subject: m.Subject, Text: m.Body, HTML: m.HTML})
+		if sendErr != nil && ctx.Err() != nil {
+			// Shutting down is not the message's fault: leave the claim
+			// to lapse so the attempt is not counted.
+			return ctx.Err()
+		}
+
+		m.Attempts++
+		maxAttempts := m.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = DefaultMaxAttempts
+		}
+		switch {
+		case sendErr == nil:
+			m.Status = models.OutboxSent
+			m.SentAt = w.now()
+			m.LastError = ""
+		case m.Attempts >= maxAttempts:
+			m.Status = models.OutboxDead
+		default:
+			m.NextAttemptAt = w.now().Add(backoff(m.Attempts))
+		}
+	}
+	if sendErr != nil {
+		m.LastError = sendErr.Error()
+	}
+	if m.Kind == models.OutboxOTP && m.Status != models.OutboxPending {
+		// Codes are not kept at rest once they can no longer be sent.
+		m.Body = ""
+		m.HTML = ""
+	}
+
+	if err := w.Store.Outbox().Update(ctx, m); err != nil {
+		return fmt.Errorf("could not record delivery of %s: %w", m.ID, err)
+	}
+	if m.AlertEventID != "" && m.Status != models.OutboxPending {
+		status := models.DeliverySent
+		if m.Status == models.OutboxDead {
+			status = models.DeliveryFailed
+		}
+		if err := w.Store.AlertEvents().SetDelivery(ctx, m.AlertEventID, status, m.LastError); err != nil {
+			fmt.Printf("  Warning: could not update alert history for %s: %v\n", m.AlertEventID, err)
+		}
+	}
+
+	if sendErr != nil {
+		return fmt.Errorf("email to %s: %w", m.To, sendErr)
+	}
+	return nil
+}
+
+// Run delivers due messages immediately and then after every interval until
+// ctx is cancelled, returning ctx.Err().
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := w.RunOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !w.Quiet {
+			fmt.Printf("[outbox] delivery failed: %v\n", err)
+		}
+		if sent > 0 && !w.Quiet {
+			fmt.Printf("[outbox] %s: %d email(s) sent\n", w.now().Format(time.RFC3339), sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Retry moves the user's dead-lettered messages back to pending so they are
+// attempted again, returning their IDs. Expired OTPs are left alone.
+func Retry(ctx context.Context, store db.Store, to string) ([]string, error) {
+	dead, err := store.Outbox().List(ctx, db.OutboxFilter{To: to, Statuses: []models.OutboxStatus{models.OutboxDead}})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	now := time.Now()
+	for _, m := range dead {
+		if m.Kind == models.OutboxOTP {
+			continue
+		}
+		m.Status = models.OutboxPending
+		m.Attempts = 0
+		m.NextAttemptAt = now
+		if err := store.Outbox().Update(ctx, &m); err != nil {
+			return ids, err
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// DisplayOutbox lists the user's undelivered email: messages waiting for a
+// retry and those that were given up on.
+func DisplayOutbox(ctx context.Context, store db.Store, to string) error {
+	msgs, err := store.Outbox().List(ctx, db.OutboxFilter{
+		To:       to,
+		Statuses: []models.OutboxStatus{models.OutboxPending, models.OutboxDead},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(msgs) == 0 {
+		fmt.Println("No pending or failed emails.")
+		return nil
+	}
+
+	fmt.Println("\n========== EMAIL OUTBOX ==========")
+	for i, m := range msgs {
+		fmt.Printf("\n[%d] %s\n", i+1, m.Subject)
+		fmt.Printf("    Created   : %s\n", m.CreatedAt.Format("02 Jan 2006, 15:04 UTC"))
+		if m.Status == models.OutboxDead {
+			fmt.Printf("    Status    : FAILED after %d attempt(s)\n", m.Attempts)
+		} else {
+			fmt.Printf("    Status    : pending, %d attempt(s), next at %s\n", m.Attempts, m.NextAttemptAt.Format("02 Jan 2006, 15:04 UTC"))
+		}
+		if m.LastError != "" {
+			fmt.Printf("    Last error: %s\n", m.LastError)
+		}
+	}
+	fmt.Printf("\n%d message(s)\n", len(msgs))
+	fmt.Println("==================================")
+
+	return nil
+}
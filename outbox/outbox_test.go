@@ -0,0 +1,126 @@
+package outbox
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	"crypto-portfolio-tracker/email"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestWorker(store db.Store, send func(ctx context.Context, to string, c email.Content) error) (*Worker, *fakeClock) {
+	// Start just ahead of real time so freshly built messages are due.
+	clock := &fakeClock{t: time.Now().Add(time.Second)}
+	w := NewWorker(store, 0)
+	w.Send = send
+	w.clock = clock.now
+	return w, clock
+}
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, d := range want {
+		if got := backoff(i + 1); got != d {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, d)
+		}
+	}
+	if got := backoff(50); got != maxBackoff {
+		t.Errorf("expected backoff to be capped at %v, got %v", maxBackoff, got)
+	}
+}
+
+func TestWorker_RetriesThenDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	calls := 0
+	w, clock := newTestWorker(store, func(ctx context.Context, to string, c email.Content) error {
+		calls++
+		return errors.New("421 service not available")
+	})
+
+	event := models.AlertEvent{ID: "e1", UserEmail: "a@example.com", Delivery: models.DeliveryQueued}
+	if err := store.AlertEvents().Insert(ctx, &event); err != nil {
+		t.Fatalf("inserting event: %v", err)
+	}
+	m := NewMessage(models.OutboxAlert, "a@example.com", email.Content{Subject: "Crypto Alert", Text: "body"})
+	m.MaxAttempts = 3
+	m.AlertEventID = "e1"
+	if err := Enqueue(ctx, store, m); err != nil {
+		t.Fatalf("enqueueing: %v", err)
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if _, err := w.RunOnce(ctx); err == nil {
+			t.Fatalf("attempt %d: expected delivery error", attempt)
+		}
+		if _, err := w.RunOnce(ctx); err != nil || calls != attempt {
+			t.Fatalf("attempt %d: expected no retry before the backoff elapsed, got %d calls", attempt, calls)
+		}
+		clock.t = clock.t.Add(backoff(attempt))
+	}
+
+	msgs, _ := store.Outbox().List(ctx, db.OutboxFilter{})
+	if len(msgs) != 1 || msgs[0].Status != models.OutboxDead || msgs[0].Attempts != 3 || msgs[0].LastError == "" {
+		t.Fatalf("expected message dead-lettered after 3 attempts, got %+v", msgs)
+	}
+	events, _ := store.AlertEvents().List(ctx, "a@example.com", db.AlertEventFilter{})
+	if len(events) != 1 || events[0].Delivery != models.DeliveryFailed {
+		t.Errorf("expected alert history to record the failure, got %+v", events)
+	}
+
+	ids, err := Retry(ctx, store, "a@example.com")
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("expected one message requeued, got %v, %v", ids, err)
+	}
+	w.Send = func(ctx context.Context, to string, c email.Content) error { return nil }
+	if sent, err := w.RunOnce(ctx, ids...); err != nil || sent != 1 {
+		t.Fatalf("expected retried message to be sent, got %d, %v", sent, err)
+	}
+	events, _ = store.AlertEvents().List(ctx, "a@example.com", db.AlertEventFilter{})
+	if events[0].Delivery != models.DeliverySent {
+		t.Errorf("expected alert history to record delivery, got %+v", events[0])
+	}
+}
+
+func TestWorker_OTP(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	var sent []string
+	w, clock := newTestWorker(store, func(ctx context.Context, to string, c email.Content) error {
+		sent = append(sent, c.Text)
+		return nil
+	})
+
+	fresh := NewMessage(models.OutboxOTP, "a@example.com", email.Content{Subject: "OTP", Text: "Your OTP is: 123456", HTML: "<p>123456</p>"})
+	stale := NewMessage(models.OutboxOTP, "b@example.com", email.Content{Subject: "OTP", Text: "Your OTP is: 654321"})
+	stale.ExpiresAt = clock.t.Add(-time.Second)
+	if err := Enqueue(ctx, store, fresh, stale); err != nil {
+		t.Fatalf("enqueueing: %v", err)
+	}
+
+	if _, err := w.RunOnce(ctx); err == nil {
+		t.Fatal("expected the expired OTP to be reported")
+	}
+	if len(sent) != 1 || sent[0] != "Your OTP is: 123456" {
+		t.Errorf("expected only the fresh OTP to be sent, got %q", sent)
+	}
+
+	msgs, _ := store.Outbox().List(ctx, db.OutboxFilter{})
+	for _, m := range msgs {
+		if m.Body != "" || m.HTML != "" {
+			t.Errorf("expected OTP body to be scrubbed once finished, got %+v", m)
+		}
+		if m.ID == stale.ID && (m.Status != models.OutboxDead || m.LastError != errExpired.Error()) {
+			t.Errorf("expected expired OTP to be dead-lettered, got %+v", m)
+		}
+	}
+	if ids, _ := Retry(ctx, store, "b@example.com"); len(ids) != 0 {
+		t.Errorf("expected expired OTPs not to be retried, got %v", ids)
+	}
+}
@@ -0,0 +1,307 @@
+package portfolio
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Lot struct {
+	TransactionID string
+	CoinID        string
+	Type          models.TransactionType
+	AcquiredAt    time.Time
+	Quantity      float64
+	Remaining     float64
+	UnitCost      float64
+}
+
+func (l Lot) RemainingBasis() float64 {
+	return l.Remaining * l.UnitCost
+}
+
+type LotMatch struct {
+	LotTransactionID string
+	AcquiredAt       time.Time
+	Quantity         float64
+	CostBasis        float64
+}
+
+type Disposal struct {
+	TransactionID string
+	CoinID        string
+	Type          models.TransactionType
+	DisposedAt    time.Time
+	Quantity      float64
+	Proceeds      float64
+	CostBasis     float64
+	Matches       []LotMatch
+}
+
+func (d Disposal) Gain() float64 {
+	return d.Proceeds - d.CostBasis
+}
+
+// CostBasis holds a coin's lots and disposals, all in Currency.
+type CostBasis struct {
+	CoinID    string
+	CoinName  string
+	Currency  string
+	Method    models.CostBasisMethod
+	Lots      []Lot
+	Disposals []Disposal
+
+	priced bool
+}
+
+// addCurrency records the currency of tx, refusing a priced entry in another
+// currency than the coin's earlier ones. Entries without a price or fee
+// carry no amount and fit any currency.
+func (c *CostBasis) addCurrency(tx models.Transaction) error {
+	code := currency.OrDefault(tx.Currency)
+	if c.Currency == "" {
+		c.Currency = code
+	}
+	if tx.Price == 0 && tx.Fee == 0 {
+		return nil
+	}
+	if !c.priced {
+		c.Currency = code
+		c.priced = true
+		return nil
+	}
+	if c.Currency != code {
+		return customerrors.NewPortfolioError(
+			string(tx.Type),
+			tx.CoinID,
+			fmt.Errorf("%w: %s is recorded in %s, not %s", customerrors.ErrCurrencyMismatch, tx.CoinID, strings.ToUpper(c.Currency), strings.ToUpper(code)),
+		)
+	}
+	return nil
+}
+
+func (c *CostBasis) RemainingQuantity() float64 {
+	var total float64
+	for _, l := range c.Lots {
+		total += l.Remaining
+	}
+	return total
+}
+
+func (c *CostBasis) RemainingBasis() float64 {
+	var total float64
+	for _, l := range c.Lots {
+		total += l.RemainingBasis()
+	}
+	return total
+}
+
+// consumeOrder returns the indexes of open lots in the order a disposal draws
+// them down under the given method.
+func consumeOrder(lots []Lot, method models.CostBasisMethod) []int {
+	idx := make([]int, 0, len(lots))
+	for i := range lots {
+		if lots[i].Remaining > quantityEpsilon {
+			idx = append(idx, i)
+		}
+	}
+
+	switch method {
+	case models.CostBasisLIFO:
+		sort.SliceStable(idx, func(a, b int) bool {
+			return lots[idx[a]].AcquiredAt.After(lots[idx[b]].AcquiredAt)
+		})
+	case models.CostBasisHIFO:
+		sort.SliceStable(idx, func(a, b int) bool {
+			return lots[idx[a]].UnitCost > lots[idx[b]].UnitCost
+		})
+	}
+	return idx
+}
+
+// reaverage spreads the pooled basis evenly across every open lot, which is
+// how the average-cost method keeps per-lot figures summing to the pool.
+func reaverage(lots []Lot) {
+	var qty, basis float64
+	for _, l := range lots {
+		qty += l.Remaining
+		basis += l.RemainingBasis()
+	}
+	if qty <= quantityEpsilon {
+		return
+	}
+	for i := range lots {
+		lots[i].UnitCost = basis / qty
+	}
+}
+
+// ComputeCostBasis replays the ledger per coin and matches every disposal
+// against acquisition lots using the given method.
+func ComputeCostBasis(txs []models.Transaction, method models.CostBasisMethod) (map[string]*CostBasis, error) {
+	if !method.Valid() {
+		return nil, customerrors.NewValidationError("cost_basis_method", method, customerrors.ErrInvalidCostBasisMethod)
+	}
+
+	sorted := make([]models.Transaction, len(txs))
+	copy(sorted, txs)
+	sortTransactions(sorted)
+
+	results := make(map[string]*CostBasis)
+	for _, tx := range sorted {
+		cb, ok := results[tx.CoinID]
+		if !ok {
+			cb = &CostBasis{CoinID: tx.CoinID, CoinName: tx.CoinName, Method: method}
+			results[tx.CoinID] = cb
+		}
+		if cb.CoinName == "" {
+			cb.CoinName = tx.CoinName
+		}
+		if err := cb.addCurrency(tx); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case tx.Type.IsAcquisition():
+			cb.Lots = append(cb.Lots, Lot{
+				TransactionID: tx.ID,
+				CoinID:        tx.CoinID,
+				Type:          tx.Type,
+				AcquiredAt:    tx.ExecutedAt,
+				Quantity:      tx.Quantity,
+				Remaining:     tx.Quantity,
+				UnitCost:      (tx.Quantity*tx.Price + tx.Fee) / tx.Quantity,
+			})
+			if method == models.CostBasisAverage {
+				reaverage(cb.Lots)
+			}
+
+		case tx.Type.IsDisposal():
+			held := cb.RemainingQuantity()
+			if tx.Quantity > held+quantityEpsilon {
+				return nil, customerrors.NewPortfolioError(
+					string(tx.Type),
+					tx.CoinID,
+					fmt.Errorf("%w: have %.8f, need %.8f", customerrors.ErrInsufficientFunds, held, tx.Quantity),
+				)
+			}
+
+			d := Disposal{
+				TransactionID: tx.ID,
+				CoinID:        tx.CoinID,
+				Type:          tx.Type,
+				DisposedAt:    tx.ExecutedAt,
+				Quantity:      tx.Quantity,
+			}
+			if tx.Type == models.TransactionTypeSell {
+				d.Proceeds = tx.Quantity*tx.Price - tx.Fee
+			}
+
+			need := tx.Quantity
+			for _, i := range consumeOrder(cb.Lots, method) {
+				if need <= quantityEpsilon {
+					break
+				}
+				take := cb.Lots[i].Remaining
+				if take > need {
+					take = need
+				}
+				cb.Lots[i].Remaining -= take
+				if cb.Lots[i].Remaining <= quantityEpsilon {
+					cb.Lots[i].Remaining = 0
+				}
+				need -= take
+
+				basis := take * cb.Lots[i].UnitCost
+				d.CostBasis += basis
+				d.Matches = append(d.Matches, LotMatch{
+					LotTransactionID: cb.Lots[i].TransactionID,
+					AcquiredAt:       cb.Lots[i].AcquiredAt,
+					Quantity:         take,
+					CostBasis:        basis,
+				})
+			}
+
+			cb.Disposals = append(cb.Disposals, d)
+		}
+	}
+
+	for _, cb := range results {
+		open := cb.Lots[:0]
+		for _, l := range cb.Lots {
+			if l.Remaining > 0 {
+				open = append(open, l)
+			}
+		}
+		cb.Lots = open
+	}
+
+	return results, nil
+}
+
+func GetCostBasis(ctx context.Context, store db.Store, userEmail string, coinIDs ...string) (map[string]*CostBasis, error) {
+	p, err := GetPortfolio(ctx, store, userEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	txs, err := GetTransactions(ctx, store, userEmail, coinIDs...)
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		txs = filterTransactions(legacyTransactions(p), coinIDs...)
+	}
+
+	return ComputeCostBasis(txs, p.Method())
+}
+
+func filterTransactions(txs []models.Transaction, coinIDs ...string) []models.Transaction {
+	if len(coinIDs) == 0 {
+		return txs
+	}
+	wanted := make(map[string]bool, len(coinIDs))
+	for _, id := range normalizeCoinIDs(coinIDs) {
+		wanted[id] = true
+	}
+	filtered := make([]models.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if wanted[tx.CoinID] {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
+
+func SetCostBasisMethod(ctx context.Context, store db.Store, userEmail string, method models.CostBasisMethod) error {
+	if !method.Valid() {
+		return customerrors.NewValidationError("cost_basis_method", method, customerrors.ErrInvalidCostBasisMethod)
+	}
+
+	p, err := GetPortfolio(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+
+	ledger, err := store.Transactions().List(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	if len(ledger) > 0 {
+		holdings, err := DeriveHoldings(ledger, method)
+		if err != nil {
+			return err
+		}
+		p.Holdings = holdings
+	}
+
+	p.CostBasisMethod = method
+	p.UpdatedAt = time.Now()
+	return store.Portfolios().Save(ctx, p)
+}
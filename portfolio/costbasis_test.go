@@ -0,0 +1,195 @@
+package portfolio
+
+import (
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func costBasisLedger() []models.Transaction {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	txs := []models.Transaction{
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 100, base),
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 300, base.AddDate(0, 1, 0)),
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 200, base.AddDate(0, 2, 0)),
+		tx(models.TransactionTypeSell, "bitcoin", 1.5, 400, base.AddDate(0, 3, 0)),
+	}
+	for i := range txs {
+		txs[i].ID = string(rune('a' + i))
+	}
+	return txs
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestComputeCostBasis_Methods(t *testing.T) {
+	tests := []struct {
+		method        models.CostBasisMethod
+		soldBasis     float64
+		remainingLots map[string]float64
+		remaining     float64
+	}{
+		{models.CostBasisFIFO, 250, map[string]float64{"b": 0.5, "c": 1}, 350},
+		{models.CostBasisLIFO, 350, map[string]float64{"a": 1, "b": 0.5}, 250},
+		{models.CostBasisHIFO, 400, map[string]float64{"a": 1, "c": 0.5}, 200},
+		{models.CostBasisAverage, 300, map[string]float64{"b": 0.5, "c": 1}, 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.method), func(t *testing.T) {
+			bases, err := ComputeCostBasis(costBasisLedger(), tt.method)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cb := bases["bitcoin"]
+
+			if len(cb.Disposals) != 1 {
+				t.Fatalf("got %d disposals, want 1", len(cb.Disposals))
+			}
+			d := cb.Disposals[0]
+			if !almostEqual(d.CostBasis, tt.soldBasis) {
+				t.Errorf("disposal basis: got %.2f, want %.2f", d.CostBasis, tt.soldBasis)
+			}
+			if !almostEqual(d.Proceeds, 600) {
+				t.Errorf("proceeds: got %.2f, want 600", d.Proceeds)
+			}
+			if !almostEqual(d.Gain(), 600-tt.soldBasis) {
+				t.Errorf("gain: got %.2f, want %.2f", d.Gain(), 600-tt.soldBasis)
+			}
+
+			if len(cb.Lots) != len(tt.remainingLots) {
+				t.Fatalf("got %d open lots, want %d", len(cb.Lots), len(tt.remainingLots))
+			}
+			for _, l := range cb.Lots {
+				if want, ok := tt.remainingLots[l.TransactionID]; !ok || !almostEqual(l.Remaining, want) {
+					t.Errorf("lot %s: remaining %.4f, want %.4f", l.TransactionID, l.Remaining, want)
+				}
+			}
+			if !almostEqual(cb.RemainingQuantity(), 1.5) {
+				t.Errorf("remaining quantity: got %.4f, want 1.5", cb.RemainingQuantity())
+			}
+			if !almostEqual(cb.RemainingBasis(), tt.remaining) {
+				t.Errorf("remaining basis: got %.2f, want %.2f", cb.RemainingBasis(), tt.remaining)
+			}
+		})
+	}
+}
+
+func TestComputeCostBasis_FeesIncludedInBasis(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	buy := tx(models.TransactionTypeBuy, "ethereum", 2, 1000, base)
+	buy.Fee = 20
+	sell := tx(models.TransactionTypeSell, "ethereum", 1, 1500, base.AddDate(0, 1, 0))
+	sell.Fee = 10
+
+	bases, err := ComputeCostBasis([]models.Transaction{buy, sell}, models.CostBasisFIFO)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := bases["ethereum"].Disposals[0]
+	if !almostEqual(d.CostBasis, 1010) {
+		t.Errorf("basis: got %.2f, want 1010", d.CostBasis)
+	}
+	if !almostEqual(d.Proceeds, 1490) {
+		t.Errorf("proceeds: got %.2f, want 1490", d.Proceeds)
+	}
+}
+
+func TestComputeCostBasis_InvalidMethod(t *testing.T) {
+	_, err := ComputeCostBasis(costBasisLedger(), "random")
+	if !errors.Is(err, customerrors.ErrInvalidCostBasisMethod) {
+		t.Errorf("expected ErrInvalidCostBasisMethod, got: %v", err)
+	}
+}
+
+func TestBuildProfitLossReport_RealizedAndUnrealized(t *testing.T) {
+	bases, err := ComputeCostBasis(costBasisLedger(), models.CostBasisFIFO)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	report, err := BuildProfitLossReport(bases, map[string]float64{"bitcoin": 500}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(report.Coins) != 1 {
+		t.Fatalf("got %d coins, want 1", len(report.Coins))
+	}
+
+	c := report.Coins[0]
+	if !almostEqual(c.Realized, 350) {
+		t.Errorf("realized: got %.2f, want 350", c.Realized)
+	}
+	if !almostEqual(c.RealizedPercent, 140) {
+		t.Errorf("realized %%: got %.2f, want 140", c.RealizedPercent)
+	}
+	if !almostEqual(c.MarketValue, 750) {
+		t.Errorf("market value: got %.2f, want 750", c.MarketValue)
+	}
+	if !almostEqual(c.Unrealized, 400) {
+		t.Errorf("unrealized: got %.2f, want 400", c.Unrealized)
+	}
+	if !almostEqual(report.Total, 750) {
+		t.Errorf("total: got %.2f, want 750", report.Total)
+	}
+	if c.HoldingPeriod <= 0 || c.RealizedHoldingPeriod <= 0 {
+		t.Errorf("holding periods should be positive, got %v and %v", c.HoldingPeriod, c.RealizedHoldingPeriod)
+	}
+}
+
+func TestBuildProfitLossReport_MissingPrice(t *testing.T) {
+	bases, err := ComputeCostBasis(costBasisLedger(), models.CostBasisFIFO)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = BuildProfitLossReport(bases, map[string]float64{}, time.Now())
+	if !errors.Is(err, customerrors.ErrPriceNotAvailable) {
+		t.Errorf("expected ErrPriceNotAvailable, got: %v", err)
+	}
+}
+
+func TestBuildTaxReport_SplitsLotsByTerm(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	txs := []models.Transaction{
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 100, base),
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 300, base.AddDate(1, 0, 0)),
+		tx(models.TransactionTypeSell, "bitcoin", 2, 400, base.AddDate(1, 3, 0)),
+		tx(models.TransactionTypeBuy, "ethereum", 1, 50, base),
+		tx(models.TransactionTypeSell, "ethereum", 1, 80, base.AddDate(0, 6, 0)),
+	}
+
+	bases, err := ComputeCostBasis(txs, models.CostBasisFIFO)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows := BuildTaxReport(bases, 2024, DefaultLongTermThreshold)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2 (ethereum sale is in 2023)", len(rows))
+	}
+	if rows[0].Term != TaxTermLong || !almostEqual(rows[0].Gain, 300) {
+		t.Errorf("first lot: got %s gain %.2f, want long gain 300", rows[0].Term, rows[0].Gain)
+	}
+	if rows[1].Term != TaxTermShort || !almostEqual(rows[1].Gain, 100) {
+		t.Errorf("second lot: got %s gain %.2f, want short gain 100", rows[1].Term, rows[1].Gain)
+	}
+
+	var buf strings.Builder
+	if err := WriteTaxReportCSV(&buf, rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "coin_id,coin_name,quantity,date_acquired,date_sold,currency,proceeds,cost_basis,gain,term\n" +
+		"bitcoin,bitcoin,1,2023-01-01,2024-04-01,USD,400.00,100.00,300.00,long\n" +
+		"bitcoin,bitcoin,1,2024-01-01,2024-04-01,USD,400.00,300.00,100.00,short\n"
+	if buf.String() != want {
+		t.Errorf("csv:\n  got:  %q\n  want: %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,214 @@
+package portfolio
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// quantityEpsilon absorbs float rounding when a sale empties a position.
+const quantityEpsilon = 1e-9
+
+func validateTransaction(tx *models.Transaction) error {
+	// CoinGecko IDs are always lowercase (e.g. "bitcoin", not "Bitcoin").
+	tx.CoinID = strings.ToLower(strings.TrimSpace(tx.CoinID))
+	tx.CoinName = strings.TrimSpace(tx.CoinName)
+
+	if !tx.Type.Valid() {
+		return customerrors.NewValidationError("type", tx.Type, customerrors.ErrInvalidTransaction)
+	}
+	if tx.CoinID == "" {
+		return customerrors.NewValidationError("coin_id", tx.CoinID, customerrors.ErrInvalidTransaction)
+	}
+	if tx.Quantity <= 0 {
+		return customerrors.NewValidationError("quantity", tx.Quantity, customerrors.ErrInvalidQuantity)
+	}
+	if tx.Price < 0 || ((tx.Type == models.TransactionTypeBuy || tx.Type == models.TransactionTypeSell) && tx.Price == 0) {
+		return customerrors.NewValidationError("price", tx.Price, customerrors.ErrInvalidPrice)
+	}
+	if tx.Fee < 0 {
+		return customerrors.NewValidationError("fee", tx.Fee, customerrors.ErrInvalidPrice)
+	}
+	code, err := currency.Normalize(tx.Currency)
+	if err != nil {
+		return err
+	}
+	tx.Currency = code
+	return nil
+}
+
+func sortTransactions(txs []models.Transaction) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].ExecutedAt.Before(txs[j].ExecutedAt)
+	})
+}
+
+// DeriveHoldings replays the ledger and returns the open position per coin,
+// with BuyPrice set to the remaining cost basis per coin under the method.
+func DeriveHoldings(txs []models.Transaction, method models.CostBasisMethod) ([]models.Holding, error) {
+	bases, err := ComputeCostBasis(txs, method)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]models.Transaction, len(txs))
+	copy(sorted, txs)
+	sortTransactions(sorted)
+
+	seen := make(map[string]bool, len(bases))
+	holdings := make([]models.Holding, 0, len(bases))
+	for _, tx := range sorted {
+		if seen[tx.CoinID] {
+			continue
+		}
+		seen[tx.CoinID] = true
+
+		cb := bases[tx.CoinID]
+		qty := cb.RemainingQuantity()
+		if qty <= quantityEpsilon {
+			continue
+		}
+
+		addedAt := cb.Lots[0].AcquiredAt
+		for _, l := range cb.Lots[1:] {
+			if l.AcquiredAt.Before(addedAt) {
+				addedAt = l.AcquiredAt
+			}
+		}
+
+		holdings = append(holdings, models.Holding{
+			CoinID:   cb.CoinID,
+			CoinName: cb.CoinName,
+			Quantity: qty,
+			BuyPrice: cb.RemainingBasis() / qty,
+			Currency: cb.Currency,
+			AddedAt:  addedAt,
+		})
+	}
+
+	return holdings, nil
+}
+
+// legacyTransactions turns holdings stored before the ledger existed into the
+// buy entries that would have produced them.
+func legacyTransactions(p *models.Portfolio) []models.Transaction {
+	txs := make([]models.Transaction, 0, len(p.Holdings))
+	for _, h := range p.Holdings {
+		executedAt := h.AddedAt
+		if executedAt.IsZero() {
+			executedAt = p.UpdatedAt
+		}
+		txs = append(txs, models.Transaction{
+			ID:         primitive.NewObjectID().Hex(),
+			UserEmail:  p.UserEmail,
+			CoinID:     h.CoinID,
+			CoinName:   h.CoinName,
+			Type:       models.TransactionTypeBuy,
+			Quantity:   h.Quantity,
+			Price:      h.BuyPrice,
+			Currency:   currency.OrDefault(h.Currency),
+			Note:       "migrated from holdings",
+			ExecutedAt: executedAt,
+			CreatedAt:  time.Now(),
+		})
+	}
+	return txs
+}
+
+func RecordTransactions(ctx context.Context, store db.Store, userEmail string, txs ...models.Transaction) error {
+	if len(txs) == 0 {
+		return customerrors.ErrEmptyHoldings
+	}
+
+	now := time.Now()
+	for i := range txs {
+		if err := validateTransaction(&txs[i]); err != nil {
+			return err
+		}
+		txs[i].ID = primitive.NewObjectID().Hex()
+		txs[i].UserEmail = userEmail
+		txs[i].CreatedAt = now
+		if txs[i].ExecutedAt.IsZero() {
+			txs[i].ExecutedAt = now
+		}
+	}
+
+	ledger, err := store.Transactions().List(ctx, userEmail)
+	if err != nil {
+		return err
+	}
+
+	p, err := GetPortfolio(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+
+	toInsert := txs
+	if len(ledger) == 0 {
+		migrated := legacyTransactions(p)
+		ledger = append(ledger, migrated...)
+		toInsert = append(migrated, txs...)
+	}
+	ledger = append(ledger, txs...)
+
+	holdings, err := DeriveHoldings(ledger, p.Method())
+	if err != nil {
+		return err
+	}
+
+	if err := store.Transactions().Insert(ctx, toInsert...); err != nil {
+		return err
+	}
+
+	p.Holdings = holdings
+	p.UpdatedAt = time.Now()
+	return store.Portfolios().Save(ctx, p)
+}
+
+func GetTransactions(ctx context.Context, store db.Store, userEmail string, coinIDs ...string) ([]models.Transaction, error) {
+	return store.Transactions().List(ctx, userEmail, normalizeCoinIDs(coinIDs)...)
+}
+
+// normalizeCoinIDs returns coinIDs in the form validateTransaction stores,
+// leaving the caller's slice untouched.
+func normalizeCoinIDs(coinIDs []string) []string {
+	normalized := make([]string, len(coinIDs))
+	for i, id := range coinIDs {
+		normalized[i] = strings.ToLower(strings.TrimSpace(id))
+	}
+	return normalized
+}
+
+// CheckCurrency refuses code as userEmail's currency while their ledger holds
+// amounts in another one: recorded prices are never converted, so every
+// profit/loss figure would be refused afterwards.
+func CheckCurrency(ctx context.Context, store db.Store, userEmail, code string) error {
+	p, err := GetPortfolio(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+	txs, err := GetTransactions(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+	if len(txs) == 0 {
+		txs = legacyTransactions(p)
+	}
+
+	for _, tx := range txs {
+		if (tx.Price != 0 || tx.Fee != 0) && !currency.Equal(tx.Currency, code) {
+			return customerrors.NewValidationError("currency", code, fmt.Errorf(
+				"%w: transactions are recorded in %s", customerrors.ErrCurrencyMismatch, strings.ToUpper(currency.OrDefault(tx.Currency)),
+			))
+		}
+	}
+	return nil
+}
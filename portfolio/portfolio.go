@@ -3,17 +3,15 @@ package portfolio
 import (
 	"context"
 	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
 	"crypto-portfolio-tracker/db"
 	customerrors "crypto-portfolio-tracker/errors"
 	"crypto-portfolio-tracker/models"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type priceResult struct {
@@ -29,81 +27,42 @@ type holdingJob struct {
 	holding models.Holding
 }
 
-func AddMultipleHoldings(userEmail string, holdings ...models.Holding) error {
+func AddMultipleHoldings(ctx context.Context, store db.Store, userEmail string, holdings ...models.Holding) error {
 	if len(holdings) == 0 {
 		return customerrors.ErrEmptyHoldings
 	}
 
-	database, err := db.ConnectDatabase()
-	if err != nil {
-		return customerrors.NewDatabaseError("connect", "portfolios", err)
-	}
-
-	collection := database.Collection("portfolios")
-
-	for i := range holdings {
-		if holdings[i].Quantity <= 0 {
-			return customerrors.NewValidationError("quantity", holdings[i].Quantity, customerrors.ErrInvalidQuantity)
-		}
-		if holdings[i].BuyPrice <= 0 {
-			return customerrors.NewValidationError("buy_price", holdings[i].BuyPrice, customerrors.ErrInvalidPrice)
-		}
-		// CoinGecko IDs are always lowercase (e.g. "bitcoin", not "Bitcoin").
-		holdings[i].CoinID = strings.ToLower(strings.TrimSpace(holdings[i].CoinID))
-	}
-
+	txs := make([]models.Transaction, 0, len(holdings))
 	for _, h := range holdings {
-		h.AddedAt = time.Now()
-
-		// Try to increment quantity if the coin already exists in the portfolio.
-		filter := bson.M{"user_email": userEmail, "holdings.coin_id": h.CoinID}
-		update := bson.M{
-			"$inc": bson.M{"holdings.$.quantity": h.Quantity},
-			"$set": bson.M{"updated_at": time.Now()},
+		if h.Quantity <= 0 {
+			return customerrors.NewValidationError("quantity", h.Quantity, customerrors.ErrInvalidQuantity)
 		}
-
-		result, err := collection.UpdateOne(context.TODO(), filter, update)
-		if err != nil {
-			return customerrors.NewDatabaseError("update", "portfolios", err)
+		if h.BuyPrice <= 0 {
+			return customerrors.NewValidationError("buy_price", h.BuyPrice, customerrors.ErrInvalidPrice)
 		}
 
-		if result.MatchedCount == 0 {
-			// Coin not in portfolio yet — push a new entry.
-			filter = bson.M{"user_email": userEmail}
-			update = bson.M{
-				"$push": bson.M{"holdings": h},
-				"$set":  bson.M{"updated_at": time.Now()},
-			}
-			_, err = collection.UpdateOne(
-				context.TODO(),
-				filter,
-				update,
-				options.Update().SetUpsert(true),
-			)
-			if err != nil {
-				return customerrors.NewPortfolioError("add holding", h.CoinID, err)
-			}
-		}
+		// Every purchase becomes its own ledger entry so later buys keep their price.
+		txs = append(txs, models.Transaction{
+			CoinID:     h.CoinID,
+			CoinName:   h.CoinName,
+			Type:       models.TransactionTypeBuy,
+			Quantity:   h.Quantity,
+			Price:      h.BuyPrice,
+			Currency:   h.Currency,
+			ExecutedAt: h.AddedAt,
+		})
 	}
 
-	return nil
-}
-
-func GetPortfolio(userEmail string) (*models.Portfolio, error) {
-	database, err := db.ConnectDatabase()
-	if err != nil {
-		return nil, customerrors.NewDatabaseError("connect", "portfolios", err)
+	if err := RecordTransactions(ctx, store, userEmail, txs...); err != nil {
+		return customerrors.NewPortfolioError("add holding", "", err)
 	}
 
-	var portfolio models.Portfolio
-	collection := database.Collection("portfolios")
-
-	err = collection.FindOne(
-		context.TODO(),
-		bson.M{"user_email": userEmail},
-	).Decode(&portfolio)
+	return nil
+}
 
-	if err == mongo.ErrNoDocuments {
+func GetPortfolio(ctx context.Context, store db.Store, userEmail string) (*models.Portfolio, error) {
+	portfolio, err := store.Portfolios().Get(ctx, userEmail)
+	if errors.Is(err, customerrors.ErrNotFound) {
 		return &models.Portfolio{
 			UserEmail: userEmail,
 			Holdings:  []models.Holding{},
@@ -112,10 +71,10 @@ func GetPortfolio(userEmail string) (*models.Portfolio, error) {
 	}
 
 	if err != nil {
-		return nil, customerrors.NewDatabaseError("fetch", "portfolios", err)
+		return nil, err
 	}
 
-	return &portfolio, nil
+	return portfolio, nil
 }
 
 func streamHoldings(holdings []models.Holding, jobsCh chan<- holdingJob, done <-chan struct{}) {
@@ -165,7 +124,10 @@ func priceWorker(
 	}
 }
 
+// runPricePipeline stops its stage goroutines when cancel is called or ctx is
+// done, whichever happens first.
 func runPricePipeline(
+	ctx context.Context,
 	holdings []models.Holding,
 	prices map[string]float64,
 	apiClient api.CryptoApi,
@@ -175,13 +137,18 @@ func runPricePipeline(
 	resultCh := make(chan priceResult, len(holdings))
 	done := make(chan struct{})
 
+	var once sync.Once
 	cancel := func() {
+		once.Do(func() { close(done) })
+	}
+
+	go func() {
 		select {
+		case <-ctx.Done():
+			cancel()
 		case <-done:
-		default:
-			close(done)
 		}
-	}
+	}()
 
 	go streamHoldings(holdings, jobsCh, done)
 
@@ -199,7 +166,7 @@ func runPricePipeline(
 	return resultCh, cancel
 }
 
-func CalculateTotalValue(portfolio *models.Portfolio, apiClient api.CryptoApi) (float64, error) {
+func CalculateTotalValue(ctx context.Context, portfolio *models.Portfolio, apiClient api.CryptoApi, vsCurrency string) (float64, error) {
 	if len(portfolio.Holdings) == 0 {
 		return 0, nil
 	}
@@ -209,13 +176,13 @@ func CalculateTotalValue(portfolio *models.Portfolio, apiClient api.CryptoApi) (
 		coinIDs[i] = h.CoinID
 	}
 
-	prices, err := apiClient.FetchMultiplePrices(coinIDs...)
+	prices, err := apiClient.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
 	if err != nil {
 		return 0, customerrors.NewPortfolioError("calculate total value", "", err)
 	}
 
 	numWorkers := len(portfolio.Holdings)
-	resultCh, cancel := runPricePipeline(portfolio.Holdings, prices, apiClient, numWorkers)
+	resultCh, cancel := runPricePipeline(ctx, portfolio.Holdings, prices, apiClient, numWorkers)
 	defer cancel()
 
 	var total float64
@@ -226,11 +193,14 @@ func CalculateTotalValue(portfolio *models.Portfolio, apiClient api.CryptoApi) (
 		}
 		total += r.price * r.quantity
 	}
+	if err := ctx.Err(); err != nil {
+		return 0, customerrors.NewPortfolioError("calculate total value", "", err)
+	}
 
 	return total, nil
 }
 
-func CalculateProfitLoss(portfolio *models.Portfolio, apiClient api.CryptoApi, coinIDs ...string) (map[string]float64, error) {
+func CalculateProfitLoss(ctx context.Context, portfolio *models.Portfolio, apiClient api.CryptoApi, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
 	if len(coinIDs) == 0 {
 		for _, h := range portfolio.Holdings {
 			coinIDs = append(coinIDs, h.CoinID)
@@ -249,11 +219,14 @@ func CalculateProfitLoss(portfolio *models.Portfolio, apiClient api.CryptoApi, c
 	requested := make([]models.Holding, 0, len(coinIDs))
 	for _, id := range coinIDs {
 		if h, ok := holdingsMap[id]; ok {
+			if err := checkCurrency(h, vsCurrency); err != nil {
+				return nil, err
+			}
 			requested = append(requested, h)
 		}
 	}
 
-	prices, err := apiClient.FetchMultiplePrices(coinIDs...)
+	prices, err := apiClient.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
 	if err != nil {
 		return nil, customerrors.NewPortfolioError("calculate profit/loss", "", err)
 	}
@@ -263,7 +236,7 @@ func CalculateProfitLoss(portfolio *models.Portfolio, apiClient api.CryptoApi, c
 		return map[string]float64{}, nil
 	}
 
-	resultCh, cancel := runPricePipeline(requested, prices, apiClient, numWorkers)
+	resultCh, cancel := runPricePipeline(ctx, requested, prices, apiClient, numWorkers)
 	defer cancel()
 
 	profitLoss := make(map[string]float64, len(requested))
@@ -276,12 +249,64 @@ func CalculateProfitLoss(portfolio *models.Portfolio, apiClient api.CryptoApi, c
 		current := r.price * r.quantity
 		profitLoss[r.coinID] = current - invested
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, customerrors.NewPortfolioError("calculate profit/loss", "", err)
+	}
 
 	return profitLoss, nil
 }
 
-func DisplayPortfolio(userEmail string, apiClient api.CryptoApi) error {
-	portfolio, err := GetPortfolio(userEmail)
+// checkCurrency refuses to compare h's buy price with prices in vsCurrency
+// when it was bought in another currency.
+func checkCurrency(h models.Holding, vsCurrency string) error {
+	if currency.Equal(h.Currency, vsCurrency) {
+		return nil
+	}
+	return customerrors.NewPortfolioError("calculate profit/loss", h.CoinID, fmt.Errorf(
+		"%w: bought in %s, priced in %s", customerrors.ErrCurrencyMismatch,
+		strings.ToUpper(currency.OrDefault(h.Currency)), strings.ToUpper(currency.OrDefault(vsCurrency)),
+	))
+}
+
+// fetchQuotes fetches prices, along with their sources when apiClient
+// reports them.
+func fetchQuotes(ctx context.Context, apiClient api.CryptoApi, vsCurrency string, coinIDs []string) (map[string]float64, map[string]api.Quote, error) {
+	qa, ok := apiClient.(api.QuoteApi)
+	if !ok {
+		prices, err := apiClient.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
+		return prices, nil, err
+	}
+
+	quotes, err := qa.FetchQuotes(ctx, vsCurrency, coinIDs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	prices := make(map[string]float64, len(quotes))
+	for id, q := range quotes {
+		prices[id] = q.Price
+	}
+	return prices, quotes, nil
+}
+
+func printPriceSources(q api.Quote, vsCurrency string) {
+	quoted := func(names []string) string {
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprintf("%s %s", name, currency.Format(q.Prices[name], vsCurrency))
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	if q.Contested {
+		fmt.Printf("  Price Sources : disagree (%s), showing the median\n", quoted(q.Sources))
+		return
+	}
+	fmt.Printf("  Price Sources : %s\n", strings.Join(q.Sources, ", "))
+	fmt.Printf("  Ignored       : %s\n", quoted(q.Rejected))
+}
+
+func DisplayPortfolio(ctx context.Context, store db.Store, userEmail string, apiClient api.CryptoApi, vsCurrency string) error {
+	portfolio, err := GetPortfolio(ctx, store, userEmail)
 	if err != nil {
 		return customerrors.NewPortfolioError("display portfolio", "", err)
 	}
@@ -295,13 +320,13 @@ func DisplayPortfolio(userEmail string, apiClient api.CryptoApi) error {
 	for i, h := range portfolio.Holdings {
 		coinIDs[i] = h.CoinID
 	}
-	prices, err := apiClient.FetchMultiplePrices(coinIDs...)
+	prices, quotes, err := fetchQuotes(ctx, apiClient, vsCurrency, coinIDs)
 	if err != nil {
 		return customerrors.NewPortfolioError("display portfolio", "", err)
 	}
 
 	numWorkers := len(portfolio.Holdings)
-	resultCh, cancel := runPricePipeline(portfolio.Holdings, prices, apiClient, numWorkers)
+	resultCh, cancel := runPricePipeline(ctx, portfolio.Holdings, prices, apiClient, numWorkers)
 	defer cancel()
 
 	resultMap := make(map[string]priceResult, len(portfolio.Holdings))
@@ -312,6 +337,9 @@ func DisplayPortfolio(userEmail string, apiClient api.CryptoApi) error {
 		}
 		resultMap[r.coinID] = r
 	}
+	if err := ctx.Err(); err != nil {
+		return customerrors.NewPortfolioError("display portfolio", "", err)
+	}
 
 	fmt.Println("\n========== YOUR PORTFOLIO ==========")
 
@@ -324,21 +352,28 @@ func DisplayPortfolio(userEmail string, apiClient api.CryptoApi) error {
 		}
 
 		currentValue := r.price * r.quantity
-		invested := r.buyPrice * r.quantity
-		profitLoss := currentValue - invested
-		profitLossPercent := (profitLoss / invested) * 100
 		totalValue += currentValue
 
 		fmt.Printf("\nCoin: %s (%s)\n", h.CoinName, h.CoinID)
 		fmt.Printf("  Quantity      : %.4f\n", h.Quantity)
-		fmt.Printf("  Buy Price     : $%.2f\n", h.BuyPrice)
-		fmt.Printf("  Current Price : $%.2f\n", r.price)
-		fmt.Printf("  Current Value : $%.2f\n", currentValue)
-		fmt.Printf("  Profit/Loss   : $%.2f (%.2f%%)\n", profitLoss, profitLossPercent)
+		fmt.Printf("  Buy Price     : %s\n", currency.Format(h.BuyPrice, currency.OrDefault(h.Currency)))
+		fmt.Printf("  Current Price : %s\n", currency.Format(r.price, vsCurrency))
+		fmt.Printf("  Current Value : %s\n", currency.Format(currentValue, vsCurrency))
+		if currency.Equal(h.Currency, vsCurrency) {
+			invested := r.buyPrice * r.quantity
+			profitLoss := currentValue - invested
+			profitLossPercent := (profitLoss / invested) * 100
+			fmt.Printf("  Profit/Loss   : %s (%.2f%%)\n", currency.Format(profitLoss, vsCurrency), profitLossPercent)
+		} else {
+			fmt.Printf("  Profit/Loss   : n/a (bought in %s)\n", strings.ToUpper(currency.OrDefault(h.Currency)))
+		}
+		if q, ok := quotes[h.CoinID]; ok && q.Disagree() {
+			printPriceSources(q, vsCurrency)
+		}
 	}
 
 	fmt.Printf("\n====================================\n")
-	fmt.Printf("Total Portfolio Value: $%.2f\n", totalValue)
+	fmt.Printf("Total Portfolio Value: %s\n", currency.Format(totalValue, vsCurrency))
 	fmt.Printf("====================================\n\n")
 
 	return nil
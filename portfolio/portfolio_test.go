@@ -1,6 +1,8 @@
 package portfolio
 
 import (
+	"context"
+	"crypto-portfolio-tracker/db"
 	customerrors "crypto-portfolio-tracker/errors"
 	"crypto-portfolio-tracker/models"
 	"errors"
@@ -14,7 +16,7 @@ type mockAPI struct {
 	err    error
 }
 
-func (m *mockAPI) FetchPrice(coinID string) (float64, error) {
+func (m *mockAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
 	if m.err != nil {
 		return 0, m.err
 	}
@@ -25,7 +27,7 @@ func (m *mockAPI) FetchPrice(coinID string) (float64, error) {
 	return p, nil
 }
 
-func (m *mockAPI) FetchMultiplePrices(coinIDs ...string) (map[string]float64, error) {
+func (m *mockAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -38,7 +40,7 @@ func (m *mockAPI) FetchMultiplePrices(coinIDs ...string) (map[string]float64, er
 	return result, nil
 }
 
-func (m *mockAPI) GetSupportedCoins() (map[string]string, error) {
+func (m *mockAPI) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
 	return map[string]string{"bitcoin": "Bitcoin", "ethereum": "Ethereum"}, nil
 }
 
@@ -47,14 +49,27 @@ type slowMockAPI struct {
 	delay time.Duration
 }
 
-func (s *slowMockAPI) FetchPrice(coinID string) (float64, error) {
-	time.Sleep(s.delay)
-	return s.mockAPI.FetchPrice(coinID)
+func (s *slowMockAPI) wait(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (s *slowMockAPI) FetchMultiplePrices(coinIDs ...string) (map[string]float64, error) {
-	time.Sleep(s.delay)
-	return s.mockAPI.FetchMultiplePrices(coinIDs...)
+func (s *slowMockAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	if err := s.wait(ctx); err != nil {
+		return 0, err
+	}
+	return s.mockAPI.FetchPrice(ctx, coinID, vsCurrency)
+}
+
+func (s *slowMockAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.mockAPI.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
 }
 
 func makePortfolio(holdings ...models.Holding) *models.Portfolio {
@@ -79,7 +94,7 @@ func TestCalculateTotalValue_SingleHolding(t *testing.T) {
 	p := makePortfolio(holding("bitcoin", "Bitcoin", 2, 30000))
 	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
 
-	total, err := CalculateTotalValue(p, api)
+	total, err := CalculateTotalValue(context.Background(), p, api, "usd")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -98,7 +113,7 @@ func TestCalculateTotalValue_MultipleHoldings(t *testing.T) {
 		"ethereum": 3000,
 	}}
 
-	total, err := CalculateTotalValue(p, api)
+	total, err := CalculateTotalValue(context.Background(), p, api, "usd")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -111,7 +126,7 @@ func TestCalculateTotalValue_EmptyPortfolio(t *testing.T) {
 	p := makePortfolio()
 	api := &mockAPI{prices: map[string]float64{}}
 
-	total, err := CalculateTotalValue(p, api)
+	total, err := CalculateTotalValue(context.Background(), p, api, "usd")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -124,7 +139,7 @@ func TestCalculateTotalValue_APIError(t *testing.T) {
 	p := makePortfolio(holding("bitcoin", "Bitcoin", 1, 30000))
 	api := &mockAPI{err: customerrors.ErrRateLimitExceeded}
 
-	_, err := CalculateTotalValue(p, api)
+	_, err := CalculateTotalValue(context.Background(), p, api, "usd")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -137,7 +152,7 @@ func TestCalculateTotalValue_MissingPrice(t *testing.T) {
 	p := makePortfolio(holding("solana", "Solana", 5, 100))
 	api := &mockAPI{prices: map[string]float64{"bitcoin": 60000}}
 
-	_, err := CalculateTotalValue(p, api)
+	_, err := CalculateTotalValue(context.Background(), p, api, "usd")
 	if err == nil {
 		t.Fatal("expected error for missing price, got nil")
 	}
@@ -150,7 +165,7 @@ func TestCalculateProfitLoss_Profit(t *testing.T) {
 	p := makePortfolio(holding("bitcoin", "Bitcoin", 1, 30000))
 	api := &mockAPI{prices: map[string]float64{"bitcoin": 60000}}
 
-	pl, err := CalculateProfitLoss(p, api)
+	pl, err := CalculateProfitLoss(context.Background(), p, api, "usd")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -163,7 +178,7 @@ func TestCalculateProfitLoss_Loss(t *testing.T) {
 	p := makePortfolio(holding("ethereum", "Ethereum", 2, 3000))
 	api := &mockAPI{prices: map[string]float64{"ethereum": 1500}}
 
-	pl, err := CalculateProfitLoss(p, api)
+	pl, err := CalculateProfitLoss(context.Background(), p, api, "usd")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -182,7 +197,7 @@ func TestCalculateProfitLoss_MultipleCoins(t *testing.T) {
 		"ethereum": 2000,
 	}}
 
-	pl, err := CalculateProfitLoss(p, api)
+	pl, err := CalculateProfitLoss(context.Background(), p, api, "usd")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -204,7 +219,7 @@ func TestCalculateProfitLoss_SpecificCoins(t *testing.T) {
 		"ethereum": 3000,
 	}}
 
-	pl, err := CalculateProfitLoss(p, api, "bitcoin")
+	pl, err := CalculateProfitLoss(context.Background(), p, api, "usd", "bitcoin")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -220,7 +235,7 @@ func TestCalculateProfitLoss_EmptyPortfolio(t *testing.T) {
 	p := makePortfolio()
 	api := &mockAPI{prices: map[string]float64{}}
 
-	_, err := CalculateProfitLoss(p, api)
+	_, err := CalculateProfitLoss(context.Background(), p, api, "usd")
 	if err == nil {
 		t.Fatal("expected ErrEmptyPortfolio, got nil")
 	}
@@ -233,7 +248,7 @@ func TestCalculateProfitLoss_APIError(t *testing.T) {
 	p := makePortfolio(holding("bitcoin", "Bitcoin", 1, 30000))
 	api := &mockAPI{err: customerrors.ErrRateLimitExceeded}
 
-	_, err := CalculateProfitLoss(p, api)
+	_, err := CalculateProfitLoss(context.Background(), p, api, "usd")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -249,7 +264,7 @@ func TestCalculateProfitLoss_CoinNotInPortfolio(t *testing.T) {
 		"solana":  100,
 	}}
 
-	pl, err := CalculateProfitLoss(p, api, "bitcoin", "solana")
+	pl, err := CalculateProfitLoss(context.Background(), p, api, "usd", "bitcoin", "solana")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -261,6 +276,21 @@ func TestCalculateProfitLoss_CoinNotInPortfolio(t *testing.T) {
 	}
 }
 
+func TestCalculateProfitLoss_RefusesOtherCurrency(t *testing.T) {
+	h := holding("bitcoin", "Bitcoin", 1, 30000)
+	h.Currency = "eur"
+	p := makePortfolio(h)
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 50000}}
+
+	if _, err := CalculateProfitLoss(context.Background(), p, api, "usd"); !errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch, got: %v", err)
+	}
+	pl, err := CalculateProfitLoss(context.Background(), p, api, "EUR")
+	if err != nil || pl["bitcoin"] != 20000 {
+		t.Errorf("expected 20000 P/L in EUR, got %v (%v)", pl, err)
+	}
+}
+
 func TestPortfolioError_Wrapping(t *testing.T) {
 	wrapped := customerrors.NewPortfolioError("fetch", "bitcoin", customerrors.ErrPriceNotAvailable)
 	if !errors.Is(wrapped, customerrors.ErrPriceNotAvailable) {
@@ -472,7 +502,7 @@ func TestPipeline_RunPricePipeline_CorrectResults(t *testing.T) {
 	}
 	api := &mockAPI{prices: prices}
 
-	resultCh, cancel := runPricePipeline(holdings, prices, api, 3)
+	resultCh, cancel := runPricePipeline(context.Background(), holdings, prices, api, 3)
 	defer cancel()
 
 	results := make(map[string]priceResult)
@@ -505,7 +535,7 @@ func TestPipeline_CancelStopsPipeline(t *testing.T) {
 	prices := map[string]float64{"bitcoin": 60000}
 	api := &mockAPI{prices: prices}
 
-	resultCh, cancel := runPricePipeline(holdings, prices, api, 2)
+	resultCh, cancel := runPricePipeline(context.Background(), holdings, prices, api, 2)
 
 	cancel()
 
@@ -539,7 +569,7 @@ func TestCalculateTotalValue_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			total, err := CalculateTotalValue(p, api)
+			total, err := CalculateTotalValue(context.Background(), p, api, "usd")
 			if err != nil {
 				errs <- err
 				return
@@ -587,7 +617,7 @@ func TestCalculateProfitLoss_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			pl, err := CalculateProfitLoss(p, api)
+			pl, err := CalculateProfitLoss(context.Background(), p, api, "usd")
 			ch <- plResult{pl, err}
 		}()
 	}
@@ -621,7 +651,7 @@ func TestCalculateTotalValue_ConcurrentWithError(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_, err := CalculateTotalValue(p, api)
+			_, err := CalculateTotalValue(context.Background(), p, api, "usd")
 			errs <- err
 		}()
 	}
@@ -638,3 +668,219 @@ func TestCalculateTotalValue_ConcurrentWithError(t *testing.T) {
 		}
 	}
 }
+
+func tx(txType models.TransactionType, coinID string, qty, price float64, at time.Time) models.Transaction {
+	return models.Transaction{
+		CoinID:     coinID,
+		CoinName:   coinID,
+		Type:       txType,
+		Quantity:   qty,
+		Price:      price,
+		ExecutedAt: at,
+	}
+}
+
+func TestDeriveHoldings_BuysKeepTheirPrice(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	holdings, err := DeriveHoldings([]models.Transaction{
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 30000, base),
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 50000, base.AddDate(0, 1, 0)),
+	}, models.CostBasisFIFO)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(holdings) != 1 {
+		t.Fatalf("got %d holdings, want 1", len(holdings))
+	}
+	if holdings[0].Quantity != 2 {
+		t.Errorf("quantity: got %.4f, want 2", holdings[0].Quantity)
+	}
+	if holdings[0].BuyPrice != 40000 {
+		t.Errorf("buy price: got %.2f, want 40000", holdings[0].BuyPrice)
+	}
+	if !holdings[0].AddedAt.Equal(base) {
+		t.Errorf("added at: got %v, want %v", holdings[0].AddedAt, base)
+	}
+}
+
+func TestDeriveHoldings_SellReducesPosition(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	holdings, err := DeriveHoldings([]models.Transaction{
+		tx(models.TransactionTypeSell, "ethereum", 1, 3000, base.AddDate(0, 2, 0)),
+		tx(models.TransactionTypeBuy, "ethereum", 4, 2000, base),
+		tx(models.TransactionTypeTransferOut, "ethereum", 1, 0, base.AddDate(0, 3, 0)),
+		tx(models.TransactionTypeBuy, "solana", 1, 100, base),
+		tx(models.TransactionTypeSell, "solana", 1, 150, base.AddDate(0, 1, 0)),
+	}, models.CostBasisFIFO)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(holdings) != 1 || holdings[0].CoinID != "ethereum" {
+		t.Fatalf("got %+v, want only ethereum", holdings)
+	}
+	if holdings[0].Quantity != 2 {
+		t.Errorf("quantity: got %.4f, want 2", holdings[0].Quantity)
+	}
+	if holdings[0].BuyPrice != 2000 {
+		t.Errorf("buy price: got %.2f, want 2000", holdings[0].BuyPrice)
+	}
+}
+
+func TestDeriveHoldings_Oversell(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	_, err := DeriveHoldings([]models.Transaction{
+		tx(models.TransactionTypeBuy, "bitcoin", 1, 30000, base),
+		tx(models.TransactionTypeSell, "bitcoin", 2, 40000, base.AddDate(0, 1, 0)),
+	}, models.CostBasisFIFO)
+	if !errors.Is(err, customerrors.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got: %v", err)
+	}
+}
+
+func TestAddMultipleHoldings_MemoryStore(t *testing.T) {
+	store := db.NewMemoryStore()
+	user := "test@example.com"
+
+	if err := AddMultipleHoldings(context.Background(), store, user,
+		holding("Bitcoin", "Bitcoin", 1, 30000),
+		holding("bitcoin", "Bitcoin", 1, 50000),
+	); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RecordTransactions(context.Background(), store, user, tx(models.TransactionTypeSell, "bitcoin", 0.5, 60000, time.Now())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := GetPortfolio(context.Background(), store, user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Holdings) != 1 {
+		t.Fatalf("got %d holdings, want 1", len(p.Holdings))
+	}
+	if p.Holdings[0].Quantity != 1.5 {
+		t.Errorf("quantity: got %.4f, want 1.5", p.Holdings[0].Quantity)
+	}
+
+	txs, err := GetTransactions(context.Background(), store, user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(txs) != 3 {
+		t.Errorf("got %d transactions, want 3", len(txs))
+	}
+}
+
+func TestRecordTransactions_MigratesLegacyHoldings(t *testing.T) {
+	store := db.NewMemoryStore()
+	legacy := makePortfolio(holding("ethereum", "Ethereum", 2, 2000))
+	if err := store.Portfolios().Save(context.Background(), legacy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := RecordTransactions(context.Background(), store, legacy.UserEmail, tx(models.TransactionTypeSell, "ethereum", 1, 3000, time.Now()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := GetPortfolio(context.Background(), store, legacy.UserEmail)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Holdings) != 1 || p.Holdings[0].Quantity != 1 || p.Holdings[0].BuyPrice != 2000 {
+		t.Errorf("got %+v, want 1 ethereum at 2000", p.Holdings)
+	}
+}
+
+func TestGetCostBasis_LegacyHoldingsNormalizesCoinIDs(t *testing.T) {
+	store := db.NewMemoryStore()
+	legacy := makePortfolio(holding("ethereum", "Ethereum", 2, 2000), holding("bitcoin", "Bitcoin", 1, 30000))
+	if err := store.Portfolios().Save(context.Background(), legacy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bases, err := GetCostBasis(context.Background(), store, legacy.UserEmail, " Bitcoin ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bases) != 1 || bases["bitcoin"] == nil || bases["bitcoin"].RemainingBasis() != 30000 {
+		t.Errorf("expected bitcoin's basis only, got %+v", bases)
+	}
+
+	txs := legacyTransactions(legacy)
+	filterTransactions(txs, "bitcoin")
+	if txs[0].CoinID != "ethereum" {
+		t.Errorf("expected the caller's slice to be left alone, got %+v", txs)
+	}
+}
+
+func TestRecordTransactions_RefusesMixedCurrencies(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+	user := "test@example.com"
+
+	h := holding("bitcoin", "Bitcoin", 2, 30000)
+	h.Currency = "eur"
+	if err := AddMultipleHoldings(ctx, store, user, h); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buy := tx(models.TransactionTypeBuy, "bitcoin", 1, 50000, time.Now())
+	buy.Currency = "usd"
+	if err := RecordTransactions(ctx, store, user, buy); !errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch for a USD buy of EUR bitcoin, got: %v", err)
+	}
+	// Entries without an amount fit any currency.
+	out := tx(models.TransactionTypeTransferOut, "bitcoin", 1, 0, time.Now())
+	out.Currency = "usd"
+	if err := RecordTransactions(ctx, store, user, out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := GetPortfolio(ctx, store, user)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Holdings) != 1 || p.Holdings[0].Currency != "eur" || p.Holdings[0].Quantity != 1 {
+		t.Errorf("got %+v, want 1 bitcoin bought in EUR", p.Holdings)
+	}
+
+	api := &mockAPI{prices: map[string]float64{"bitcoin": 40000}}
+	if _, err := GenerateProfitLossReport(ctx, store, user, api, "usd"); !errors.Is(err, customerrors.ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch for a USD report, got: %v", err)
+	}
+	report, err := GenerateProfitLossReport(ctx, store, user, api, "eur")
+	if err != nil || !almostEqual(report.TotalUnrealized, 10000) {
+		t.Errorf("expected 10000 unrealized in EUR, got %+v (%v)", report, err)
+	}
+}
+
+func TestGetPortfolio_MissingReturnsEmpty(t *testing.T) {
+	p, err := GetPortfolio(context.Background(), db.NewMemoryStore(), "nobody@example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.Holdings) != 0 {
+		t.Errorf("expected empty portfolio, got %d holdings", len(p.Holdings))
+	}
+}
+
+func TestCalculateTotalValue_ContextCancelled(t *testing.T) {
+	api := &slowMockAPI{
+		mockAPI: mockAPI{prices: map[string]float64{"bitcoin": 50000}},
+		delay:   time.Second,
+	}
+	p := makePortfolio(holding("bitcoin", "Bitcoin", 1, 30000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := CalculateTotalValue(ctx, p, api, "usd")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("call did not honour the deadline, took %v", elapsed)
+	}
+}
@@ -0,0 +1,177 @@
+package portfolio
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type CoinProfitLoss struct {
+	CoinID       string
+	CoinName     string
+	Quantity     float64
+	CurrentPrice float64
+	MarketValue  float64
+	CostBasis    float64
+
+	Unrealized        float64
+	UnrealizedPercent float64
+
+	RealizedProceeds  float64
+	RealizedCostBasis float64
+	Realized          float64
+	RealizedPercent   float64
+
+	Total float64
+
+	// HoldingPeriod is the quantity-weighted age of the lots still held;
+	// RealizedHoldingPeriod is the same for the lots that were sold.
+	HoldingPeriod         time.Duration
+	RealizedHoldingPeriod time.Duration
+}
+
+type ProfitLossReport struct {
+	UserEmail   string
+	Currency    string
+	Method      models.CostBasisMethod
+	GeneratedAt time.Time
+	Coins       []CoinProfitLoss
+
+	TotalCostBasis         float64
+	TotalMarketValue       float64
+	TotalUnrealized        float64
+	TotalUnrealizedPercent float64
+	TotalRealizedCostBasis float64
+	TotalRealized          float64
+	TotalRealizedPercent   float64
+	Total                  float64
+}
+
+func percentOf(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole * 100
+}
+
+// BuildProfitLossReport splits each coin's result into realized gains from
+// recorded sales and unrealized gains on the lots still held at prices.
+func BuildProfitLossReport(bases map[string]*CostBasis, prices map[string]float64, now time.Time) (*ProfitLossReport, error) {
+	report := &ProfitLossReport{GeneratedAt: now}
+
+	for _, cb := range bases {
+		report.Method = cb.Method
+		c := CoinProfitLoss{
+			CoinID:    cb.CoinID,
+			CoinName:  cb.CoinName,
+			Quantity:  cb.RemainingQuantity(),
+			CostBasis: cb.RemainingBasis(),
+		}
+
+		if c.Quantity > quantityEpsilon {
+			price, ok := prices[cb.CoinID]
+			if !ok {
+				return nil, customerrors.NewPortfolioError("price lookup", cb.CoinID, customerrors.ErrPriceNotAvailable)
+			}
+			c.CurrentPrice = price
+			c.MarketValue = price * c.Quantity
+			c.Unrealized = c.MarketValue - c.CostBasis
+			c.UnrealizedPercent = percentOf(c.Unrealized, c.CostBasis)
+
+			var weighted float64
+			for _, l := range cb.Lots {
+				weighted += float64(now.Sub(l.AcquiredAt)) * l.Remaining
+			}
+			c.HoldingPeriod = time.Duration(weighted / c.Quantity)
+		}
+
+		var soldQty, soldWeighted float64
+		for _, d := range cb.Disposals {
+			if d.Type != models.TransactionTypeSell {
+				continue
+			}
+			c.RealizedProceeds += d.Proceeds
+			c.RealizedCostBasis += d.CostBasis
+			for _, m := range d.Matches {
+				soldQty += m.Quantity
+				soldWeighted += float64(d.DisposedAt.Sub(m.AcquiredAt)) * m.Quantity
+			}
+		}
+		c.Realized = c.RealizedProceeds - c.RealizedCostBasis
+		c.RealizedPercent = percentOf(c.Realized, c.RealizedCostBasis)
+		if soldQty > 0 {
+			c.RealizedHoldingPeriod = time.Duration(soldWeighted / soldQty)
+		}
+
+		c.Total = c.Unrealized + c.Realized
+
+		if c.Quantity <= quantityEpsilon && c.RealizedCostBasis == 0 {
+			continue
+		}
+
+		report.Coins = append(report.Coins, c)
+		report.TotalCostBasis += c.CostBasis
+		report.TotalMarketValue += c.MarketValue
+		report.TotalUnrealized += c.Unrealized
+		report.TotalRealizedCostBasis += c.RealizedCostBasis
+		report.TotalRealized += c.Realized
+	}
+
+	sort.Slice(report.Coins, func(i, j int) bool {
+		return report.Coins[i].CoinID < report.Coins[j].CoinID
+	})
+
+	report.TotalUnrealizedPercent = percentOf(report.TotalUnrealized, report.TotalCostBasis)
+	report.TotalRealizedPercent = percentOf(report.TotalRealized, report.TotalRealizedCostBasis)
+	report.Total = report.TotalUnrealized + report.TotalRealized
+
+	return report, nil
+}
+
+func GenerateProfitLossReport(ctx context.Context, store db.Store, userEmail string, apiClient api.CryptoApi, vsCurrency string, coinIDs ...string) (*ProfitLossReport, error) {
+	bases, err := GetCostBasis(ctx, store, userEmail, coinIDs...)
+	if err != nil {
+		return nil, customerrors.NewPortfolioError("profit/loss report", "", err)
+	}
+
+	if len(bases) == 0 {
+		return nil, customerrors.ErrEmptyPortfolio
+	}
+
+	var held []string
+	for id, cb := range bases {
+		if !currency.Equal(cb.Currency, vsCurrency) {
+			return nil, customerrors.NewPortfolioError("profit/loss report", id, fmt.Errorf(
+				"%w: recorded in %s, report in %s", customerrors.ErrCurrencyMismatch,
+				strings.ToUpper(currency.OrDefault(cb.Currency)), strings.ToUpper(currency.OrDefault(vsCurrency)),
+			))
+		}
+		if cb.RemainingQuantity() > quantityEpsilon {
+			held = append(held, id)
+		}
+	}
+
+	prices := map[string]float64{}
+	if len(held) > 0 {
+		prices, err = apiClient.FetchMultiplePrices(ctx, vsCurrency, held...)
+		if err != nil {
+			return nil, customerrors.NewPortfolioError("profit/loss report", "", err)
+		}
+	}
+
+	report, err := BuildProfitLossReport(bases, prices, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	report.UserEmail = userEmail
+	report.Currency = vsCurrency
+
+	return report, nil
+}
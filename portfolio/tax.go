@@ -0,0 +1,129 @@
+package portfolio
+
+import (
+	"context"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TaxTerm string
+
+const (
+	TaxTermShort TaxTerm = "short"
+	TaxTermLong  TaxTerm = "long"
+)
+
+// DefaultLongTermThreshold is the holding period after which a gain counts
+// as long-term in most jurisdictions (more than one year).
+const DefaultLongTermThreshold = 365 * 24 * time.Hour
+
+// TaxReportRow amounts are in Currency, the one the coin was traded in.
+type TaxReportRow struct {
+	CoinID       string
+	CoinName     string
+	Currency     string
+	Quantity     float64
+	DateAcquired time.Time
+	DateSold     time.Time
+	Proceeds     float64
+	CostBasis    float64
+	Gain         float64
+	Term         TaxTerm
+}
+
+// BuildTaxReport emits one row per acquisition lot consumed by a sale in the
+// given tax year, splitting the sale's proceeds across lots by quantity.
+func BuildTaxReport(bases map[string]*CostBasis, year int, longTermAfter time.Duration) []TaxReportRow {
+	var rows []TaxReportRow
+	for _, cb := range bases {
+		for _, d := range cb.Disposals {
+			if d.Type != models.TransactionTypeSell || d.DisposedAt.UTC().Year() != year {
+				continue
+			}
+			for _, m := range d.Matches {
+				proceeds := d.Proceeds * m.Quantity / d.Quantity
+				term := TaxTermShort
+				if d.DisposedAt.Sub(m.AcquiredAt) > longTermAfter {
+					term = TaxTermLong
+				}
+				rows = append(rows, TaxReportRow{
+					CoinID:       cb.CoinID,
+					CoinName:     cb.CoinName,
+					Currency:     currency.OrDefault(cb.Currency),
+					Quantity:     m.Quantity,
+					DateAcquired: m.AcquiredAt,
+					DateSold:     d.DisposedAt,
+					Proceeds:     proceeds,
+					CostBasis:    m.CostBasis,
+					Gain:         proceeds - m.CostBasis,
+					Term:         term,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if !rows[i].DateSold.Equal(rows[j].DateSold) {
+			return rows[i].DateSold.Before(rows[j].DateSold)
+		}
+		return rows[i].DateAcquired.Before(rows[j].DateAcquired)
+	})
+
+	return rows
+}
+
+func GenerateTaxReport(ctx context.Context, store db.Store, userEmail string, year int, longTermAfter time.Duration) ([]TaxReportRow, error) {
+	if longTermAfter <= 0 {
+		return nil, customerrors.NewValidationError("long_term_threshold", longTermAfter, fmt.Errorf("must be positive"))
+	}
+
+	bases, err := GetCostBasis(ctx, store, userEmail)
+	if err != nil {
+		return nil, customerrors.NewPortfolioError("tax report", "", err)
+	}
+
+	return BuildTaxReport(bases, year, longTermAfter), nil
+}
+
+func WriteTaxReportCSV(w io.Writer, rows []TaxReportRow) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{
+		"coin_id", "coin_name", "quantity", "date_acquired", "date_sold",
+		"currency", "proceeds", "cost_basis", "gain", "term",
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("tax report: write header: %w", err)
+	}
+
+	for _, r := range rows {
+		money := func(v float64) string { return strconv.FormatFloat(v, 'f', currency.Decimals(r.Currency), 64) }
+		record := []string{
+			r.CoinID,
+			r.CoinName,
+			strconv.FormatFloat(r.Quantity, 'f', -1, 64),
+			r.DateAcquired.UTC().Format("2006-01-02"),
+			r.DateSold.UTC().Format("2006-01-02"),
+			strings.ToUpper(r.Currency),
+			money(r.Proceeds),
+			money(r.CostBasis),
+			money(r.Gain),
+			string(r.Term),
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("tax report: write row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
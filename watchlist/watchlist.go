@@ -0,0 +1,125 @@
+package watchlist
+
+import (
+	"context"
+	"crypto-portfolio-tracker/api"
+	"crypto-portfolio-tracker/currency"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"crypto-portfolio-tracker/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GetWatchlist returns the user's watchlist, or an empty one if they have
+// not watched any coin yet.
+func GetWatchlist(ctx context.Context, store db.Store, userEmail string) (*models.Watchlist, error) {
+	w, err := store.Watchlists().Get(ctx, userEmail)
+	if errors.Is(err, customerrors.ErrNotFound) {
+		return &models.Watchlist{
+			UserEmail: userEmail,
+			Coins:     []models.WatchedCoin{},
+			UpdatedAt: time.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// AddCoin puts coinID on the user's watchlist after checking that the price
+// provider supports it.
+func AddCoin(ctx context.Context, store db.Store, apiClient api.CryptoApi, userEmail, coinID string) (*models.WatchedCoin, error) {
+	coinID = strings.ToLower(strings.TrimSpace(coinID))
+	if coinID == "" {
+		return nil, customerrors.NewValidationError("coin_id", coinID, customerrors.ErrUnknownCoin)
+	}
+
+	w, err := GetWatchlist(ctx, store, userEmail)
+	if err != nil {
+		return nil, err
+	}
+	if w.Has(coinID) {
+		return nil, customerrors.NewValidationError("coin_id", coinID, customerrors.ErrAlreadyWatched)
+	}
+
+	supported, err := apiClient.GetSupportedCoins(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not load supported coins: %w", err)
+	}
+	name, ok := supported[coinID]
+	if !ok {
+		return nil, customerrors.NewValidationError("coin_id", coinID, customerrors.ErrUnknownCoin)
+	}
+
+	coin := models.WatchedCoin{CoinID: coinID, CoinName: name, AddedAt: time.Now()}
+	w.Coins = append(w.Coins, coin)
+	w.UpdatedAt = time.Now()
+	if err := store.Watchlists().Save(ctx, w); err != nil {
+		return nil, err
+	}
+	return &coin, nil
+}
+
+// RemoveCoin takes coinID off the user's watchlist. Alerts already set on it
+// stay active until they trigger or are deleted.
+func RemoveCoin(ctx context.Context, store db.Store, userEmail, coinID string) error {
+	coinID = strings.ToLower(strings.TrimSpace(coinID))
+
+	w, err := GetWatchlist(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]models.WatchedCoin, 0, len(w.Coins))
+	for _, c := range w.Coins {
+		if c.CoinID != coinID {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(w.Coins) {
+		return customerrors.NewValidationError("coin_id", coinID, customerrors.ErrNotWatched)
+	}
+
+	w.Coins = kept
+	w.UpdatedAt = time.Now()
+	return store.Watchlists().Save(ctx, w)
+}
+
+func DisplayWatchlist(ctx context.Context, store db.Store, userEmail string, apiClient api.CryptoApi, vsCurrency string) error {
+	w, err := GetWatchlist(ctx, store, userEmail)
+	if err != nil {
+		return err
+	}
+
+	if len(w.Coins) == 0 {
+		fmt.Println("Your watchlist is empty.")
+		return nil
+	}
+
+	coinIDs := make([]string, len(w.Coins))
+	for i, c := range w.Coins {
+		coinIDs[i] = c.CoinID
+	}
+	prices, err := apiClient.FetchMultiplePrices(ctx, vsCurrency, coinIDs...)
+	if err != nil {
+		fmt.Printf("Warning: could not fetch prices: %v\n", err)
+	}
+
+	fmt.Println("\n========== YOUR WATCHLIST ==========")
+	for i, c := range w.Coins {
+		fmt.Printf("\n[%d] %s (%s)\n", i+1, c.CoinName, c.CoinID)
+		if price, ok := prices[c.CoinID]; ok {
+			fmt.Printf("    Price     : %s\n", currency.Format(price, vsCurrency))
+		} else {
+			fmt.Println("    Price     : unavailable")
+		}
+		fmt.Printf("    Watching  : since %s\n", c.AddedAt.Format("02 Jan 2006"))
+	}
+	fmt.Println("\n====================================")
+
+	return nil
+}
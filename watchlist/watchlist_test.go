@@ -0,0 +1,68 @@
+package watchlist
+
+import (
+	"context"
+	"crypto-portfolio-tracker/db"
+	customerrors "crypto-portfolio-tracker/errors"
+	"errors"
+	"testing"
+)
+
+type mockAPI struct{}
+
+func (mockAPI) FetchPrice(ctx context.Context, coinID, vsCurrency string) (float64, error) {
+	return 0, customerrors.ErrPriceNotAvailable
+}
+
+func (mockAPI) FetchMultiplePrices(ctx context.Context, vsCurrency string, coinIDs ...string) (map[string]float64, error) {
+	return map[string]float64{}, nil
+}
+
+func (mockAPI) GetSupportedCoins(ctx context.Context) (map[string]string, error) {
+	return map[string]string{"bitcoin": "Bitcoin", "solana": "Solana"}, nil
+}
+
+const testUser = "test@example.com"
+
+func TestAddCoin(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+
+	coin, err := AddCoin(ctx, store, mockAPI{}, testUser, " Solana ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if coin.CoinID != "solana" || coin.CoinName != "Solana" {
+		t.Errorf("unexpected coin: %+v", coin)
+	}
+
+	if _, err := AddCoin(ctx, store, mockAPI{}, testUser, "solana"); !errors.Is(err, customerrors.ErrAlreadyWatched) {
+		t.Errorf("expected ErrAlreadyWatched, got: %v", err)
+	}
+	if _, err := AddCoin(ctx, store, mockAPI{}, testUser, "notacoin"); !errors.Is(err, customerrors.ErrUnknownCoin) {
+		t.Errorf("expected ErrUnknownCoin, got: %v", err)
+	}
+
+	w, err := GetWatchlist(ctx, store, testUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(w.Coins) != 1 || !w.Has("solana") {
+		t.Errorf("expected only solana on the watchlist, got %+v", w.Coins)
+	}
+}
+
+func TestRemoveCoin(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemoryStore()
+
+	if _, err := AddCoin(ctx, store, mockAPI{}, testUser, "bitcoin"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RemoveCoin(ctx, store, testUser, "bitcoin"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RemoveCoin(ctx, store, testUser, "bitcoin"); !errors.Is(err, customerrors.ErrNotWatched) {
+		t.Errorf("expected ErrNotWatched, got: %v", err)
+	}
+}